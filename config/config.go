@@ -4,10 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 )
 
+// EventJobTypes are the types of jobs which GhTagJobType and GhReleaseJobType may
+// be. These are job types registered by jobs.JobRunner which accept no data.
+var EventJobTypes = []string{"update_apps", "rollback_apps", "stale_pr_sweep"}
+
 // Config holds application configuration
 type Config struct {
 	// ExternalURL is the host the HTTP server can be accessed by from external users.
@@ -46,30 +52,154 @@ type Config struct {
 	// DbName is the database to connect to inside MongoDB
 	DbName string `default:"kscout-serverless-registry-api-dev" split_words:"true" required:"true"`
 
+	// RegistryProvider is the source code hosting provider of the registry
+	// repository, one of github, gitlab, or gitea. The Gh* fields which are not
+	// about the registry repository are only used by github.
+	RegistryProvider string `default:"github" split_words:"true" required:"true"`
+
+	// RegistryProviderURL is the URL of the GitLab or Gitea server which hosts the
+	// registry repository. Must include a schema. Not used by github.
+	RegistryProviderURL url.URL `envconfig:"registry_provider_url"`
+
+	// RegistryProviderToken is the access token used to authenticate with the GitLab
+	// or Gitea API. Not used by github.
+	RegistryProviderToken string `split_words:"true"`
+
+	// RegistryWebhookSecret is the secret token used to verify requests to the
+	// webhook came from GitLab or Gitea. Not used by github.
+	RegistryWebhookSecret string `split_words:"true"`
+
 	// GhPrivateKeyPath is the path to the GitHub app's secret key
 	GhPrivateKeyPath string `default:"gh.private-key.pem" split_words:"true" required:"true"`
 
-	// GhIntegrationID is the Scout Bot GitHub App ID
-	GhIntegrationID int `split_words:"true" required:"true"`
+	// GhIntegrationID is the Scout Bot GitHub App ID. Required if RegistryProvider
+	// is github.
+	GhIntegrationID int `split_words:"true"`
 
-	// GhInstallationID is an ID sent in the Scout Bot GitHub App webhook
-	GhInstallationID int `split_words:"true" required:"true"`
+	// GhInstallationID is the ID of the Scout Bot GitHub App installation which is
+	// used to access the registry repository. If 0 the installation is found
+	// automatically.
+	GhInstallationID int `split_words:"true"`
 
-	// GhRegistryRepoOwner is the GitHub user / organization which owns the serverless
-	// application registry repository.
+	// GhRegistryRepoOwner is the user / organization which owns the serverless
+	// application registry repository. On GitLab this is the full path of the group.
 	GhRegistryRepoOwner string `default:"kscout" split_words:"true" required:"true"`
 
-	// GhRegistryRepoName is the name of the GitHub repository which acts as a serverless
+	// GhRegistryRepoName is the name of the repository which acts as a serverless
 	// application registry.
 	GhRegistryRepoName string `default:"serverless-apps" split_words:"true" required:"true"`
 
+	// GhRegistryRepos are the full names, in the format owner/name, of additional
+	// registry repositories on GitHub. Their apps are served in the same catalog
+	// as the apps of the GhRegistryRepoOwner/GhRegistryRepoName repository. Each
+	// may be accessed by a different installation of the GitHub App.
+	GhRegistryRepos []string `split_words:"true"`
+
+	// GhRegistryRepoBranch is the branch of the registry repository from which the
+	// apps catalog is built. Pushes to this branch update the catalog.
+	GhRegistryRepoBranch string `default:"master" split_words:"true" required:"true"`
+
+	// GhTagJobType is the type of job submitted when a tag is pushed to the
+	// registry repository. Must be one of EventJobTypes. Empty ignores tag pushes.
+	GhTagJobType string `split_words:"true"`
+
+	// GhReleaseJobType is the type of job submitted when a release is published
+	// in the registry repository. Must be one of EventJobTypes. Empty ignores
+	// releases.
+	GhReleaseJobType string `split_words:"true"`
+
 	// GhWebhookSecret is the secret token used to verify requests to the Webhook came
-	// from GitHub
-	GhWebhookSecret string `split_words:"true" required:"true"`
+	// from GitHub. Required if RegistryProvider is github.
+	GhWebhookSecret string `split_words:"true"`
+
+	// GhWebhookPreviousSecrets are other secrets which are still accepted when
+	// verifying webhook requests. Used to rotate GhWebhookSecret without downtime.
+	GhWebhookPreviousSecrets []string `split_words:"true"`
+
+	// GhWebhookAllowSHA1 when true allows webhook requests which only have a
+	// legacy SHA-1 X-Hub-Signature header. X-Hub-Signature-256 is always checked
+	// first if present.
+	GhWebhookAllowSHA1 bool `default:"false" envconfig:"gh_webhook_allow_sha1"`
+
+	// WebhookDeliveriesMaxBytes is the size of the capped collection which records
+	// webhook deliveries. The oldest deliveries are removed once full. Only used
+	// when the collection is first created.
+	WebhookDeliveriesMaxBytes int64 `default:"52428800" split_words:"true"`
+
+	// WebhookDeliveryClaimsTTL is how long a delivery ID is remembered after it was
+	// last claimed. Repeated deliveries within this time are ignored.
+	WebhookDeliveryClaimsTTL time.Duration `default:"168h" split_words:"true"`
 
 	// GhDevTeamName is the name of an organization team on GitHub which should be pinged
 	// by pull request bot if any internal server errors occur
 	GhDevTeamName string `default:"@kscout/developers" split_words:"true" required:"true"`
+
+	// AdminToken is the bearer token which must be provided to access admin endpoints.
+	// If empty admin endpoints are disabled.
+	AdminToken string `split_words:"true"`
+
+	// ReviewerTokens are the bearer tokens which reviewers provide to change the
+	// verification status of apps. Keys are reviewer names, values are tokens.
+	ReviewerTokens map[string]string `split_words:"true"`
+
+	// UpdateAppsSchedule is a cron expression which determines when the apps
+	// collection is reconciled with the registry repository. Empty disables.
+	UpdateAppsSchedule string `default:"0 * * * *" split_words:"true"`
+
+	// StalePRSweepSchedule is a cron expression which determines when open
+	// pull requests which have not been validated are found and validated.
+	// Empty disables.
+	StalePRSweepSchedule string `default:"*/30 * * * *" envconfig:"stale_pr_sweep_schedule"`
+
+	// JobTimeouts are the maximum durations jobs of certain types may run for.
+	// Keys are job types, values are durations.
+	JobTimeouts map[string]time.Duration `default:"update_apps:15m,validate:5m,stale_pr_sweep:10m,rollback_apps:5m" split_words:"true"`
+
+	// JobDefaultTimeout is the maximum duration a job may run for if its type
+	// is not in JobTimeouts
+	JobDefaultTimeout time.Duration `default:"10m" split_words:"true"`
+
+	// OutboxPollInterval is how often the outbox is checked for messages which
+	// are due to be delivered
+	OutboxPollInterval time.Duration `default:"5s" split_words:"true"`
+
+	// OutboxDeliveryTimeout is the maximum duration of an outbox message
+	// delivery attempt
+	OutboxDeliveryTimeout time.Duration `default:"30s" split_words:"true"`
+
+	// OutboxMaxAttempts is the number of times delivery of an outbox message is
+	// attempted before it is marked as failed
+	OutboxMaxAttempts int `default:"10" split_words:"true"`
+
+	// OutboxRetryBaseDelay is the delay before the first retry of an outbox
+	// message. The delay doubles with each attempt.
+	OutboxRetryBaseDelay time.Duration `default:"10s" split_words:"true"`
+
+	// OutboxRetryMaxDelay is the maximum delay between outbox message
+	// delivery attempts
+	OutboxRetryMaxDelay time.Duration `default:"1h" split_words:"true"`
+
+	// CloudEventsSinkURL is the URL to which CloudEvents about the app catalog are
+	// sent, for example a Knative Eventing Broker. Empty disables.
+	CloudEventsSinkURL string `envconfig:"cloudevents_sink_url"`
+
+	// CloudEventsMode is the HTTP binding mode used to send CloudEvents, either
+	// structured or binary
+	CloudEventsMode string `default:"structured" envconfig:"cloudevents_mode"`
+
+	// ValidateStickyComment when true indicates that the validation comment on a
+	// pull request is edited by later validations. Otherwise each validation makes
+	// a new comment.
+	ValidateStickyComment bool `default:"true" split_words:"true"`
+
+	// GhLabels are the names of labels applied to pull requests based on their
+	// validation result. Keys are label keys, see the jobs.Label* constants,
+	// values are label names. Omit a key to not apply that label.
+	GhLabels map[string]string `default:"new_app:new-app,update_app:update-app,delete_app:delete-app,format_error:format-error,internal_error:internal-error" split_words:"true"`
+
+	// GhCategoryLabelPrefix is prepended to the name of each category touched by a
+	// pull request to create a label
+	GhCategoryLabelPrefix string `default:"category/" split_words:"true"`
 }
 
 // NewConfig loads configuration values from environment variables
@@ -95,9 +225,123 @@ func NewConfig() (*Config, error) {
 		return nil, fmt.Errorf("BotAPIURL field must have scheme")
 	}
 
+	switch config.RegistryProvider {
+	case "github":
+		if config.GhIntegrationID == 0 {
+			return nil, fmt.Errorf("GhIntegrationID field must be set if " +
+				"RegistryProvider is github")
+		}
+
+		if len(config.GhRegistryRepos) > 0 && config.GhInstallationID != 0 {
+			return nil, fmt.Errorf("GhInstallationID field cannot be set if " +
+				"GhRegistryRepos is set, registry repositories may be accessed " +
+				"by different installations")
+		}
+
+		for _, fullName := range config.GhRegistryRepos {
+			if parts := strings.Split(fullName, "/"); len(parts) != 2 ||
+				len(parts[0]) == 0 || len(parts[1]) == 0 {
+
+				return nil, fmt.Errorf("GhRegistryRepos field item \"%s\" must "+
+					"be in the format owner/name", fullName)
+			}
+		}
+
+		if len(config.GhWebhookSecret) == 0 {
+			return nil, fmt.Errorf("GhWebhookSecret field must be set if " +
+				"RegistryProvider is github")
+		}
+	case "gitlab", "gitea":
+		if len(config.RegistryProviderURL.Scheme) == 0 {
+			return nil, fmt.Errorf("RegistryProviderURL field must have scheme "+
+				"if RegistryProvider is %s", config.RegistryProvider)
+		}
+
+		if len(config.RegistryProviderToken) == 0 {
+			return nil, fmt.Errorf("RegistryProviderToken field must be set if "+
+				"RegistryProvider is %s", config.RegistryProvider)
+		}
+
+		if len(config.RegistryWebhookSecret) == 0 {
+			return nil, fmt.Errorf("RegistryWebhookSecret field must be set if "+
+				"RegistryProvider is %s", config.RegistryProvider)
+		}
+	default:
+		return nil, fmt.Errorf("RegistryProvider field must be github, gitlab, " +
+			"or gitea")
+	}
+
+	if config.RegistryProvider != "github" && len(config.GhRegistryRepos) > 0 {
+		return nil, fmt.Errorf("GhRegistryRepos field can only be set if " +
+			"RegistryProvider is github")
+	}
+
+	if config.CloudEventsMode != "structured" && config.CloudEventsMode != "binary" {
+		return nil, fmt.Errorf("CloudEventsMode field must be structured or binary")
+	}
+
+	for field, jobType := range map[string]string{
+		"GhTagJobType":     config.GhTagJobType,
+		"GhReleaseJobType": config.GhReleaseJobType,
+	} {
+		if len(jobType) > 0 && !isEventJobType(jobType) {
+			return nil, fmt.Errorf("%s field must be one of: %s", field,
+				strings.Join(EventJobTypes, ", "))
+		}
+	}
+
 	return &config, nil
 }
 
+// RegistryRepos returns the lowercase full names, in the format owner/name, of every
+// registry repository. The GhRegistryRepoOwner/GhRegistryRepoName repository is
+// first.
+func (c Config) RegistryRepos() []string {
+	repos := []string{strings.ToLower(fmt.Sprintf("%s/%s", c.GhRegistryRepoOwner,
+		c.GhRegistryRepoName))}
+
+	for _, fullName := range c.GhRegistryRepos {
+		fullName = strings.ToLower(fullName)
+
+		duplicate := false
+		for _, repo := range repos {
+			if repo == fullName {
+				duplicate = true
+				break
+			}
+		}
+
+		if !duplicate {
+			repos = append(repos, fullName)
+		}
+	}
+
+	return repos
+}
+
+// IsRegistryRepo returns true if a repository full name, in the format owner/name,
+// is one of the registry repositories
+func (c Config) IsRegistryRepo(fullName string) bool {
+	for _, repo := range c.RegistryRepos() {
+		if strings.EqualFold(fullName, repo) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isEventJobType returns true if jobType is in EventJobTypes
+func isEventJobType(jobType string) bool {
+	for _, t := range EventJobTypes {
+		if t == jobType {
+			return true
+		}
+	}
+
+	return false
+}
+
 // String returns a log safe version of Config in string form. Redacts any sensative fields.
 func (c Config) String() (string, error) {
 	// Redact fields
@@ -109,10 +353,36 @@ func (c Config) String() (string, error) {
 		c.GhWebhookSecret = "REDACTED_NOT_EMPTY"
 	}
 
+	if c.RegistryProviderToken != "" {
+		c.RegistryProviderToken = "REDACTED_NOT_EMPTY"
+	}
+
+	if c.RegistryWebhookSecret != "" {
+		c.RegistryWebhookSecret = "REDACTED_NOT_EMPTY"
+	}
+
+	// Copy so the original secrets are not redacted
+	previousSecrets := []string{}
+	for range c.GhWebhookPreviousSecrets {
+		previousSecrets = append(previousSecrets, "REDACTED_NOT_EMPTY")
+	}
+	c.GhWebhookPreviousSecrets = previousSecrets
+
 	if c.BotAPISecret != "" {
 		c.BotAPISecret = "REDACTED_NOT_EMPTY"
 	}
 
+	if c.AdminToken != "" {
+		c.AdminToken = "REDACTED_NOT_EMPTY"
+	}
+
+	// Copy so the original tokens are not redacted
+	reviewerTokens := map[string]string{}
+	for reviewer := range c.ReviewerTokens {
+		reviewerTokens[reviewer] = "REDACTED_NOT_EMPTY"
+	}
+	c.ReviewerTokens = reviewerTokens
+
 	// Convert to JSON
 	configBytes, err := json.Marshal(c)
 	if err != nil {
@@ -121,3 +391,17 @@ func (c Config) String() (string, error) {
 
 	return string(configBytes), nil
 }
+
+// GhWebhookSecrets returns every secret accepted when verifying webhook requests,
+// GhWebhookSecret first
+func (c Config) GhWebhookSecrets() []string {
+	secrets := []string{c.GhWebhookSecret}
+
+	for _, secret := range c.GhWebhookPreviousSecrets {
+		if len(secret) > 0 {
+			secrets = append(secrets, secret)
+		}
+	}
+
+	return secrets
+}
@@ -38,3 +38,105 @@ func TestSchemaRequiredValidation(t *testing.T) {
 	_, err = NewConfig()
 	assert.Nil(t, err, "NewConfig should have responded with no error")
 }
+
+func TestRegistryProviderValidation(t *testing.T) {
+	for key, value := range map[string]string{
+		"APP_BOT_API_SECRET":    "123",
+		"APP_REGISTRY_PROVIDER": "gitlab",
+	} {
+		assert.NoError(t, os.Setenv(key, value))
+	}
+
+	providerKeys := []string{"APP_REGISTRY_PROVIDER_URL", "APP_REGISTRY_PROVIDER_TOKEN",
+		"APP_REGISTRY_WEBHOOK_SECRET"}
+
+	defer func() {
+		for _, key := range append(providerKeys, "APP_REGISTRY_PROVIDER") {
+			os.Unsetenv(key)
+		}
+	}()
+
+	// GitLab requires a server URL, token and webhook secret
+	_, err := NewConfig()
+	assert.NotNil(t, err, "NewConfig should require GitLab fields")
+
+	for _, key := range providerKeys {
+		assert.NoError(t, os.Setenv(key, "https://gitlab.example.com"))
+	}
+
+	_, err = NewConfig()
+	assert.Nil(t, err, "NewConfig should have responded with no error")
+
+	// Unknown provider
+	assert.NoError(t, os.Setenv("APP_REGISTRY_PROVIDER", "svn"))
+
+	_, err = NewConfig()
+	assert.NotNil(t, err, "NewConfig should reject unknown providers")
+}
+
+func TestEventJobTypeValidation(t *testing.T) {
+	assert.NoError(t, os.Setenv("APP_BOT_API_SECRET", "123"))
+
+	defer func() {
+		os.Unsetenv("APP_GH_TAG_JOB_TYPE")
+		os.Unsetenv("APP_GH_RELEASE_JOB_TYPE")
+	}()
+
+	for _, key := range []string{"APP_GH_TAG_JOB_TYPE", "APP_GH_RELEASE_JOB_TYPE"} {
+		// Job types which require data cannot be submitted by events
+		assert.NoError(t, os.Setenv(key, "validate"))
+
+		_, err := NewConfig()
+		assert.NotNil(t, err, "NewConfig should reject %s=validate", key)
+
+		assert.NoError(t, os.Setenv(key, "update_apps"))
+
+		_, err = NewConfig()
+		assert.Nil(t, err, "NewConfig should accept %s=update_apps", key)
+	}
+}
+
+func TestRegistryReposValidation(t *testing.T) {
+	assert.NoError(t, os.Setenv("APP_BOT_API_SECRET", "123"))
+
+	defer func() {
+		os.Unsetenv("APP_GH_REGISTRY_REPOS")
+		os.Unsetenv("APP_GH_INSTALLATION_ID")
+	}()
+
+	// Set by other tests
+	assert.NoError(t, os.Unsetenv("APP_GH_INSTALLATION_ID"))
+
+	assert.NoError(t, os.Setenv("APP_GH_REGISTRY_REPOS", "other-org/apps,third"))
+
+	_, err := NewConfig()
+	assert.NotNil(t, err, "NewConfig should reject items not in the owner/name format")
+
+	assert.NoError(t, os.Setenv("APP_GH_REGISTRY_REPOS", "other-org/apps"))
+
+	_, err = NewConfig()
+	assert.Nil(t, err, "NewConfig should have responded with no error")
+
+	// Registry repositories may be accessed by different installations
+	assert.NoError(t, os.Setenv("APP_GH_INSTALLATION_ID", "123"))
+
+	_, err = NewConfig()
+	assert.NotNil(t, err, "NewConfig should reject GhInstallationID with GhRegistryRepos")
+}
+
+func TestRegistryRepos(t *testing.T) {
+	cfg := Config{
+		GhRegistryRepoOwner: "kscout",
+		GhRegistryRepoName:  "serverless-apps",
+		GhRegistryRepos: []string{"Other-Org/Apps", "kscout/serverless-apps",
+			"other-org/apps"},
+	}
+
+	assert.Equal(t, []string{"kscout/serverless-apps", "other-org/apps"},
+		cfg.RegistryRepos())
+
+	assert.True(t, cfg.IsRegistryRepo("KScout/Serverless-Apps"))
+	assert.True(t, cfg.IsRegistryRepo("other-org/APPS"))
+	assert.False(t, cfg.IsRegistryRepo("other-org/serverless-apps"))
+	assert.False(t, cfg.IsRegistryRepo(""))
+}
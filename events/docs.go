@@ -0,0 +1,8 @@
+/*
+CloudEvents emitted when the app catalog changes.
+
+Events follow the CloudEvents v1.0 specification and are sent to a sink, like a
+Knative Eventing Broker, using the HTTP protocol binding in structured or binary
+mode. Events are delivered via the outbox so failed deliveries are retried.
+*/
+package events
@@ -0,0 +1,68 @@
+package events
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kscout/serverless-registry-api/config"
+	"github.com/kscout/serverless-registry-api/models"
+	"github.com/kscout/serverless-registry-api/outbox"
+)
+
+// Emitter sends events to the sink configured by Cfg.CloudEventsSinkURL via the outbox
+type Emitter struct {
+	// Cfg is the server configuration
+	Cfg *config.Config
+
+	// Outbox delivers events
+	Outbox outbox.Outbox
+}
+
+// Enabled returns true if a sink is configured
+func (e Emitter) Enabled() bool {
+	return len(e.Cfg.CloudEventsSinkURL) > 0
+}
+
+// Source returns the CloudEvents source attribute of events emitted by the server
+func (e Emitter) Source() string {
+	return e.Cfg.ExternalURL.String()
+}
+
+// Messages creates outbox messages which deliver events. Used when events must be
+// held until a change is committed, see outbox.Outbox.Hold.
+func (e Emitter) Messages(evs []Event) ([]models.OutboxMessage, error) {
+	msgs := []models.OutboxMessage{}
+
+	for _, ev := range evs {
+		headers, body, err := ev.Encode(e.Cfg.CloudEventsMode)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s event: %s", ev.Type,
+				err.Error())
+		}
+
+		msgs = append(msgs, outbox.NewMessage(outbox.DestinationCloudEventsSink,
+			e.Cfg.CloudEventsSinkURL, headers, body))
+	}
+
+	return msgs, nil
+}
+
+// Emit sends events. Does nothing if no sink is configured.
+func (e Emitter) Emit(ctx context.Context, evs ...Event) error {
+	if !e.Enabled() {
+		return nil
+	}
+
+	msgs, err := e.Messages(evs)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range msgs {
+		if err := e.Outbox.Enqueue(ctx, msg); err != nil {
+			return fmt.Errorf("failed to enqueue event: %s", err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kscout/serverless-registry-api/models"
+
+	"github.com/google/uuid"
+)
+
+// SpecVersion is the version of the CloudEvents specification events follow
+const SpecVersion = "1.0"
+
+// Event types
+const (
+	// TypeAppCreated is emitted when an app is added to the catalog
+	TypeAppCreated = "io.kscout.app.created"
+
+	// TypeAppUpdated is emitted when an app in the catalog changes
+	TypeAppUpdated = "io.kscout.app.updated"
+
+	// TypeAppDeleted is emitted when an app is removed from the catalog
+	TypeAppDeleted = "io.kscout.app.deleted"
+
+	// TypeAppValidationCompleted is emitted when a pull request to the registry
+	// repository has been validated
+	TypeAppValidationCompleted = "io.kscout.app.validation.completed"
+)
+
+// Modes in which events can be encoded for HTTP
+const (
+	// ModeStructured places the entire event in the request body
+	ModeStructured = "structured"
+
+	// ModeBinary places event attributes in headers and data in the body
+	ModeBinary = "binary"
+)
+
+// Event is a CloudEvent
+type Event struct {
+	// SpecVersion is the CloudEvents specification version
+	SpecVersion string `json:"specversion"`
+
+	// ID uniquely identifies the event
+	ID string `json:"id"`
+
+	// Source identifies the producer of the event
+	Source string `json:"source"`
+
+	// Type of event
+	Type string `json:"type"`
+
+	// Subject identifies what the event is about within the source
+	Subject string `json:"subject,omitempty"`
+
+	// Time the event occurred
+	Time time.Time `json:"time"`
+
+	// DataContentType is the media type of Data
+	DataContentType string `json:"datacontenttype"`
+
+	// Data is the JSON encoded event payload
+	Data json.RawMessage `json:"data"`
+}
+
+// NewEvent creates an event with a JSON encoded payload
+func NewEvent(source, eventType, subject string, data interface{}) (Event, error) {
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to marshal %s event data into JSON: %s",
+			eventType, err.Error())
+	}
+
+	return Event{
+		SpecVersion:     SpecVersion,
+		ID:              uuid.New().String(),
+		Source:          source,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            dataBytes,
+	}, nil
+}
+
+// Encode returns the HTTP headers and body used to send the event in a mode
+func (e Event) Encode(mode string) (map[string]string, []byte, error) {
+	switch mode {
+	case ModeStructured:
+		body, err := json.Marshal(e)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal event into JSON: %s",
+				err.Error())
+		}
+
+		return map[string]string{
+			"Content-Type": "application/cloudevents+json; charset=utf-8",
+		}, body, nil
+	case ModeBinary:
+		headers := map[string]string{
+			"Content-Type":   e.DataContentType,
+			"Ce-Specversion": e.SpecVersion,
+			"Ce-Id":          e.ID,
+			"Ce-Source":      e.Source,
+			"Ce-Type":        e.Type,
+			"Ce-Time":        e.Time.Format(time.RFC3339Nano),
+		}
+
+		if len(e.Subject) > 0 {
+			headers["Ce-Subject"] = e.Subject
+		}
+
+		return headers, []byte(e.Data), nil
+	default:
+		return nil, nil, fmt.Errorf("unknown mode: %s", mode)
+	}
+}
+
+// ValidationCompletedData is the payload of TypeAppValidationCompleted events
+type ValidationCompletedData struct {
+	// PullRequestNumber is the number of the pull request which was validated
+	PullRequestNumber int `json:"pull_request_number"`
+
+	// HeadSHA is the commit which was validated
+	HeadSHA string `json:"head_sha"`
+
+	// Conclusion of validation, one of: success, failure, cancelled
+	Conclusion string `json:"conclusion"`
+
+	// AppIDs are the IDs of apps modified by the pull request
+	AppIDs []string `json:"app_ids"`
+
+	// DeletedAppIDs are the IDs of apps deleted by the pull request
+	DeletedAppIDs []string `json:"deleted_app_ids"`
+
+	// FailedAppIDs are the IDs of modified apps which are not valid
+	FailedAppIDs []string `json:"failed_app_ids"`
+}
+
+// AppsDeltaEvents creates an event for each app which changed
+func AppsDeltaEvents(source string, delta models.AppsDelta) ([]Event, error) {
+	evs := []Event{}
+
+	changeSets := []struct {
+		eventType string
+		changes   []models.AppChange
+	}{
+		{TypeAppCreated, delta.Created},
+		{TypeAppUpdated, delta.Updated},
+		{TypeAppDeleted, delta.Deleted},
+	}
+
+	for _, changeSet := range changeSets {
+		for _, change := range changeSet.changes {
+			ev, err := NewEvent(source, changeSet.eventType, change.AppID, change)
+			if err != nil {
+				return nil, err
+			}
+
+			evs = append(evs, ev)
+		}
+	}
+
+	return evs, nil
+}
@@ -0,0 +1,42 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventEncode(t *testing.T) {
+	ev, err := NewEvent("https://api.kscout.io", TypeAppCreated, "hello-world",
+		map[string]string{"app_id": "hello-world"})
+	assert.NoError(t, err)
+
+	// {{{1 Structured
+	headers, body, err := ev.Encode(ModeStructured)
+	assert.NoError(t, err)
+	assert.Equal(t, "application/cloudevents+json; charset=utf-8",
+		headers["Content-Type"])
+
+	var structured map[string]interface{}
+	assert.NoError(t, json.Unmarshal(body, &structured))
+	assert.Equal(t, "1.0", structured["specversion"])
+	assert.Equal(t, TypeAppCreated, structured["type"])
+	assert.Equal(t, "hello-world", structured["subject"])
+	assert.Equal(t, map[string]interface{}{"app_id": "hello-world"},
+		structured["data"])
+
+	// {{{1 Binary
+	headers, body, err = ev.Encode(ModeBinary)
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", headers["Content-Type"])
+	assert.Equal(t, "1.0", headers["Ce-Specversion"])
+	assert.Equal(t, ev.ID, headers["Ce-Id"])
+	assert.Equal(t, TypeAppCreated, headers["Ce-Type"])
+	assert.Equal(t, "hello-world", headers["Ce-Subject"])
+	assert.JSONEq(t, `{"app_id": "hello-world"}`, string(body))
+
+	// {{{1 Unknown
+	_, _, err = ev.Encode("foo")
+	assert.Error(t, err)
+}
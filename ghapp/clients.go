@@ -0,0 +1,308 @@
+package ghapp
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kscout/serverless-registry-api/config"
+	"github.com/kscout/serverless-registry-api/models"
+
+	"github.com/bradleyfalzon/ghinstallation"
+	"github.com/google/go-github/v26/github"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Clients creates GitHub API clients for the GitHub App and its installations.
+// Create with NewClients.
+type Clients struct {
+	// Cfg is the server configuration
+	Cfg *config.Config
+
+	// MDbInstallations is used to access the installations collection
+	MDbInstallations *mongo.Collection
+
+	// privateKey is the GitHub App's private key
+	privateKey []byte
+
+	// app authenticates as the GitHub App
+	app *github.Client
+
+	// transports authenticate as installations, keys are installation IDs
+	transports map[int64]*ghinstallation.Transport
+
+	// repoInstallations caches the installation IDs of repositories, keys are
+	// lowercase repository full names
+	repoInstallations map[string]int64
+
+	// lock protects transports and repoInstallations
+	lock sync.Mutex
+}
+
+// NewClients loads the GitHub App's private key and creates Clients
+func NewClients(cfg *config.Config, mDbInstallations *mongo.Collection) (*Clients, error) {
+	privateKey, err := ioutil.ReadFile(cfg.GhPrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GitHub App private key file: %s",
+			err.Error())
+	}
+
+	appTransport, err := ghinstallation.NewAppsTransport(http.DefaultTransport,
+		cfg.GhIntegrationID, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub App transport: %s",
+			err.Error())
+	}
+
+	return &Clients{
+		Cfg:               cfg,
+		MDbInstallations:  mDbInstallations,
+		privateKey:        privateKey,
+		app:               github.NewClient(&http.Client{Transport: appTransport}),
+		transports:        map[int64]*ghinstallation.Transport{},
+		repoInstallations: map[string]int64{},
+	}, nil
+}
+
+// App returns a client which authenticates as the GitHub App. Only app endpoints
+// can be used.
+func (c *Clients) App() *github.Client {
+	return c.app
+}
+
+// transport returns a transport which authenticates as an installation
+func (c *Clients) transport(installationID int64) (*ghinstallation.Transport, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if tr, ok := c.transports[installationID]; ok {
+		return tr, nil
+	}
+
+	tr, err := ghinstallation.New(http.DefaultTransport, c.Cfg.GhIntegrationID,
+		int(installationID), c.privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transport for installation "+
+			"%d: %s", installationID, err.Error())
+	}
+
+	c.transports[installationID] = tr
+
+	return tr, nil
+}
+
+// Installation returns a client which authenticates as an installation
+func (c *Clients) Installation(installationID int64) (*github.Client, error) {
+	tr, err := c.transport(installationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return github.NewClient(&http.Client{Transport: tr}), nil
+}
+
+// RepositoryInstallationID returns the ID of the installation which can access a
+// repository. If config.Config.GhInstallationID is set it is always used.
+// Otherwise the installations collection is searched, if no installation is found
+// the GitHub API is asked.
+func (c *Clients) RepositoryInstallationID(ctx context.Context, owner,
+	name string) (int64, error) {
+
+	if c.Cfg.GhInstallationID != 0 {
+		return int64(c.Cfg.GhInstallationID), nil
+	}
+
+	fullName := strings.ToLower(fmt.Sprintf("%s/%s", owner, name))
+
+	// {{{1 Check cache
+	c.lock.Lock()
+	id, ok := c.repoInstallations[fullName]
+	c.lock.Unlock()
+
+	if ok {
+		return id, nil
+	}
+
+	// {{{1 Check db
+	var installation models.Installation
+
+	err := c.MDbInstallations.FindOne(ctx, bson.D{{"repositories", fullName}}).
+		Decode(&installation)
+	if err == mongo.ErrNoDocuments {
+		// {{{1 Ask GitHub
+		ghInstallation, _, err := c.app.Apps.FindRepositoryInstallation(ctx, owner,
+			name)
+		if err != nil {
+			return 0, fmt.Errorf("failed to find installation for repository "+
+				"%s: %s", fullName, err.Error())
+		}
+
+		installation = models.Installation{
+			ID:           ghInstallation.GetID(),
+			Account:      ghInstallation.GetAccount().GetLogin(),
+			Repositories: []string{fullName},
+		}
+
+		if err := c.AddRepositories(ctx, installation); err != nil {
+			return 0, err
+		}
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to find installation for repository %s "+
+			"in db: %s", fullName, err.Error())
+	}
+
+	c.lock.Lock()
+	c.repoInstallations[fullName] = installation.ID
+	c.lock.Unlock()
+
+	return installation.ID, nil
+}
+
+// Repository returns a client which authenticates as the installation which can
+// access a repository
+func (c *Clients) Repository(ctx context.Context, owner, name string) (*github.Client, error) {
+	id, err := c.RepositoryInstallationID(ctx, owner, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Installation(id)
+}
+
+// Registry returns a client which authenticates as the installation which can
+// access the registry repository. The installation is found for each request, so
+// the client keeps working if the app is re-installed.
+func (c *Clients) Registry() *github.Client {
+	return github.NewClient(&http.Client{Transport: registryTransport{
+		clients: c,
+	}})
+}
+
+// registryTransport authenticates requests as the installation which can access the
+// registry repository
+type registryTransport struct {
+	clients *Clients
+}
+
+// RoundTrip implements http.RoundTripper
+func (t registryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id, err := t.clients.RepositoryInstallationID(req.Context(),
+		t.clients.Cfg.GhRegistryRepoOwner, t.clients.Cfg.GhRegistryRepoName)
+	if err != nil {
+		return nil, err
+	}
+
+	tr, err := t.clients.transport(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return tr.RoundTrip(req)
+}
+
+// forget clears cached installation IDs
+func (c *Clients) forget() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.repoInstallations = map[string]int64{}
+}
+
+// SaveInstallation records an installation, replacing any existing record
+func (c *Clients) SaveInstallation(ctx context.Context, installation models.Installation) error {
+	installation.UpdatedAt = time.Now()
+
+	upsertTrue := true
+	_, err := c.MDbInstallations.ReplaceOne(ctx, bson.D{{"_id", installation.ID}},
+		installation, &options.ReplaceOptions{
+			Upsert: &upsertTrue,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to save installation %d: %s", installation.ID,
+			err.Error())
+	}
+
+	c.forget()
+
+	return nil
+}
+
+// DeleteInstallation removes an installation's record
+func (c *Clients) DeleteInstallation(ctx context.Context, installationID int64) error {
+	_, err := c.MDbInstallations.DeleteOne(ctx, bson.D{{"_id", installationID}})
+	if err != nil {
+		return fmt.Errorf("failed to delete installation %d: %s", installationID,
+			err.Error())
+	}
+
+	c.lock.Lock()
+	delete(c.transports, installationID)
+	c.lock.Unlock()
+
+	c.forget()
+
+	return nil
+}
+
+// AddRepositories records that an installation can access the repositories in its
+// Repositories field. The installation is recorded if it does not exist.
+func (c *Clients) AddRepositories(ctx context.Context, installation models.Installation) error {
+	upsertTrue := true
+	_, err := c.MDbInstallations.UpdateOne(ctx, bson.D{{"_id", installation.ID}},
+		bson.D{
+			{"$set", bson.D{
+				{"account", installation.Account},
+				{"updated_at", time.Now()},
+			}},
+			{"$addToSet", bson.D{{"repositories", bson.D{
+				{"$each", installation.Repositories},
+			}}}},
+		}, &options.UpdateOptions{
+			Upsert: &upsertTrue,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to add repositories to installation %d: %s",
+			installation.ID, err.Error())
+	}
+
+	c.forget()
+
+	return nil
+}
+
+// RemoveRepositories records that an installation can no longer access
+// repositories
+func (c *Clients) RemoveRepositories(ctx context.Context, installationID int64,
+	repositories []string) error {
+
+	_, err := c.MDbInstallations.UpdateOne(ctx, bson.D{{"_id", installationID}},
+		bson.D{
+			{"$set", bson.D{{"updated_at", time.Now()}}},
+			{"$pullAll", bson.D{{"repositories", repositories}}},
+		})
+	if err != nil {
+		return fmt.Errorf("failed to remove repositories from installation %d: %s",
+			installationID, err.Error())
+	}
+
+	c.forget()
+
+	return nil
+}
+
+// RepositoryNames returns the lowercase full names of repositories
+func RepositoryNames(repos []*github.Repository) []string {
+	names := []string{}
+
+	for _, repo := range repos {
+		names = append(names, strings.ToLower(repo.GetFullName()))
+	}
+
+	return names
+}
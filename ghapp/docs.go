@@ -0,0 +1,9 @@
+/*
+GitHub API clients for each installation of the GitHub App.
+
+The GitHub App can be installed on many accounts. Clients authenticate as the
+app with a JWT, or as an installation with an installation token. Installations
+and the repositories they can access are stored in the installations collection,
+which is kept up to date by installation webhook events.
+*/
+package ghapp
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// AdminAuthHandler only allows requests which provide the admin token as a bearer
+// token in the Authorization header to reach Handler. If config.Config.AdminToken
+// is empty all requests are rejected.
+type AdminAuthHandler struct {
+	BaseHandler
+
+	// Handler which requires authentication
+	Handler http.Handler
+}
+
+// ServeHTTP implements http.Handler
+func (h AdminAuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	if len(h.Cfg.AdminToken) == 0 || len(token) == 0 ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(h.Cfg.AdminToken)) != 1 {
+		h.RespondJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "unauthorized",
+		})
+		return
+	}
+
+	h.Handler.ServeHTTP(w, r)
+}
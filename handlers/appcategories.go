@@ -2,9 +2,7 @@ package handlers
 
 
 import (
-	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"net/http"
 	"strings"
 )
@@ -23,62 +21,42 @@ func (h AppCategoriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	vars := r.URL.Query()
 	query := vars.Get("query")
 
-	result := getCategoriesFromDB(query, h)
+	// other search filters narrow the apps counted
+	searchQuery, err := getSearchQuery("", vars.Get("tags"), vars.Get("categories"),
+		vars.Get("verification_status"))
+	if err != nil {
+		h.RespondJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
 
-	resp := map[string][]string{
-		"categories":result,
+	result := getCategoriesFromDB(query, searchQuery, h)
+
+	resp := map[string]interface{}{
+		"categories":facetValues(result),
+		"counts":result,
 	}
 
 	h.RespondJSON(w, http.StatusOK, resp)
 }
 
 
-func getCategoriesFromDB(query string, h AppCategoriesHandler) []string {
-
-	categoriesBson := bson.D{}
+// getCategoriesFromDB counts the categories of apps which match a search. Like the
+// categories facet of a search, the search's own categories filter is not applied.
+func getCategoriesFromDB(query string, searchQuery appQuery, h AppCategoriesHandler) []FacetValue {
 
-	// if we have additional parametres, only get the tags of matched apps.
+	// if we have additional parametres, only count the categories of matched apps.
 	if len(query)>0{
 		query := strings.Split(query, ",")
-		categoriesBson = append(categoriesBson, bson.E{
-			"categories",
-			bson.D{{"$in", query}},
+		searchQuery.Filter = append(append(bson.D{}, searchQuery.Filter...), bson.E{
+			"categories", bson.D{{"$in", query}},
 		})
 	}
 
-	// Declaring structure to set projection in find. used to single out the column. for more info see *findoptions in mongo
-	type fields struct {
-		Categories int `bson:"categories"`
-	}
-
-	// Declaring structure to decode the output from the mongo categories search query
-	type categoriesRes struct{
-		Categories []string `json:"categories" bson:"categories"`
-	}
-
-	// setting projection
-	projection := fields{
-		Categories: 1,
-	}
-
-	result, err := h.MDbApps.Find(h.Ctx, categoriesBson, options.Find().SetProjection(projection) )
-	if err != nil {
-		panic(fmt.Errorf("unable to query database: %s", err.Error()))
-	}
-
-	// declaring return string
-	ret := []string{}
-
-	for result.Next(h.Ctx) {
-		a := categoriesRes{}
-		if err = result.Decode(&a); err != nil {
-			panic(fmt.Errorf("Error in decode %s", err.Error()))
-		}
-		ret= append(ret, a.Categories...)
-
-	}
+	_, facets := h.getAppFacets(searchQuery)
 
-	return removeDuplicates(ret)
+	return facets.Categories
 }
 
 
@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kscout/serverless-registry-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Orders in which apps can be listed
+const (
+	// AppListSortRelevance lists the best matches for the search first. Only
+	// valid if the search has relevance, name order is used otherwise.
+	AppListSortRelevance = "relevance"
+
+	// AppListSortName lists apps alphabetically by name
+	AppListSortName = "name"
+
+	// AppListSortUpdated lists the most recently updated apps first
+	AppListSortUpdated = "updated"
+
+	// AppListSortPopularity lists the most deployed apps first
+	AppListSortPopularity = "popularity"
+)
+
+// appListSorts are the valid values of the sort query parameter
+var appListSorts = []string{AppListSortRelevance, AppListSortName,
+	AppListSortUpdated, AppListSortPopularity}
+
+// defaultAppListLimit is the number of apps listed if no limit is provided
+const defaultAppListLimit = 20
+
+// maxAppListLimit is the largest number of apps which can be listed at once
+const maxAppListLimit = 100
+
+// appListCursor is the position in a list of apps, the sort keys of the last app
+// before the position. Encoded as base64 JSON so clients treat it as opaque.
+type appListCursor struct {
+	// Sort is the order of the list the cursor is a position in
+	Sort string `json:"sort"`
+
+	// Relevance of the app, if Sort is AppListSortRelevance
+	Relevance float64 `json:"relevance,omitempty" bson:"relevance"`
+
+	// UpdatedAt of the app, if Sort is AppListSortUpdated. Apps without an
+	// updated_at field are sorted as if they were updated at the Unix epoch.
+	UpdatedAt time.Time `json:"updated_at" bson:"sort_updated_at"`
+
+	// Popularity of the app, if Sort is AppListSortPopularity
+	Popularity int64 `json:"popularity,omitempty" bson:"popularity"`
+
+	// SortName is the lowercase name of the app
+	SortName string `json:"sort_name" bson:"sort_name"`
+
+	// AppID of the app
+	AppID string `json:"app_id" bson:"app_id"`
+}
+
+// encode cursor for use in a query parameter
+func (c appListCursor) encode() string {
+	cBytes, err := json.Marshal(c)
+	if err != nil {
+		panic(fmt.Errorf("failed to marshal cursor into JSON: %s", err.Error()))
+	}
+
+	return base64.RawURLEncoding.EncodeToString(cBytes)
+}
+
+// value returns the cursor's value of a sort key field
+func (c appListCursor) value(field string) interface{} {
+	switch field {
+	case "relevance":
+		return c.Relevance
+	case "sort_updated_at":
+		return c.UpdatedAt
+	case "popularity":
+		return c.Popularity
+	case "sort_name":
+		return c.SortName
+	default:
+		return c.AppID
+	}
+}
+
+// appListSortKey is a field apps are sorted by
+type appListSortKey struct {
+	// Field which is sorted by
+	Field string
+
+	// Order is 1 for ascending, -1 for descending
+	Order int
+}
+
+// appListSortKeys returns the fields apps are sorted by. Apps are sorted by name,
+// then ID, after the sort's own keys so every app has a unique position.
+func appListSortKeys(sortBy string) []appListSortKey {
+	keys := []appListSortKey{}
+
+	switch sortBy {
+	case AppListSortRelevance:
+		keys = append(keys, appListSortKey{"relevance", -1})
+	case AppListSortUpdated:
+		keys = append(keys, appListSortKey{"sort_updated_at", -1})
+	case AppListSortPopularity:
+		keys = append(keys, appListSortKey{"popularity", -1})
+	}
+
+	return append(keys, appListSortKey{"sort_name", 1},
+		appListSortKey{"app_id", 1})
+}
+
+// appListAfterFilter matches apps which are sorted after a cursor. An app is after
+// the cursor if it is after the cursor in the first sort key where they differ.
+func appListAfterFilter(keys []appListSortKey, cursor appListCursor) bson.D {
+	or := bson.A{}
+
+	for i, key := range keys {
+		clause := bson.D{}
+
+		for _, equalKey := range keys[:i] {
+			clause = append(clause, bson.E{equalKey.Field,
+				cursor.value(equalKey.Field)})
+		}
+
+		op := "$gt"
+		if key.Order < 0 {
+			op = "$lt"
+		}
+
+		clause = append(clause, bson.E{key.Field, bson.D{{op,
+			cursor.value(key.Field)}}})
+
+		or = append(or, clause)
+	}
+
+	return bson.D{{"$or", or}}
+}
+
+// appListParams are the pagination and sorting query parameters of an app listing
+type appListParams struct {
+	// Limit is the maximum number of apps to list
+	Limit int64
+
+	// Sort is the order of apps, one of the AppListSort* constants
+	Sort string
+
+	// After is the position after which apps are listed, nil for the first page
+	After *appListCursor
+}
+
+// parseAppListParams parses the limit, sort and cursor query parameters. Apps are
+// sorted by relevance by default if hasRelevance is true, otherwise by name.
+// Errors are safe to show to the client.
+func parseAppListParams(query url.Values, hasRelevance bool) (appListParams, error) {
+	params := appListParams{
+		Limit: defaultAppListLimit,
+		Sort:  AppListSortName,
+	}
+
+	if hasRelevance {
+		params.Sort = AppListSortRelevance
+	}
+
+	// {{{1 Limit
+	if limitStr := query.Get("limit"); len(limitStr) > 0 {
+		limit, err := strconv.ParseInt(limitStr, 10, 64)
+		if err != nil || limit < 1 || limit > maxAppListLimit {
+			return params, fmt.Errorf("limit must be an integer from 1 to %d",
+				maxAppListLimit)
+		}
+
+		params.Limit = limit
+	}
+
+	// {{{1 Sort
+	if sortStr := query.Get("sort"); len(sortStr) > 0 {
+		valid := false
+		for _, s := range appListSorts {
+			if sortStr == s {
+				valid = true
+				break
+			}
+		}
+
+		if !valid {
+			return params, fmt.Errorf("sort must be one of: %s",
+				strings.Join(appListSorts, ", "))
+		}
+
+		params.Sort = sortStr
+	}
+
+	// Searches without relevance have no best matches
+	if params.Sort == AppListSortRelevance && !hasRelevance {
+		params.Sort = AppListSortName
+	}
+
+	// {{{1 Cursor
+	if cursorStr := query.Get("cursor"); len(cursorStr) > 0 {
+		var cursor appListCursor
+
+		cBytes, err := base64.RawURLEncoding.DecodeString(cursorStr)
+		if err == nil {
+			err = json.Unmarshal(cBytes, &cursor)
+		}
+		if err != nil || len(cursor.AppID) == 0 {
+			return params, errors.New("cursor is not valid")
+		}
+
+		if cursor.Sort != params.Sort {
+			return params, errors.New("cursor is for a different sort")
+		}
+
+		params.After = &cursor
+	}
+
+	return params, nil
+}
+
+// appQuery selects apps to list
+type appQuery struct {
+	// Filter apps must match, other than the FacetFilters
+	Filter bson.D
+
+	// FacetFilters are filters on fields which are counted in facets, apps must
+	// match them too. Keys are app fields. Each is ignored when counting the
+	// values of its own field, see facetFilter.
+	FacetFilters bson.D
+
+	// Relevance is an aggregation expression which scores how well an app
+	// matches, higher is better. Nil if the query has no relevance, in which
+	// case apps cannot be sorted by relevance.
+	Relevance interface{}
+}
+
+// all returns the filter apps must match
+func (q appQuery) all() bson.D {
+	return append(append(bson.D{}, q.Filter...), q.FacetFilters...)
+}
+
+// facetFilter returns the facet filters apps counted in the facet of a field must
+// match: every facet filter except the one on the field. So a value's count is the
+// number of apps which would match if it were selected, alongside the values
+// already selected for the field.
+func (q appQuery) facetFilter(field string) bson.D {
+	filter := bson.D{}
+
+	for _, e := range q.FacetFilters {
+		if e.Key != field {
+			filter = append(filter, e)
+		}
+	}
+
+	return filter
+}
+
+// appListPage is a page of apps
+type appListPage struct {
+	// Apps in page
+	Apps []models.App
+
+	// Total is the number of apps which match the query, on all pages
+	Total int64
+
+	// Facets of all apps which match the query
+	Facets AppFacets
+
+	// Next is the position after the last app of the page, nil if there are no
+	// apps after this page
+	Next *appListCursor
+}
+
+// listApps returns a page of apps. Popularity is read from the app_stats
+// collection, passed as mDbAppStats.
+func (h BaseHandler) listApps(mDbAppStats *mongo.Collection, query appQuery,
+	params appListParams) appListPage {
+
+	// {{{1 Facets
+	total, facets := h.getAppFacets(query)
+
+	page := appListPage{
+		Apps:   []models.App{},
+		Total:  total,
+		Facets: facets,
+	}
+
+	// {{{1 Page
+	// {{{2 Compute sort keys
+	pipeline := mongo.Pipeline{
+		bson.D{{"$match", query.all()}},
+	}
+
+	switch params.Sort {
+	case AppListSortRelevance:
+		pipeline = append(pipeline, bson.D{{"$addFields", bson.D{
+			{"relevance", query.Relevance},
+		}}})
+	case AppListSortUpdated:
+		pipeline = append(pipeline, bson.D{{"$addFields", bson.D{
+			{"sort_updated_at", bson.D{{"$ifNull",
+				bson.A{"$updated_at", time.Unix(0, 0)}}}},
+		}}})
+	case AppListSortPopularity:
+		pipeline = append(pipeline,
+			bson.D{{"$lookup", bson.D{
+				{"from", mDbAppStats.Name()},
+				{"localField", "app_id"},
+				{"foreignField", "app_id"},
+				{"as", "stats"},
+			}}},
+			bson.D{{"$addFields", bson.D{{"popularity", bson.D{{"$ifNull",
+				bson.A{bson.D{{"$arrayElemAt", bson.A{"$stats.deploys", 0}}}, 0},
+			}}}}}})
+	}
+
+	pipeline = append(pipeline, bson.D{{"$addFields", bson.D{
+		{"sort_name", bson.D{{"$toLower", "$name"}}},
+	}}})
+
+	// {{{2 Start after cursor
+	sortKeys := appListSortKeys(params.Sort)
+
+	if params.After != nil {
+		pipeline = append(pipeline, bson.D{{"$match",
+			appListAfterFilter(sortKeys, *params.After)}})
+	}
+
+	// {{{2 Query
+	sortDoc := bson.D{}
+	for _, key := range sortKeys {
+		sortDoc = append(sortDoc, bson.E{key.Field, key.Order})
+	}
+
+	// One more app than the limit is queried to find if there is a next page
+	pipeline = append(pipeline,
+		bson.D{{"$sort", sortDoc}},
+		bson.D{{"$limit", params.Limit + 1}},
+		bson.D{{"$project", bson.D{
+			{"stats", 0},
+		}}})
+
+	cursor, err := h.MDbApps.Aggregate(h.Ctx, pipeline)
+	if err != nil {
+		panic(fmt.Errorf("failed to query apps in db: %s", err.Error()))
+	}
+	defer cursor.Close(h.Ctx)
+
+	var last appListCursor
+
+	for cursor.Next(h.Ctx) {
+		if int64(len(page.Apps)) == params.Limit {
+			page.Next = &last
+			break
+		}
+
+		var app models.App
+		if err := cursor.Decode(&app); err != nil {
+			panic(fmt.Errorf("failed to decode app: %s", err.Error()))
+		}
+
+		last = appListCursor{}
+		if err := cursor.Decode(&last); err != nil {
+			panic(fmt.Errorf("failed to decode app sort keys: %s", err.Error()))
+		}
+		last.Sort = params.Sort
+
+		page.Apps = append(page.Apps, app)
+	}
+
+	if err := cursor.Err(); err != nil {
+		panic(fmt.Errorf("failed to iterate over apps: %s", err.Error()))
+	}
+
+	return page
+}
+
+// respondAppList sends a page of apps. The response includes a link to the next
+// page, with the same query parameters as the request.
+func (h BaseHandler) respondAppList(w http.ResponseWriter, r *http.Request,
+	params appListParams, page appListPage) {
+
+	var next *string
+
+	if page.Next != nil {
+		nextQuery := r.URL.Query()
+		nextQuery.Set("limit", strconv.FormatInt(params.Limit, 10))
+		nextQuery.Set("sort", params.Sort)
+		nextQuery.Set("cursor", page.Next.encode())
+
+		nextURL := h.Cfg.ExternalURL
+		nextURL.Path = r.URL.Path
+		nextURL.RawQuery = nextQuery.Encode()
+
+		nextStr := nextURL.String()
+		next = &nextStr
+	}
+
+	h.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"apps":       page.Apps,
+		"categories": facetValues(page.Facets.Categories),
+		"tags":       facetValues(page.Facets.Tags),
+		"facets":     page.Facets,
+		"total":      page.Total,
+		"next":       next,
+	})
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseAppListParams(t *testing.T) {
+	// Defaults
+	params, err := parseAppListParams(url.Values{}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, appListParams{
+		Limit: defaultAppListLimit,
+		Sort:  AppListSortRelevance,
+	}, params)
+
+	// Searches without relevance are sorted by name
+	for _, query := range []url.Values{
+		url.Values{},
+		url.Values{"sort": {AppListSortRelevance}},
+	} {
+		params, err = parseAppListParams(query, false)
+		assert.NoError(t, err)
+		assert.Equal(t, AppListSortName, params.Sort, query.Encode())
+	}
+
+	// Cursor from a previous page
+	after := appListCursor{
+		Sort:       AppListSortPopularity,
+		Popularity: 12,
+		UpdatedAt:  time.Unix(0, 0).UTC(),
+		SortName:   "hello world",
+		AppID:      "hello-world",
+	}
+	cursor := after.encode()
+
+	params, err = parseAppListParams(url.Values{
+		"limit":  {"20"},
+		"sort":   {AppListSortPopularity},
+		"cursor": {cursor},
+	}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, appListParams{
+		Limit: 20,
+		Sort:  AppListSortPopularity,
+		After: &after,
+	}, params)
+
+	// Invalid
+	for _, query := range []url.Values{
+		url.Values{"limit": {"0"}},
+		url.Values{"limit": {"101"}},
+		url.Values{"limit": {"ten"}},
+		url.Values{"sort": {"stars"}},
+		url.Values{"cursor": {"not-a-cursor"}},
+		url.Values{"cursor": {appListCursor{Sort: AppListSortRelevance}.encode()}},
+		url.Values{"sort": {AppListSortName}, "cursor": {cursor}},
+	} {
+		_, err := parseAppListParams(query, true)
+		assert.Error(t, err, query.Encode())
+	}
+}
+
+func TestAppListAfterFilter(t *testing.T) {
+	cursor := appListCursor{
+		Sort:       AppListSortPopularity,
+		Popularity: 12,
+		SortName:   "hello world",
+		AppID:      "hello-world",
+	}
+
+	// Descending keys continue with lower values, ascending keys with higher
+	assert.Equal(t, bson.D{{"$or", bson.A{
+		bson.D{{"popularity", bson.D{{"$lt", int64(12)}}}},
+		bson.D{
+			{"popularity", int64(12)},
+			{"sort_name", bson.D{{"$gt", "hello world"}}},
+		},
+		bson.D{
+			{"popularity", int64(12)},
+			{"sort_name", "hello world"},
+			{"app_id", bson.D{{"$gt", "hello-world"}}},
+		},
+	}}}, appListAfterFilter(appListSortKeys(AppListSortPopularity), cursor))
+
+	assert.Equal(t, bson.D{{"$or", bson.A{
+		bson.D{{"sort_name", bson.D{{"$gt", "hello world"}}}},
+		bson.D{
+			{"sort_name", "hello world"},
+			{"app_id", bson.D{{"$gt", "hello-world"}}},
+		},
+	}}}, appListAfterFilter(appListSortKeys(AppListSortName), cursor))
+}
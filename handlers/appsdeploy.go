@@ -4,6 +4,7 @@ package handlers
 import (
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	//"go.mongodb.org/mongo-driver/mongo/options"
 	"net/http"
 	"github.com/gorilla/mux"
@@ -14,6 +15,9 @@ import (
 // AppsDeployHandler returns a custom Bash deployment script for the specified app
 type AppsDeployHandler struct {
 	BaseHandler
+
+	// MDbAppStats is the app_stats collection, deploys are counted in it
+	MDbAppStats *mongo.Collection
 }
 
 // ServeHTTP implements http.Handler
@@ -45,6 +49,8 @@ func (h AppsDeployHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		ret = a.Deployment.DeployScript
 
+	h.recordDeploy(h.MDbAppStats, a.AppID)
+
 	h.RespondTEXT(w, http.StatusOK, ret)
 }
 
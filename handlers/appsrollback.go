@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kscout/serverless-registry-api/jobs"
+)
+
+// AppsRollbackHandler submits a job which swaps the current and previous
+// generations of the apps collection
+type AppsRollbackHandler struct {
+	BaseHandler
+
+	// JobRunner is used to run jobs
+	JobRunner *jobs.JobRunner
+}
+
+// ServeHTTP implements http.Handler
+func (h AppsRollbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := h.JobRunner.Submit(jobs.JobTypeRollbackApps, nil)
+	if err != nil {
+		panic(fmt.Errorf("failed to submit rollback apps job: %s", err.Error()))
+	}
+
+	h.Logger.Infof("submitted rollback apps job %s", req.ID)
+
+	h.RespondJSON(w, http.StatusAccepted, map[string]string{
+		"job_id": req.ID,
+	})
+}
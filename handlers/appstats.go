@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// recordDeploy counts a deploy of an app in the app_stats collection. Failures are
+// logged instead of failing the request b/c the deploy itself succeeded.
+func (h BaseHandler) recordDeploy(mDbAppStats *mongo.Collection, appID string) {
+	upsertTrue := true
+
+	_, err := mDbAppStats.UpdateOne(h.Ctx, bson.D{{"app_id", appID}},
+		bson.D{
+			{"$inc", bson.D{{"deploys", 1}}},
+			{"$set", bson.D{{"last_deployed_at", time.Now()}}},
+		}, &options.UpdateOptions{
+			Upsert: &upsertTrue,
+		})
+	if err != nil {
+		h.Logger.Errorf("failed to record deploy of app with ID %s: %s",
+			appID, err.Error())
+	}
+}
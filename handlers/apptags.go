@@ -2,9 +2,7 @@ package handlers
 
 
 import (
-	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"net/http"
 	"strings"
 )
@@ -23,82 +21,40 @@ func (h AppTagsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	vars := r.URL.Query()
 	query := vars.Get("query")
 
-	result := getTagsFromDB(query, h)
+	// other search filters narrow the apps counted
+	searchQuery, err := getSearchQuery("", vars.Get("tags"), vars.Get("categories"),
+		vars.Get("verification_status"))
+	if err != nil {
+		h.RespondJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
 
-	resp := map[string][]string{
-		"tags":result,
+	result := getTagsFromDB(query, searchQuery, h)
+
+	resp := map[string]interface{}{
+		"tags":facetValues(result),
+		"counts":result,
 	}
 
 	h.RespondJSON(w, http.StatusOK, resp)
 }
 
 
-func getTagsFromDB(query string, h AppTagsHandler ) []string {
-
-	tagsBson := bson.D{}
+// getTagsFromDB counts the tags of apps which match a search. Like the tags facet
+// of a search, the search's own tags filter is not applied.
+func getTagsFromDB(query string, searchQuery appQuery, h AppTagsHandler) []FacetValue {
 
-	// if we have additional parametres, only get the tags of matched apps.
+	// if we have additional parametres, only count the tags of matched apps.
 	if len(query)>0{
 		query := strings.Split(query, ",")
-		tagsBson = append(tagsBson, bson.E{
-			"tags",
-			bson.D{{"$in", query}},
+		searchQuery.Filter = append(append(bson.D{}, searchQuery.Filter...), bson.E{
+			"tags", bson.D{{"$in", query}},
 		})
 	}
 
-	// Declaring structure to set projection in find. used to single out the column. for more info see *findoptions in mongo
-	type fields struct {
-		Tags int `bson:"tags"`
-	}
-
-	// Declaring structure to decode the output from the mongo tags search query
-	type tagsRes struct{
-		Tags []string `json:"tags" bson:"tags"`
-	}
-
-	// setting projection
-	projection := fields{
-		Tags: 1,
-	}
-
-	result, err := h.MDbApps.Find(h.Ctx, tagsBson, options.Find().SetProjection(projection) )
-	if err != nil {
-		panic(fmt.Errorf("unable to query database: %s", err.Error()))
-	}
-
-	// declaring return string
-	ret := []string{}
-
-	for result.Next(h.Ctx) {
-		a := tagsRes{}
-		if err = result.Decode(&a); err != nil {
-			panic(fmt.Errorf("Error in decode %s", err.Error()))
-		}
-		ret= append(ret, a.Tags...)
-
-	}
-
-	return removeDuplicates(ret)
-}
-
-
+	_, facets := h.getAppFacets(searchQuery)
 
-
-func removeDuplicates(elements []string) []string {
-	// Use map to record duplicates as we find them.
-	encountered := map[string]bool{}
-	result := []string{}
-
-	for v := range elements {
-		if encountered[elements[v]] == true {
-			// Do not add duplicate.
-		} else {
-			// Record this element as an encountered element.
-			encountered[elements[v]] = true
-			// Append to result slice.
-			result = append(result, elements[v])
-		}
-	}
-	// Return the new slice.
-	return result
+	return facets.Tags
 }
@@ -4,6 +4,7 @@ package handlers
 import (
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"strings"
 
 	"net/http"
@@ -15,6 +16,9 @@ import (
 // AppsDeployResourcesHandler returns JSON formatted Kubernetes resource manifests for the specified app
 type AppsDeployResourcesHandler struct {
 	BaseHandler
+
+	// MDbAppStats is the app_stats collection, deploys are counted in it
+	MDbAppStats *mongo.Collection
 }
 
 // ServeHTTP implements http.Handler
@@ -46,6 +50,8 @@ func (h AppsDeployResourcesHandler) ServeHTTP(w http.ResponseWriter, r *http.Req
 	}
 	ret = strings.Join(a.Deployment.Resources, "\n")
 
+	h.recordDeploy(h.MDbAppStats, a.AppID)
+
 	h.RespondTEXT(w, http.StatusOK, ret)
 }
 
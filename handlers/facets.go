@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// FacetValue is a value of a facet and the number of apps which have it
+type FacetValue struct {
+	// Value of app field
+	Value string `json:"value" bson:"_id"`
+
+	// Count is the number of apps with the value
+	Count int64 `json:"count" bson:"count"`
+}
+
+// AppFacets counts the values of app fields which can be filtered on. Values are
+// sorted by count, most common first.
+type AppFacets struct {
+	// Tags of apps
+	Tags []FacetValue `json:"tags" bson:"tags"`
+
+	// Categories of apps
+	Categories []FacetValue `json:"categories" bson:"categories"`
+
+	// Authors are the names of app authors
+	Authors []FacetValue `json:"authors" bson:"authors"`
+
+	// VerificationStatuses of apps
+	VerificationStatuses []FacetValue `json:"verification_statuses" bson:"verification_statuses"`
+}
+
+// facetValues returns the values of a facet
+func facetValues(facet []FacetValue) []string {
+	values := []string{}
+
+	for _, value := range facet {
+		values = append(values, value.Value)
+	}
+
+	return values
+}
+
+// countFacet returns the $facet pipeline which counts the values of an app field
+func countFacet(field string, isArray bool) bson.A {
+	pipeline := bson.A{}
+
+	if isArray {
+		// Each value is counted once per app, even if repeated in an app
+		pipeline = append(pipeline,
+			bson.D{{"$project", bson.D{{"value", bson.D{{"$setUnion", bson.A{
+				bson.D{{"$ifNull", bson.A{"$" + field, bson.A{}}}},
+				bson.A{},
+			}}}}}}},
+			bson.D{{"$unwind", "$value"}})
+	} else {
+		pipeline = append(pipeline,
+			bson.D{{"$project", bson.D{{"value", "$" + field}}}})
+	}
+
+	return append(pipeline,
+		bson.D{{"$match", bson.D{{"value", bson.D{{"$type", "string"}}}}}},
+		bson.D{{"$group", bson.D{
+			{"_id", "$value"},
+			{"count", bson.D{{"$sum", 1}}},
+		}}},
+		bson.D{{"$sort", bson.D{{"count", -1}, {"_id", 1}}}})
+}
+
+// appFacetsPipeline returns the aggregation pipeline which counts the apps which
+// match a query, and the values of their fields. Each field's values are counted
+// for the apps which match every filter except the query's filter on that field.
+func appFacetsPipeline(query appQuery) mongo.Pipeline {
+	// filtered prepends a match stage to a facet pipeline
+	filtered := func(filter bson.D, pipeline bson.A) bson.A {
+		return append(bson.A{bson.D{{"$match", filter}}}, pipeline...)
+	}
+
+	return mongo.Pipeline{
+		bson.D{{"$match", query.Filter}},
+		bson.D{{"$facet", bson.D{
+			{"total", filtered(query.FacetFilters,
+				bson.A{bson.D{{"$count", "count"}}})},
+			{"tags", filtered(query.facetFilter("tags"),
+				countFacet("tags", true))},
+			{"categories", filtered(query.facetFilter("categories"),
+				countFacet("categories", true))},
+			{"authors", filtered(query.facetFilter("author.name"),
+				countFacet("author.name", false))},
+			{"verification_statuses", filtered(
+				query.facetFilter("verification_status"),
+				countFacet("verification_status", false))},
+		}}},
+	}
+}
+
+// getAppFacets returns the number of apps which match a query, and counts of the
+// values of their fields, see appFacetsPipeline
+func (h BaseHandler) getAppFacets(query appQuery) (int64, AppFacets) {
+	cursor, err := h.MDbApps.Aggregate(h.Ctx, appFacetsPipeline(query))
+	if err != nil {
+		panic(fmt.Errorf("failed to count app facets in db: %s", err.Error()))
+	}
+	defer cursor.Close(h.Ctx)
+
+	var result struct {
+		AppFacets `bson:",inline"`
+
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+	}
+
+	if cursor.Next(h.Ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			panic(fmt.Errorf("failed to decode app facets: %s", err.Error()))
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		panic(fmt.Errorf("failed to iterate over app facets: %s", err.Error()))
+	}
+
+	facets := result.AppFacets
+
+	for _, facet := range []*[]FacetValue{&facets.Tags, &facets.Categories,
+		&facets.Authors, &facets.VerificationStatuses} {
+		if *facet == nil {
+			*facet = []FacetValue{}
+		}
+	}
+
+	total := int64(0)
+	if len(result.Total) > 0 {
+		total = result.Total[0].Count
+	}
+
+	return total, facets
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFacetValues(t *testing.T) {
+	assert.Equal(t, []string{"analytics", "ai"}, facetValues([]FacetValue{
+		FacetValue{Value: "analytics", Count: 12},
+		FacetValue{Value: "ai", Count: 3},
+	}))
+	assert.Equal(t, []string{}, facetValues(nil))
+}
+
+func TestCountFacet(t *testing.T) {
+	// Array values are unwound after removing repeats
+	pipeline := countFacet("tags", true)
+	assert.Len(t, pipeline, 5)
+	assert.Equal(t, bson.D{{"$unwind", "$value"}}, pipeline[1])
+
+	// Single values are counted directly
+	pipeline = countFacet("author.name", false)
+	assert.Len(t, pipeline, 4)
+	assert.Equal(t, bson.D{{"$project", bson.D{{"value", "$author.name"}}}},
+		pipeline[0])
+	assert.Equal(t, bson.D{{"$sort", bson.D{{"count", -1}, {"_id", 1}}}},
+		pipeline[3])
+}
+
+func TestAppFacetFilters(t *testing.T) {
+	query, err := getSearchQuery("hello", "ai,analytics", "tools", "good")
+	assert.NoError(t, err)
+
+	tagsFilter := bson.E{"tags", bson.D{{"$in", []string{"ai", "analytics"}}}}
+	categoriesFilter := bson.E{"categories", bson.D{{"$in", []string{"tools"}}}}
+	statusFilter := bson.E{"verification_status", bson.D{{"$in", []string{"good"}}}}
+
+	assert.Equal(t, bson.D{tagsFilter, categoriesFilter, statusFilter},
+		query.FacetFilters)
+
+	// Each facet is counted with every filter except its own
+	assert.Equal(t, bson.D{categoriesFilter, statusFilter}, query.facetFilter("tags"))
+	assert.Equal(t, bson.D{tagsFilter, statusFilter},
+		query.facetFilter("categories"))
+	assert.Equal(t, bson.D{tagsFilter, categoriesFilter},
+		query.facetFilter("verification_status"))
+	assert.Equal(t, bson.D{tagsFilter, categoriesFilter, statusFilter},
+		query.facetFilter("author.name"))
+
+	// Keywords filter every facet, listed apps match every filter
+	pipeline := appFacetsPipeline(query)
+	assert.Equal(t, bson.D{{"$match", query.Filter}}, pipeline[0])
+	assert.Equal(t, append(append(bson.D{}, query.Filter...), tagsFilter,
+		categoriesFilter, statusFilter), query.all())
+
+	facets := pipeline[1][0].Value.(bson.D)
+	for i, filter := range []bson.D{
+		query.FacetFilters,
+		query.facetFilter("tags"),
+		query.facetFilter("categories"),
+		query.facetFilter("author.name"),
+		query.facetFilter("verification_status"),
+	} {
+		assert.Equal(t, bson.D{{"$match", filter}},
+			facets[i].Value.(bson.A)[0], facets[i].Key)
+	}
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/kscout/serverless-registry-api/jobs"
+)
+
+// JobSchedulesHandler returns the last and next run times of job schedules
+type JobSchedulesHandler struct {
+	BaseHandler
+
+	// Scheduler runs job schedules
+	Scheduler *jobs.Scheduler
+}
+
+// ServeHTTP implements http.Handler
+func (h JobSchedulesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"schedules": h.Scheduler.Status(),
+	})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kscout/serverless-registry-api/jobs"
+
+	"github.com/gorilla/mux"
+)
+
+// JobsStatusHandler returns the statuses of recently submitted jobs
+type JobsStatusHandler struct {
+	BaseHandler
+
+	// JobRunner runs jobs
+	JobRunner *jobs.JobRunner
+}
+
+// ServeHTTP implements http.Handler
+func (h JobsStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"jobs": h.JobRunner.Statuses(),
+	})
+}
+
+// JobStatusByIDHandler returns the status of a single job
+type JobStatusByIDHandler struct {
+	BaseHandler
+
+	// JobRunner runs jobs
+	JobRunner *jobs.JobRunner
+}
+
+// ServeHTTP implements http.Handler
+func (h JobStatusByIDHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	status := h.JobRunner.Status(id)
+	if status == nil {
+		h.RespondJSON(w, http.StatusNotFound, map[string]string{
+			"error": "job not found",
+		})
+		return
+	}
+
+	h.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"job": status,
+	})
+}
+
+// JobCancelHandler cancels a queued or running job
+type JobCancelHandler struct {
+	BaseHandler
+
+	// JobRunner runs jobs
+	JobRunner *jobs.JobRunner
+}
+
+// ServeHTTP implements http.Handler
+func (h JobCancelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	if h.JobRunner.Status(id) == nil {
+		h.RespondJSON(w, http.StatusNotFound, map[string]string{
+			"error": "job not found",
+		})
+		return
+	}
+
+	if err := h.JobRunner.Cancel(id); err != nil {
+		h.RespondJSON(w, http.StatusConflict, map[string]string{
+			"error": fmt.Sprintf("failed to cancel job: %s", err.Error()),
+		})
+		return
+	}
+
+	h.Logger.Infof("canceled job %s", id)
+
+	h.RespondJSON(w, http.StatusOK, map[string]bool{
+		"ok": true,
+	})
+}
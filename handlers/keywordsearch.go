@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// keywordSearchField is an app field searched by keyword
+type keywordSearchField struct {
+	// Field is the name of the field in the apps collection
+	Field string
+
+	// IsArray indicates the field is a list of strings
+	IsArray bool
+
+	// Weight of a match in this field when ranking results
+	Weight int
+}
+
+// keywordSearchFields are the app fields searched by keyword. Matches in fields
+// which describe an app more directly are weighted higher.
+var keywordSearchFields = []keywordSearchField{
+	keywordSearchField{Field: "name", Weight: 8},
+	keywordSearchField{Field: "tags", IsArray: true, Weight: 4},
+	keywordSearchField{Field: "categories", IsArray: true, Weight: 4},
+	keywordSearchField{Field: "tagline", Weight: 3},
+	keywordSearchField{Field: "author.name", Weight: 2},
+	keywordSearchField{Field: "description", Weight: 1},
+}
+
+// maxKeywordSearchTerms is the largest number of terms a keyword search can have
+const maxKeywordSearchTerms = 10
+
+// keywordSearchGroups splits a keyword search query into groups of terms. Groups are
+// separated by commas, terms in a group by whitespace. Empty groups are removed.
+func keywordSearchGroups(query string) [][]string {
+	groups := [][]string{}
+
+	for _, group := range strings.Split(query, ",") {
+		if terms := strings.Fields(group); len(terms) > 0 {
+			groups = append(groups, terms)
+		}
+	}
+
+	return groups
+}
+
+// keywordTermRegex returns a case insensitive regular expression which matches
+// the start of a word with a term. The term is escaped so it is matched literally.
+func keywordTermRegex(term string) primitive.Regex {
+	return primitive.Regex{
+		Pattern: `(^|\W)` + regexp.QuoteMeta(term),
+		Options: "i",
+	}
+}
+
+// keywordSearch returns a filter which matches apps containing every term of any
+// group of a query in at least one of the keywordSearchFields, and an aggregation
+// expression which scores how well apps match. Errors are safe to show to the
+// client.
+func keywordSearch(query string) (bson.D, interface{}, error) {
+	groups := keywordSearchGroups(query)
+
+	numTerms := 0
+	for _, terms := range groups {
+		numTerms += len(terms)
+	}
+
+	if numTerms > maxKeywordSearchTerms {
+		return nil, nil, fmt.Errorf("query must have at most %d terms",
+			maxKeywordSearchTerms)
+	}
+
+	filter := bson.A{}
+	scores := bson.A{}
+
+	for _, terms := range groups {
+		groupFilter, groupScores := keywordGroupSearch(terms)
+
+		filter = append(filter, groupFilter)
+		scores = append(scores, groupScores...)
+	}
+
+	if len(groups) == 0 {
+		return bson.D{}, nil, nil
+	}
+
+	return bson.D{{"$or", filter}}, bson.D{{"$add", scores}}, nil
+}
+
+// keywordGroupSearch returns a filter which matches apps containing every term in
+// at least one of the keywordSearchFields, and aggregation expressions which score
+// the match of each term in each field
+func keywordGroupSearch(terms []string) (bson.D, bson.A) {
+	filter := bson.A{}
+	scores := bson.A{}
+
+	for _, term := range terms {
+		regex := keywordTermRegex(term)
+
+		termFilter := bson.A{}
+
+		for _, field := range keywordSearchFields {
+			termFilter = append(termFilter, bson.D{{field.Field, regex}})
+
+			// {{{1 Score
+			var matches bson.D
+			if field.IsArray {
+				matches = bson.D{{"$anyElementTrue", bson.A{bson.D{{"$map", bson.D{
+					{"input", bson.D{{"$ifNull", bson.A{"$" + field.Field, bson.A{}}}}},
+					{"as", "value"},
+					{"in", bson.D{{"$regexMatch", bson.D{
+						{"input", "$$value"},
+						{"regex", regex},
+					}}}},
+				}}}}}}
+			} else {
+				matches = bson.D{{"$regexMatch", bson.D{
+					{"input", bson.D{{"$ifNull", bson.A{"$" + field.Field, ""}}}},
+					{"regex", regex},
+				}}}
+			}
+
+			scores = append(scores, bson.D{{"$cond", bson.A{matches, field.Weight, 0}}})
+		}
+
+		filter = append(filter, bson.D{{"$or", termFilter}})
+	}
+
+	return bson.D{{"$and", filter}}, scores
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestKeywordSearchGroups(t *testing.T) {
+	assert.Equal(t, [][]string{{"node"}, {"hello", "world"}},
+		keywordSearchGroups(" node,hello\tworld, "))
+	assert.Equal(t, [][]string{}, keywordSearchGroups(" , "))
+}
+
+func TestKeywordTermRegex(t *testing.T) {
+	// Go and MongoDB regular expressions share the syntax used
+	matches := func(term, s string) bool {
+		regex := keywordTermRegex(term)
+		assert.Equal(t, "i", regex.Options)
+
+		return regexp.MustCompile("(?i)" + regex.Pattern).MatchString(s)
+	}
+
+	// Prefix of a word
+	assert.True(t, matches("hel", "Hello world"))
+	assert.True(t, matches("wor", "Hello world"))
+	assert.False(t, matches("llo", "Hello world"))
+
+	// Metacharacters are literal
+	assert.True(t, matches("c++", "Written in C++"))
+	assert.False(t, matches(".*", "Hello world"))
+	assert.True(t, matches("(beta", "Serverless (beta)"))
+}
+
+func TestKeywordSearch(t *testing.T) {
+	// No terms matches all apps
+	filter, relevance, err := keywordSearch("")
+	assert.NoError(t, err)
+	assert.Equal(t, bson.D{}, filter)
+	assert.Nil(t, relevance)
+
+	// Apps must match any group, each term of the group must match a field
+	filter, relevance, err = keywordSearch("node, hello world")
+	assert.NoError(t, err)
+
+	assert.Len(t, filter, 1)
+	assert.Equal(t, "$or", filter[0].Key)
+
+	groupFilters := filter[0].Value.(bson.A)
+	assert.Len(t, groupFilters, 2)
+
+	for i, terms := range [][]string{{"node"}, {"hello", "world"}} {
+		groupFilter := groupFilters[i].(bson.D)
+		assert.Equal(t, "$and", groupFilter[0].Key)
+
+		termFilters := groupFilter[0].Value.(bson.A)
+		assert.Len(t, termFilters, len(terms))
+
+		for j, term := range terms {
+			fieldFilters := termFilters[j].(bson.D)[0].Value.(bson.A)
+			assert.Len(t, fieldFilters, len(keywordSearchFields))
+
+			for k, field := range keywordSearchFields {
+				assert.Equal(t, bson.D{{field.Field, keywordTermRegex(term)}},
+					fieldFilters[k])
+			}
+		}
+	}
+
+	// Every term is scored in every field
+	scores := relevance.(bson.D)[0].Value.(bson.A)
+	assert.Len(t, scores, 3*len(keywordSearchFields))
+
+	// Too many terms
+	_, _, err = keywordSearch(strings.Repeat("a ", maxKeywordSearchTerms+1))
+	assert.Error(t, err)
+	_, _, err = keywordSearch(strings.Repeat("a,", maxKeywordSearchTerms+1))
+	assert.Error(t, err)
+}
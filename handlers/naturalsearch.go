@@ -1,18 +1,19 @@
 package handlers
 
 import (
-	"fmt"
-	"github.com/kscout/serverless-registry-api/models"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo"
 	"net/http"
-	"strings"
 )
 
 // NaturalSearchHandler is used search apps and return result
-// in case of an empty query, it returns all the apps in the database
+// in case of an empty query, it returns all the apps in the database.
+// Results are paginated and sorted, see parseAppListParams
 type NaturalSearchHandler struct {
 	BaseHandler
+
+	// MDbAppStats is the app_stats collection, used to sort by popularity
+	MDbAppStats *mongo.Collection
 }
 
 // ServeHTTP implements http.Handler
@@ -20,77 +21,50 @@ func (h NaturalSearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	// Gets all the optional parameters passed in the URL
 	vars := r.URL.Query()
 	query := vars.Get("query")
-	tags := vars.Get("tags")
-	categories := vars.Get("categories")
 
-	// else, construct a bson query will all the required parameters and find in database
-	searchBson := bson.D{}
-	if len(query) > 0 {
-		searchBson = append(searchBson, bson.E{
-			"$text",
-			bson.D{{"$search", query}},
-		})
-	}
-	if len(tags) > 0 {
-		tags := strings.Split(tags, ",")
-		searchBson = append(searchBson, bson.E{
-			"tags",
-			bson.D{{"$in", tags}},
-		})
-	}
-	if len(categories) > 0 {
-		categories := strings.Split(categories, ",")
-		searchBson = append(searchBson, bson.E{
-			"categories", bson.D{
-				{"$in", categories}},
+	params, err := parseAppListParams(vars, len(query) > 0)
+	if err != nil {
+		h.RespondJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
 		})
+		return
 	}
 
-	// struct to set projection in mongo
-	type fields struct {
-		Score bson.D `string:"score"`
-	}
+	searchQuery := getNaturalSearchQuery(query, vars.Get("tags"),
+		vars.Get("categories"), vars.Get("verification_status"))
 
-	projection := fields{
-		Score: bson.D{{
-			"$meta", "textScore",
-		}},
-	}
+	h.Logger.Debugf("searchBson=%#v, facetBson=%#v", searchQuery.Filter,
+		searchQuery.FacetFilters)
 
-	findOptions := options.Find()
-	findOptions.SetSort(projection)
-	findOptions.SetProjection(projection)
+	page := h.listApps(h.MDbAppStats, searchQuery, params)
 
-	apps := []models.App{} //to store all result as an array of json files
-	categsRes := []string{}
-	tagsRes := []string{}
+	h.respondAppList(w, r, params, page)
+}
 
-	h.Logger.Debugf("searchBson=%#v", searchBson)
+// getNaturalSearchQuery builds the query for apps which match the natural language
+// query. The tags, categories and verification statuses are facet filters, the
+// same as getSearchQuery.
+func getNaturalSearchQuery(query string, tags string, categories string,
+	verificationStatuses string) appQuery {
 
-	result, err := h.MDbApps.Find(h.Ctx, searchBson, findOptions)
+	// if the query is empty match all apps
+	// else, construct a text search query
+	searchBson := bson.D{}
 
-	if err != nil {
-		panic(fmt.Errorf("failed to retrieve data from db %s", err.Error()))
-	}
+	// Text search results are most relevant when their text score is highest
+	var relevance interface{}
 
-	for result.Next(h.Ctx) {
-		a := models.App{}
-		if err = result.Decode(&a); err != nil {
-			panic(fmt.Errorf("Unable to get apps from database: %s", err.Error()))
-		}
-		apps = append(apps, a)
-		categsRes = append(categsRes, a.Categories...)
-		tagsRes = append(tagsRes, a.Tags...)
+	if len(query) > 0 {
+		searchBson = append(searchBson, bson.E{
+			"$text",
+			bson.D{{"$search", query}},
+		})
+		relevance = bson.D{{"$meta", "textScore"}}
 	}
 
-	categsRes = removeDuplicates(categsRes)
-	tagsRes = removeDuplicates(tagsRes)
-
-	resp := map[string]interface{}{
-		"apps":       apps,
-		"categories": categsRes,
-		"tags":       tagsRes,
+	return appQuery{
+		Filter:       searchBson,
+		FacetFilters: searchFacetFilters(tags, categories, verificationStatuses),
+		Relevance:    relevance,
 	}
-
-	h.RespondJSON(w, http.StatusOK, resp)
 }
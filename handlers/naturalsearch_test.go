@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNaturalSearchQuery(t *testing.T) {
+	query := getNaturalSearchQuery("python app -flask", "ai", "tools", "good,unverified")
+
+	assert.Equal(t, bson.D{{"$text", bson.D{{"$search", "python app -flask"}}}},
+		query.Filter)
+	assert.Equal(t, bson.D{{"$meta", "textScore"}}, query.Relevance)
+
+	// Facets are filtered the same as keyword searches
+	assert.Equal(t, bson.D{
+		{"tags", bson.D{{"$in", []string{"ai"}}}},
+		{"categories", bson.D{{"$in", []string{"tools"}}}},
+		{"verification_status", bson.D{{"$in", []string{"good", "unverified"}}}},
+	}, query.FacetFilters)
+
+	keywordQuery, err := getSearchQuery("", "ai", "tools", "good,unverified")
+	assert.NoError(t, err)
+	assert.Equal(t, keywordQuery.FacetFilters, query.FacetFilters)
+
+	// No parameters match all apps
+	query = getNaturalSearchQuery("", "", "", "")
+	assert.Equal(t, bson.D{}, query.Filter)
+	assert.Equal(t, bson.D{}, query.FacetFilters)
+	assert.Nil(t, query.Relevance)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kscout/serverless-registry-api/models"
+	"github.com/kscout/serverless-registry-api/outbox"
+
+	"github.com/gorilla/mux"
+)
+
+// OutboxMessagesHandler lists outbox messages with a status. The status is
+// provided by the status query parameter, defaults to failed.
+type OutboxMessagesHandler struct {
+	BaseHandler
+
+	// Outbox delivers messages to external services
+	Outbox outbox.Outbox
+}
+
+// ServeHTTP implements http.Handler
+func (h OutboxMessagesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// {{{1 Get status
+	status := r.URL.Query().Get("status")
+	if len(status) == 0 {
+		status = models.OutboxStatusFailed
+	}
+
+	switch status {
+	case models.OutboxStatusHeld, models.OutboxStatusPending,
+		models.OutboxStatusDelivered, models.OutboxStatusFailed,
+		models.OutboxStatusDiscarded:
+	default:
+		h.RespondJSON(w, http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("invalid status: %s", status),
+		})
+		return
+	}
+
+	// {{{1 List
+	msgs, err := h.Outbox.List(h.Ctx, status)
+	if err != nil {
+		panic(fmt.Errorf("failed to list %s outbox messages: %s", status,
+			err.Error()))
+	}
+
+	h.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"messages": msgs,
+	})
+}
+
+// OutboxReplayHandler resets a failed or discarded outbox message so it will be
+// delivered again. Other messages are not replayed, delivered messages would be
+// sent twice and held messages would be sent before their change is committed.
+type OutboxReplayHandler struct {
+	BaseHandler
+
+	// Outbox delivers messages to external services
+	Outbox outbox.Outbox
+}
+
+// ServeHTTP implements http.Handler
+func (h OutboxReplayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	err := h.Outbox.Replay(h.Ctx, id)
+	if err == outbox.ErrMessageNotFound {
+		h.RespondJSON(w, http.StatusNotFound, map[string]string{
+			"error": "message not found",
+		})
+		return
+	} else if err == outbox.ErrMessageNotReplayable {
+		h.RespondJSON(w, http.StatusConflict, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	} else if err != nil {
+		panic(fmt.Errorf("failed to replay outbox message: %s", err.Error()))
+	}
+
+	h.Logger.Infof("replaying outbox message %s", id)
+
+	h.RespondJSON(w, http.StatusOK, map[string]bool{
+		"ok": true,
+	})
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// reviewerCtxKeyT is the type of reviewerCtxKey
+type reviewerCtxKeyT string
+
+// reviewerCtxKey is the request context key under which ReviewerAuthHandler stores
+// the name of the authenticated reviewer
+const reviewerCtxKey reviewerCtxKeyT = "reviewer"
+
+// ReviewerAuthHandler only allows requests which provide a reviewer token as a
+// bearer token in the Authorization header to reach Handler. The name of the
+// reviewer is available to Handler via getReviewer. Reviewer tokens are set by
+// config.Config.ReviewerTokens.
+type ReviewerAuthHandler struct {
+	BaseHandler
+
+	// Handler which requires authentication
+	Handler http.Handler
+}
+
+// ServeHTTP implements http.Handler
+func (h ReviewerAuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	reviewer := ""
+
+	if len(token) > 0 {
+		for name, reviewerToken := range h.Cfg.ReviewerTokens {
+			if len(reviewerToken) > 0 &&
+				subtle.ConstantTimeCompare([]byte(token), []byte(reviewerToken)) == 1 {
+				reviewer = name
+			}
+		}
+	}
+
+	if len(reviewer) == 0 {
+		h.RespondJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "unauthorized",
+		})
+		return
+	}
+
+	h.Handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(),
+		reviewerCtxKey, reviewer)))
+}
+
+// getReviewer returns the name of the reviewer authenticated by ReviewerAuthHandler
+func getReviewer(r *http.Request) string {
+	reviewer, _ := r.Context().Value(reviewerCtxKey).(string)
+	return reviewer
+}
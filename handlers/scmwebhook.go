@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/kscout/serverless-registry-api/jobs"
+	"github.com/kscout/serverless-registry-api/models"
+	"github.com/kscout/serverless-registry-api/scm"
+)
+
+// handleSCMEvent spawns actions for a delivery from a provider other than GitHub.
+// Merge requests are validated, and pushes to the registry branch update apps. The
+// IDs of jobs which are submitted are added to the delivery.
+func (h WebhookHandler) handleSCMEvent(w http.ResponseWriter,
+	delivery *models.WebhookDelivery) {
+
+	// {{{1 Parse
+	event, err := h.SCM.ParseWebhook(delivery.Event, []byte(delivery.Payload))
+	if err != nil {
+		panic(fmt.Errorf("failed to parse %s event: %s", delivery.Event, err.Error()))
+	}
+
+	h.Logger.Debugf("received %s event: %s", delivery.Event, delivery.Payload)
+
+	if len(event.Repository) > 0 && !h.Cfg.IsRegistryRepo(event.Repository) {
+		h.Logger.Debugf("ignored %s event for repository %s", delivery.Event,
+			event.Repository)
+
+		h.RespondJSON(w, http.StatusOK, map[string]bool{
+			"ok": true,
+		})
+		return
+	}
+
+	// {{{1 Handle event
+	switch event.Kind {
+	case scm.WebhookEventPing:
+		h.RespondJSON(w, http.StatusOK, map[string]bool{
+			"pong": true,
+		})
+		return
+	case scm.WebhookEventMergeRequest:
+		mr := event.MergeRequest
+
+		switch event.Action {
+		case scm.MergeRequestActionOpened, scm.MergeRequestActionUpdated:
+			// {{{2 Validate
+			h.Logger.Debugf("started validate job for merge request #%d",
+				mr.Number)
+
+			mrBytes, err := json.Marshal(mr)
+			if err != nil {
+				panic(fmt.Errorf("failed to marshal merge request into JSON: %s",
+					err.Error()))
+			}
+			if !h.submitJob(w, delivery, jobs.JobTypeValidate, mrBytes) {
+				return
+			}
+		case scm.MergeRequestActionClosed:
+			// Merged merge requests update apps when the merge is pushed to
+			// the registry branch
+
+			// {{{2 Remove submission and app previews
+			h.Logger.Debugf("merge request #%d was closed, submitted cleanup "+
+				"submission job", mr.Number)
+
+			cleanupBytes, err := json.Marshal(jobs.CleanupSubmissionJobDefinition{
+				PRNumber: mr.Number,
+			})
+			if err != nil {
+				panic(fmt.Errorf("failed to marshal "+
+					"CleanupSubmissionJobDefinition into JSON: %s",
+					err.Error()))
+			}
+			if !h.submitJob(w, delivery, jobs.JobTypeCleanupSubmission, cleanupBytes) {
+				return
+			}
+		}
+	case scm.WebhookEventPush:
+		// {{{2 Update apps if registry branch was pushed
+		if event.Deleted || event.Ref != "refs/heads/"+h.Cfg.GhRegistryRepoBranch {
+			break
+		}
+
+		h.Logger.Debugf("submitted update apps job, push to %s",
+			h.Cfg.GhRegistryRepoBranch)
+
+		if !h.submitJob(w, delivery, jobs.JobTypeUpdateApps, nil) {
+			return
+		}
+	default:
+		h.RespondJSON(w, http.StatusNotAcceptable, map[string]string{
+			"error": fmt.Sprintf("cannot handle event type: %s", delivery.Event),
+		})
+		return
+	}
+
+	h.RespondJSON(w, http.StatusOK, map[string]bool{
+		"ok": true,
+	})
+}
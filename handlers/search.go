@@ -2,18 +2,21 @@ package handlers
 
 
 import (
-	"fmt"
-	"github.com/kscout/serverless-registry-api/models"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"net/http"
 	"strings"
 )
 
 // AppSearchHandler is used search apps and return result
-// in case of an empty query, it returns all the apps in the database
+// in case of an empty query, it returns all the apps in the database.
+// Results are paginated and sorted, see parseAppListParams
 
 type AppSearchHandler struct {
 	BaseHandler
+
+	// MDbAppStats is the app_stats collection, used to sort by popularity
+	MDbAppStats *mongo.Collection
 }
 
 // ServeHTTP implements http.Handler
@@ -24,70 +27,75 @@ func (h AppSearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	query := vars.Get("query")
 	tags := vars.Get("tags")
 	categories := vars.Get("categories")
+	verificationStatuses := vars.Get("verification_status")
 
-	apps, categsRes, tagsRes := getSearchDataFromDB(query, tags, categories, h)
+	searchQuery, err := getSearchQuery(query, tags, categories, verificationStatuses)
+	if err != nil {
+		h.RespondJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
 
-	resp := map[string]interface{}{
-		"apps":apps,
-		"categories":categsRes,
-		"tags":tagsRes,
+	params, err := parseAppListParams(vars, searchQuery.Relevance != nil)
+	if err != nil {
+		h.RespondJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
 	}
 
+	page := h.listApps(h.MDbAppStats, searchQuery, params)
 
-	h.RespondJSON(w, http.StatusOK, resp)
+	h.respondAppList(w, r, params, page)
 }
 
 
-func getSearchDataFromDB(query string, tags string, categories string, h AppSearchHandler ) ([]models.App, []string, []string) {
+// getSearchQuery builds the query for apps which match the search parameters.
+// The query parameter is searched by keyword, see keywordSearch. The tags,
+// categories and verification statuses are facet filters.
+func getSearchQuery(query string, tags string, categories string, verificationStatuses string) (appQuery, error) {
 
-	// if query, tags or categories are empty strings return all apps as result
-	// else, construct a bson query will all the required parameters and find in database
-	searchBson := bson.D{}
-	if len(query)>0{
-		query := strings.ReplaceAll(query,",","|")
-		searchBson = append(searchBson, bson.E{
-			"description",
-				bson.D{{"$regex", "\\s*("+query+")"}, {"$options","i"}},
-		})
+	// if query, tags or categories are empty strings match all apps
+	// else, construct a bson query will all the required parameters
+	keywordBson, relevance, err := keywordSearch(query)
+	if err != nil {
+		return appQuery{}, err
 	}
+
+	return appQuery{
+		Filter: keywordBson,
+		FacetFilters: searchFacetFilters(tags, categories, verificationStatuses),
+		Relevance: relevance,
+	}, nil
+}
+
+// searchFacetFilters builds the facet filters for apps which have one of the tags,
+// categories and verification statuses. Each parameter is a comma separated list,
+// empty parameters match all apps.
+func searchFacetFilters(tags string, categories string, verificationStatuses string) bson.D {
+	facetBson := bson.D{}
 	if len(tags)>0{
 		tags := strings.Split(tags, ",")
-		searchBson = append(searchBson, bson.E{
+		facetBson = append(facetBson, bson.E{
 			"tags",
 				bson.D{{"$in", tags}},
 		})
 	}
 	if len(categories)>0{
 		categories := strings.Split(categories, ",")
-		searchBson = append(searchBson, bson.E{
+		facetBson = append(facetBson, bson.E{
 			"categories", bson.D{
 				{"$in", categories}},
 		})
 	}
-
-
-	ret := []models.App{}  //to store all result as an array of json files
-	categsRes := []string{}
-	tagsRes := []string{}
-	result, err := h.MDbApps.Find(h.Ctx, searchBson)
-
-	if err != nil {
-		 panic(fmt.Errorf("failed to retrieve data from db %s", err.Error()))
-
+	if len(verificationStatuses)>0{
+		verificationStatuses := strings.Split(verificationStatuses, ",")
+		facetBson = append(facetBson, bson.E{
+			"verification_status", bson.D{
+				{"$in", verificationStatuses}},
+		})
 	}
 
-	for result.Next(h.Ctx) {
-		a := models.App{}
-		if err = result.Decode(&a); err != nil {
-			panic(fmt.Errorf("Unable to get apps from database: %s", err.Error()))
-		}
-		ret = append(ret,a)
-		categsRes = append(categsRes, a.Categories...)
-		tagsRes = append(tagsRes, a.Tags...)
-
-
-
-
-	}
-	return ret, removeDuplicates(categsRes), removeDuplicates(tagsRes)
-}
\ No newline at end of file
+	return facetBson
+}
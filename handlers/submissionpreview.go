@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/kscout/serverless-registry-api/models"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// getSubmissionApp returns the app with the ID in the id URL variable from the
+// submission for the pull request number in the pr URL variable. If the app is not
+// found or failed to parse a response is sent and nil is returned.
+func getSubmissionApp(h BaseHandler, mDbSubmissions *mongo.Collection,
+	w http.ResponseWriter, r *http.Request) *models.App {
+
+	submission := getSubmission(h, mDbSubmissions, w, r)
+	if submission == nil {
+		return nil
+	}
+
+	submissionApp, ok := submission.Apps[mux.Vars(r)["id"]]
+	if !ok || submissionApp == nil || submissionApp.App == nil {
+		h.RespondJSON(w, http.StatusNotFound, map[string]string{
+			"error": "app not found in submission",
+		})
+		return nil
+	}
+
+	return submissionApp.App
+}
+
+// SubmissionAppHandler returns a preview of an app in a submission, as parsed at the
+// head of the pull request
+type SubmissionAppHandler struct {
+	BaseHandler
+
+	// MDbSubmissions is the submissions collection
+	MDbSubmissions *mongo.Collection
+}
+
+// ServeHTTP implements http.Handler
+func (h SubmissionAppHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	app := getSubmissionApp(h.BaseHandler, h.MDbSubmissions, w, r)
+	if app == nil {
+		return
+	}
+
+	h.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"app": app,
+	})
+}
+
+// SubmissionAppDeployHandler returns the Bash deployment script of an app in a
+// submission
+type SubmissionAppDeployHandler struct {
+	BaseHandler
+
+	// MDbSubmissions is the submissions collection
+	MDbSubmissions *mongo.Collection
+}
+
+// ServeHTTP implements http.Handler
+func (h SubmissionAppDeployHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	app := getSubmissionApp(h.BaseHandler, h.MDbSubmissions, w, r)
+	if app == nil {
+		return
+	}
+
+	h.RespondTEXT(w, http.StatusOK, app.Deployment.DeployScript)
+}
+
+// SubmissionAppDeployResourcesHandler returns the JSON formatted Kubernetes resource
+// manifests of an app in a submission
+type SubmissionAppDeployResourcesHandler struct {
+	BaseHandler
+
+	// MDbSubmissions is the submissions collection
+	MDbSubmissions *mongo.Collection
+}
+
+// ServeHTTP implements http.Handler
+func (h SubmissionAppDeployResourcesHandler) ServeHTTP(w http.ResponseWriter,
+	r *http.Request) {
+
+	app := getSubmissionApp(h.BaseHandler, h.MDbSubmissions, w, r)
+	if app == nil {
+		return
+	}
+
+	h.RespondTEXT(w, http.StatusOK, strings.Join(app.Deployment.Resources, "\n"))
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/kscout/serverless-registry-api/jobs"
+	"github.com/kscout/serverless-registry-api/models"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SubmissionsHandler lists submissions, newest validated first. Submissions can be
+// filtered by the status and registry query parameters.
+type SubmissionsHandler struct {
+	BaseHandler
+
+	// MDbSubmissions is the submissions collection
+	MDbSubmissions *mongo.Collection
+}
+
+// ServeHTTP implements http.Handler
+func (h SubmissionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// {{{1 Build query
+	filter := bson.D{}
+
+	if status := r.URL.Query().Get("status"); len(status) > 0 {
+		filter = append(filter, bson.E{"status", status})
+	}
+
+	if registry := r.URL.Query().Get("registry"); len(registry) > 0 {
+		if !h.Cfg.IsRegistryRepo(registry) {
+			h.RespondJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "registry is not a registry repository",
+			})
+			return
+		}
+
+		filter = append(filter, jobs.RegistryFilter(h.Cfg, registry))
+	}
+
+	// {{{1 Query
+	cursor, err := h.MDbSubmissions.Find(h.Ctx, filter,
+		options.Find().SetSort(bson.D{{"validated_at", -1}}))
+	if err != nil {
+		panic(fmt.Errorf("failed to query submissions: %s", err.Error()))
+	}
+	defer cursor.Close(h.Ctx)
+
+	submissions := []models.Submission{}
+
+	for cursor.Next(h.Ctx) {
+		var submission models.Submission
+		if err := cursor.Decode(&submission); err != nil {
+			panic(fmt.Errorf("failed to decode submission: %s", err.Error()))
+		}
+
+		submissions = append(submissions, submission)
+	}
+
+	if err := cursor.Err(); err != nil {
+		panic(fmt.Errorf("failed to iterate over submissions: %s", err.Error()))
+	}
+
+	h.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"submissions": submissions,
+	})
+}
+
+// SubmissionByPRHandler returns the submission for a pull request
+type SubmissionByPRHandler struct {
+	BaseHandler
+
+	// MDbSubmissions is the submissions collection
+	MDbSubmissions *mongo.Collection
+}
+
+// ServeHTTP implements http.Handler
+func (h SubmissionByPRHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	submission := getSubmission(h.BaseHandler, h.MDbSubmissions, w, r)
+	if submission == nil {
+		return
+	}
+
+	h.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"submission": submission,
+	})
+}
+
+// getSubmission returns the submission for the pull request number in the pr URL
+// variable. The pull request is in the registry repository named by the registry
+// query parameter, or the configured registry repository if not provided. If the
+// submission is not found a response is sent and nil is returned.
+func getSubmission(h BaseHandler, mDbSubmissions *mongo.Collection, w http.ResponseWriter,
+	r *http.Request) *models.Submission {
+
+	prNumber, err := strconv.Atoi(mux.Vars(r)["pr"])
+	if err != nil {
+		h.RespondJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "pull request number must be an integer",
+		})
+		return nil
+	}
+
+	registry := r.URL.Query().Get("registry")
+	if len(registry) == 0 {
+		registry = h.Cfg.RegistryRepos()[0]
+	} else if !h.Cfg.IsRegistryRepo(registry) {
+		h.RespondJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "registry is not a registry repository",
+		})
+		return nil
+	}
+
+	var submission models.Submission
+
+	err = mDbSubmissions.FindOne(h.Ctx, bson.D{
+		{"pr_number", prNumber},
+		jobs.RegistryFilter(h.Cfg, registry),
+	}).Decode(&submission)
+	if err == mongo.ErrNoDocuments {
+		h.RespondJSON(w, http.StatusNotFound, map[string]string{
+			"error": "submission not found",
+		})
+		return nil
+	} else if err != nil {
+		panic(fmt.Errorf("failed to get submission for PR #%d: %s", prNumber,
+			err.Error()))
+	}
+
+	return &submission
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kscout/serverless-registry-api/config"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubmissionRegistryValidation(t *testing.T) {
+	base := BaseHandler{
+		Logger: golog.NewStdLogger("submissions-test"),
+		Cfg: &config.Config{
+			GhRegistryRepoOwner: "kscout",
+			GhRegistryRepoName:  "serverless-apps",
+			GhRegistryRepos:     []string{"other-org/apps"},
+		},
+	}
+
+	// No collection is set, so the registry must be rejected before querying
+	for _, handler := range []http.Handler{
+		SubmissionsHandler{BaseHandler: base},
+		SubmissionByPRHandler{BaseHandler: base},
+	} {
+		req := httptest.NewRequest("GET", "/submissions/3?registry=other-org/other",
+			nil)
+		req = mux.SetURLVars(req, map[string]string{"pr": "3"})
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kscout/serverless-registry-api/verification"
+
+	"github.com/gorilla/mux"
+)
+
+// AppVerificationHandler returns the verification status of an app and the history
+// of its verification status transitions
+type AppVerificationHandler struct {
+	BaseHandler
+
+	// Verifier manages the verification statuses of apps
+	Verifier verification.Verifier
+}
+
+// ServeHTTP implements http.Handler
+func (h AppVerificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	appID := mux.Vars(r)["id"]
+
+	verif, err := h.Verifier.Get(h.Ctx, appID)
+	if err == verification.ErrAppNotFound {
+		h.RespondJSON(w, http.StatusNotFound, map[string]string{
+			"error": "app not found",
+		})
+		return
+	} else if err != nil {
+		panic(fmt.Errorf("failed to get verification status: %s", err.Error()))
+	}
+
+	history, err := h.Verifier.History(h.Ctx, appID)
+	if err != nil {
+		panic(fmt.Errorf("failed to get verification history: %s", err.Error()))
+	}
+
+	h.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"verification": verif,
+		"history":      history,
+	})
+}
+
+// AppVerificationTransitionHandler changes the verification status of an app on
+// behalf of the reviewer authenticated by ReviewerAuthHandler
+type AppVerificationTransitionHandler struct {
+	BaseHandler
+
+	// Verifier manages the verification statuses of apps
+	Verifier verification.Verifier
+}
+
+// AppVerificationTransitionReq is the request body of an
+// AppVerificationTransitionHandler request
+type AppVerificationTransitionReq struct {
+	// Status to transition to
+	Status string `json:"status"`
+
+	// Reason for the transition
+	Reason string `json:"reason"`
+}
+
+// ServeHTTP implements http.Handler
+func (h AppVerificationTransitionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// {{{1 Parse request
+	appID := mux.Vars(r)["id"]
+	reviewer := getReviewer(r)
+
+	var req AppVerificationTransitionReq
+	h.ParseJSON(r, &req)
+
+	if len(req.Reason) == 0 {
+		h.RespondJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "reason cannot be empty",
+		})
+		return
+	}
+
+	// {{{1 Transition
+	verif, err := h.Verifier.Transition(h.Ctx, appID, req.Status, req.Reason,
+		reviewer)
+	if transitionErr, ok := err.(verification.InvalidTransitionError); ok {
+		h.RespondJSON(w, http.StatusConflict, map[string]string{
+			"error": transitionErr.Error(),
+		})
+		return
+	} else if err == verification.ErrAppNotFound {
+		h.RespondJSON(w, http.StatusNotFound, map[string]string{
+			"error": "app not found",
+		})
+		return
+	} else if err != nil {
+		panic(fmt.Errorf("failed to transition verification status: %s",
+			err.Error()))
+	}
+
+	h.Logger.Infof("%s changed verification status of app %s to %s: %s",
+		reviewer, appID, verif.Status, verif.Reason)
+
+	h.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"verification": verif,
+	})
+}
@@ -4,74 +4,428 @@ import (
 	"fmt"
 	"net/http"
 	"encoding/json"
-	"crypto/hmac"
-	"crypto/sha1"
 	"io/ioutil"
-	"encoding/hex"
+	"strings"
+	"time"
 
+	"github.com/kscout/serverless-registry-api/ghapp"
 	"github.com/kscout/serverless-registry-api/jobs"
+	"github.com/kscout/serverless-registry-api/models"
+	"github.com/kscout/serverless-registry-api/parsing"
+	"github.com/kscout/serverless-registry-api/scm"
 	"github.com/google/go-github/v26/github"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// WebhookHandler handles GitHub App pull requests
+// webhookClaimTimeout is how long a delivery may be processing before it is assumed
+// the request handling it was abandoned, and it may be claimed again
+const webhookClaimTimeout = 10 * time.Minute
+
+// mongoDuplicateKeyCode is the MongoDB error code returned when inserting a document
+// whose unique key already exists
+const mongoDuplicateKeyCode = 11000
+
+// WebhookHandler handles webhook requests from the registry repository provider.
+// Each verified request is recorded. Deliveries are claimed before they are handled,
+// deliveries which were handled successfully or are being handled are ignored. GitHub events are handled with a client for the installation which sent
+// them, jobs are given the installation and repository of the event. Events for
+// repositories other than the registry repositories are ignored.
 type WebhookHandler struct {
 	BaseHandler
 
 	// JobRunner is used to run jobs
-	JobRunner *jobs.JobRunner
+	JobRunner JobSubmitter
+
+	// SCM verifies and parses webhook requests
+	SCM scm.Provider
+
+	// GhClients creates clients for the installation which sent each event
+	GhClients *ghapp.Clients
+
+	// MDbWebhookDeliveries is used to access the webhook_deliveries collection. If
+	// nil deliveries are not recorded.
+	MDbWebhookDeliveries *mongo.Collection
+
+	// MDbWebhookDeliveryClaims is used to access the webhook_delivery_claims
+	// collection. If nil repeated deliveries are not ignored.
+	MDbWebhookDeliveryClaims *mongo.Collection
+}
+
+// JobSubmitter submits jobs to be run, implemented by jobs.JobRunner
+type JobSubmitter interface {
+	// Submit a job, see jobs.JobRunner.Submit()
+	Submit(t jobs.JobTypeT, data []byte) (*jobs.JobStartRequest, error)
 }
 
-// ComputeGHWebhookSignature creates the expected X-Hub-Signature header value for a body.
-// WARNING: Compare the resulting signature with crypto/hmax.Equal for security purposes.
-func ComputeGHWebhookSignature(secret, body []byte) string {
-	bodyHMAC := hmac.New(sha1.New, secret)
-	bodyHMAC.Write(body)
+// responseRecorder records the status code and body of a response
+type responseRecorder struct {
+	http.ResponseWriter
 
-	return fmt.Sprintf("sha1=%s", hex.EncodeToString(bodyHMAC.Sum(nil)))
+	// status code of the response, 0 if not sent
+	status int
+
+	// body of the response
+	body []byte
 }
 
-// ServeHTTP implements net.Handler
-func (h WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// {{{1 Verify request came from GitHub
-	// {{{2 Get header value
-	hubSigHeader, ok := r.Header["X-Hub-Signature"]
-	if !ok || len(hubSigHeader) != 1 {
-		h.RespondJSON(w, http.StatusBadRequest, map[string]string{
-			"error": "X-Hub-Signature header must have a value",
-		})
-		return
-	}
+// WriteHeader implements http.ResponseWriter
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
 
-	expectedSig := hubSigHeader[0]
+// Write implements http.ResponseWriter
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body = append(r.body, b...)
+	return r.ResponseWriter.Write(b)
+}
 
-	// {{{2 Create HMAC of request
+// ServeHTTP implements net.Handler
+func (h WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// {{{1 Verify request came from provider
 	bodyBytes, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		panic(fmt.Errorf("failed to read request body: %s", err.Error()))
 	}
 
-	actualSig := ComputeGHWebhookSignature([]byte(h.Cfg.GhWebhookSecret), bodyBytes)
+	if err := h.SCM.VerifyWebhook(r, bodyBytes); err != nil {
+		if _, ok := err.(scm.HeaderMissingError); ok {
+			h.RespondJSON(w, http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
 
-	// {{{2 Compare
-	if !hmac.Equal([]byte(expectedSig), []byte(actualSig)) {
 		h.RespondJSON(w, http.StatusUnauthorized, map[string]string{
 			"error": "could not verify request",
 		})
 		return
 	}
 
-	// {{{1 Spawn action depending on event type
-	eventTypeHeader, ok := r.Header["X-Github-Event"]
-	if !ok || len(eventTypeHeader) != 1 {
+	if h.SCM.Name() == scm.ProviderGitHub &&
+		len(r.Header.Get("X-Hub-Signature-256")) == 0 {
+		h.Logger.Warnf("verified request with legacy SHA-1 signature")
+	}
+
+	// {{{1 Get event type
+	eventType, err := h.SCM.WebhookEventType(r)
+	if err != nil {
 		h.RespondJSON(w, http.StatusBadRequest, map[string]string{
-			"error": "X-Github-Event header must have a value",
+			"error": err.Error(),
 		})
 		return
 	}
-	
-	eventType := eventTypeHeader[0]
 
+	// {{{1 Handle
+	deliveryID := h.SCM.WebhookDeliveryID(r)
+	if len(deliveryID) == 0 {
+		deliveryID = uuid.New().String()
+	}
+
+	var actionBody struct {
+		Action string `json:"action"`
+	}
+	// Not all events are objects with an action
+	json.Unmarshal(bodyBytes, &actionBody)
+
+	delivery := &models.WebhookDelivery{
+		ID:         uuid.New().String(),
+		DeliveryID: deliveryID,
+		Event:      eventType,
+		Action:     actionBody.Action,
+		Payload:    string(bodyBytes),
+		JobIDs:     []string{},
+		ReceivedAt: time.Now(),
+	}
+
+	h.handleDelivery(w, delivery)
+}
+
+// handleDelivery claims a delivery, handles it and records it. Repeated deliveries
+// which are already claimed are ignored. Replays, which have ReplayOf set, are
+// rejected if the delivery is being handled.
+func (h WebhookHandler) handleDelivery(w http.ResponseWriter,
+	delivery *models.WebhookDelivery) {
+
+	replay := len(delivery.ReplayOf) > 0
+
+	// {{{1 Ignore repeated deliveries
+	if h.MDbWebhookDeliveryClaims != nil {
+		claimed, err := h.claimDelivery(delivery.DeliveryID, replay)
+		if err != nil {
+			panic(fmt.Errorf("failed to claim webhook delivery %s: %s",
+				delivery.DeliveryID, err.Error()))
+		}
+
+		if !claimed && replay {
+			h.RespondJSON(w, http.StatusConflict, map[string]string{
+				"error": "delivery is being handled",
+			})
+			return
+		} else if !claimed {
+			h.Logger.Debugf("ignored repeated delivery %s", delivery.DeliveryID)
+
+			h.RespondJSON(w, http.StatusOK, map[string]bool{
+				"ok":        true,
+				"duplicate": true,
+			})
+			return
+		}
+	}
+
+	// {{{1 Handle
+	recorder := &responseRecorder{
+		ResponseWriter: w,
+	}
+
+	// Record even if handling panics
+	defer func() {
+		if recorder.status == 0 {
+			recorder.status = http.StatusInternalServerError
+		}
+
+		h.releaseDelivery(delivery.DeliveryID, recorder.status)
+		h.saveDelivery(delivery, recorder)
+	}()
+
+	h.handleEvent(recorder, delivery)
+}
+
+// claimDelivery marks a delivery as being handled. Returns false if the delivery was
+// already handled successfully or is being handled by another request. Deliveries
+// which failed may be claimed again. Replays may also claim deliveries which were
+// handled successfully.
+func (h WebhookHandler) claimDelivery(deliveryID string, replay bool) (bool, error) {
+	now := time.Now()
+
+	// {{{1 Claim new delivery
+	_, err := h.MDbWebhookDeliveryClaims.InsertOne(h.Ctx, models.WebhookDeliveryClaim{
+		ID:        deliveryID,
+		Status:    models.WebhookDeliveryClaimProcessing,
+		ClaimedAt: now,
+	})
+	if err == nil {
+		return true, nil
+	} else if !isDuplicateKeyError(err) {
+		return false, fmt.Errorf("failed to insert claim: %s", err.Error())
+	}
+
+	// {{{1 Claim again if previous handling failed
+	res, err := h.MDbWebhookDeliveryClaims.UpdateOne(h.Ctx,
+		reclaimDeliveryFilter(deliveryID, now, replay), bson.D{{"$set", bson.D{
+			{"status", models.WebhookDeliveryClaimProcessing},
+			{"response_status", 0},
+			{"claimed_at", now},
+		}}})
+	if err != nil {
+		return false, fmt.Errorf("failed to update claim: %s", err.Error())
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
+// reclaimDeliveryFilter matches the claim of a delivery if it may be claimed again:
+// if handling failed, or if it has been processing for longer than
+// webhookClaimTimeout. Replays also match claims of deliveries which were handled.
+func reclaimDeliveryFilter(deliveryID string, now time.Time, replay bool) bson.D {
+	claimable := bson.A{
+		bson.D{{"status", models.WebhookDeliveryClaimFailed}},
+		bson.D{
+			{"status", models.WebhookDeliveryClaimProcessing},
+			{"claimed_at", bson.D{{"$lt", now.Add(-webhookClaimTimeout)}}},
+		},
+	}
+
+	if replay {
+		claimable = append(claimable,
+			bson.D{{"status", models.WebhookDeliveryClaimHandled}})
+	}
+
+	return bson.D{
+		{"_id", deliveryID},
+		{"$or", claimable},
+	}
+}
+
+// deliveryClaimStatus returns the status of a delivery's claim once it was handled
+// with a response status code
+func deliveryClaimStatus(responseStatus int) string {
+	if responseStatus >= 200 && responseStatus < 300 {
+		return models.WebhookDeliveryClaimHandled
+	}
+
+	return models.WebhookDeliveryClaimFailed
+}
+
+// isDuplicateKeyError returns true if err was caused by inserting a document whose
+// unique key already exists
+func isDuplicateKeyError(err error) bool {
+	writeErr, ok := err.(mongo.WriteException)
+	if !ok {
+		return false
+	}
+
+	for _, e := range writeErr.WriteErrors {
+		if e.Code == mongoDuplicateKeyCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// releaseDelivery records the result of handling a claimed delivery
+func (h WebhookHandler) releaseDelivery(deliveryID string, responseStatus int) {
+	if h.MDbWebhookDeliveryClaims == nil {
+		return
+	}
+
+	_, err := h.MDbWebhookDeliveryClaims.UpdateOne(h.Ctx, bson.D{{"_id", deliveryID}},
+		bson.D{{"$set", bson.D{
+			{"status", deliveryClaimStatus(responseStatus)},
+			{"response_status", responseStatus},
+		}}})
+	if err != nil {
+		h.Logger.Errorf("failed to release claim of webhook delivery %s: %s",
+			deliveryID, err.Error())
+	}
+}
+
+// saveDelivery records a delivery and its response
+func (h WebhookHandler) saveDelivery(delivery *models.WebhookDelivery,
+	recorder *responseRecorder) {
+
+	if h.MDbWebhookDeliveries == nil {
+		return
+	}
+
+	delivery.ResponseStatus = recorder.status
+	delivery.Response = string(recorder.body)
+
+	if _, err := h.MDbWebhookDeliveries.InsertOne(h.Ctx, delivery); err != nil {
+		h.Logger.Errorf("failed to record webhook delivery %s: %s", delivery.DeliveryID,
+			err.Error())
+	}
+}
+
+// handleEvent spawns actions depending on the event type of a delivery. The IDs of
+// jobs which are submitted are added to the delivery. Deliveries from providers
+// other than GitHub are handled by handleSCMEvent.
+func (h WebhookHandler) handleEvent(w http.ResponseWriter,
+	delivery *models.WebhookDelivery) {
+
+	if h.SCM.Name() != scm.ProviderGitHub {
+		h.handleSCMEvent(w, delivery)
+		return
+	}
+
+	eventType := delivery.Event
+	bodyBytes := []byte(delivery.Payload)
+
+	// {{{1 Route to installation
+	var routing struct {
+		Installation struct {
+			ID int64 `json:"id"`
+		} `json:"installation"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	// Not all events are objects with these fields
+	json.Unmarshal(bodyBytes, &routing)
+
+	// Installations may include repositories other than the registry repositories
+	if len(routing.Repository.FullName) > 0 &&
+		!h.Cfg.IsRegistryRepo(routing.Repository.FullName) {
+
+		h.Logger.Debugf("ignored %s event for repository %s", eventType,
+			routing.Repository.FullName)
+
+		h.RespondJSON(w, http.StatusOK, map[string]bool{
+			"ok": true,
+		})
+		return
+	}
+
+	// registry is the registry repository of the event, the zero value if the
+	// event is not for a repository
+	registry := jobs.NewRegistryRepo(routing.Installation.ID,
+		routing.Repository.FullName)
+
+	// gh is a client for the installation which sent the event
+	gh := h.Gh
+	if routing.Installation.ID != 0 && h.GhClients != nil {
+		installationGh, err := h.GhClients.Installation(routing.Installation.ID)
+		if err != nil {
+			panic(fmt.Errorf("failed to get client for installation %d: %s",
+				routing.Installation.ID, err.Error()))
+		}
+		gh = installationGh
+	}
+
+	// {{{1 Handle event
 	switch eventType {
+	case "installation":
+		// {{{2 Parse as InstallationEvent
+		var event github.InstallationEvent
+
+		if err := json.Unmarshal(bodyBytes, &event); err != nil {
+			panic(fmt.Errorf("failed to parse installation event body as JSON: %s",
+				err.Error()))
+		}
+
+		h.Logger.Debugf("received installation event: %s", bodyBytes)
+
+		// {{{2 Record installation
+		installation := models.Installation{
+			ID:           event.GetInstallation().GetID(),
+			Account:      event.GetInstallation().GetAccount().GetLogin(),
+			Repositories: ghapp.RepositoryNames(event.Repositories),
+		}
+
+		switch event.GetAction() {
+		case "created":
+			if err := h.GhClients.SaveInstallation(h.Ctx, installation); err != nil {
+				panic(err)
+			}
+
+			h.Logger.Infof("installed on %s", installation.Account)
+		case "deleted":
+			if err := h.GhClients.DeleteInstallation(h.Ctx, installation.ID); err != nil {
+				panic(err)
+			}
+
+			h.Logger.Infof("uninstalled from %s", installation.Account)
+		}
+	case "installation_repositories":
+		// {{{2 Parse as InstallationRepositoriesEvent
+		var event github.InstallationRepositoriesEvent
+
+		if err := json.Unmarshal(bodyBytes, &event); err != nil {
+			panic(fmt.Errorf("failed to parse installation repositories event "+
+				"body as JSON: %s", err.Error()))
+		}
+
+		h.Logger.Debugf("received installation repositories event: %s", bodyBytes)
+
+		// {{{2 Record repositories
+		installation := models.Installation{
+			ID:           event.GetInstallation().GetID(),
+			Account:      event.GetInstallation().GetAccount().GetLogin(),
+			Repositories: ghapp.RepositoryNames(event.RepositoriesAdded),
+		}
+
+		if err := h.GhClients.AddRepositories(h.Ctx, installation); err != nil {
+			panic(err)
+		}
+
+		err := h.GhClients.RemoveRepositories(h.Ctx, installation.ID,
+			ghapp.RepositoryNames(event.RepositoriesRemoved))
+		if err != nil {
+			panic(err)
+		}
 	case "ping":
 		h.RespondJSON(w, http.StatusOK, map[string]bool{
 			"pong": true,
@@ -88,10 +442,31 @@ func (h WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		h.Logger.Debugf("received pull request event: %s", bodyBytes)
 
-		// {{{2 Start job if PR was just opened or just merged
-		if *event.Action == "opened" {
-			h.Logger.Debugf("started validate job for PR #%d",
-				*event.PullRequest.Number)
+		// {{{2 Start jobs depending on action
+		// editedEvent holds the changes made by an edited action, go-github does
+		// not include base branch changes
+		var editedEvent struct {
+			Changes struct {
+				Base *json.RawMessage `json:"base"`
+			} `json:"changes"`
+		}
+
+		switch *event.Action {
+		case "edited":
+			if err := json.Unmarshal(bodyBytes, &editedEvent); err != nil {
+				panic(fmt.Errorf("failed to parse edited pull request event "+
+					"body as JSON: %s", err.Error()))
+			}
+
+			// Title and body changes do not affect validation
+			if editedEvent.Changes.Base == nil {
+				break
+			}
+
+			fallthrough
+		case "opened", "reopened", "synchronize":
+			h.Logger.Debugf("started validate job for PR #%d, action: %s",
+				*event.PullRequest.Number, *event.Action)
 			
 			// {{{3 Marshal PR back to bytes
 			prBytes, err := json.Marshal(*event.PullRequest)
@@ -99,12 +474,177 @@ func (h WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				panic(fmt.Errorf("failed to marshal PR into JSON: %s",
 					err.Error()))
 			}
-			h.JobRunner.Submit(jobs.JobTypeValidate, prBytes)
-		} else if *event.Action == "closed" && *event.PullRequest.Merged { 
-			h.Logger.Debugf("PR #%d was merged, submited update apps job",
+			if !h.submitJob(w, delivery, jobs.JobTypeValidate, prBytes) {
+				return
+			}
+		case "closed":
+			// Merged pull requests update apps when the merge is pushed to the
+			// registry branch
+
+			// {{{3 Remove submission and app previews
+			h.Logger.Debugf("PR #%d was closed, submitted cleanup submission job",
 				*event.PullRequest.Number)
-			
-			h.JobRunner.Submit(jobs.JobTypeUpdateApps, nil)
+
+			cleanupBytes, err := json.Marshal(jobs.CleanupSubmissionJobDefinition{
+				PRNumber: *event.PullRequest.Number,
+				Registry: registry,
+			})
+			if err != nil {
+				panic(fmt.Errorf("failed to marshal "+
+					"CleanupSubmissionJobDefinition into JSON: %s",
+					err.Error()))
+			}
+			if !h.submitJob(w, delivery, jobs.JobTypeCleanupSubmission, cleanupBytes) {
+				return
+			}
+		}
+	case "push":
+		// {{{2 Parse as PushEvent so we can tell which ref was pushed
+		var event github.PushEvent
+
+		if err := json.Unmarshal(bodyBytes, &event); err != nil {
+			panic(fmt.Errorf("failed to parse push event body as JSON: %s",
+				err.Error()))
+		}
+
+		h.Logger.Debugf("received push event: %s", bodyBytes)
+
+		if !h.Cfg.IsRegistryRepo(event.GetRepo().GetFullName()) || event.GetDeleted() {
+			break
+		}
+
+		// {{{2 Update apps if registry branch was pushed
+		if event.GetRef() == "refs/heads/"+h.Cfg.GhRegistryRepoBranch {
+			// Skip pushes which do not touch any apps, unless some commits are
+			// not in the event or history was rewritten
+			appIDs, complete := parsing.PushAppIDs(event)
+			if complete && !event.GetForced() && len(appIDs) == 0 {
+				h.Logger.Debugf("push to %s did not change any apps",
+					h.Cfg.GhRegistryRepoBranch)
+				break
+			}
+
+			h.Logger.Debugf("submitted update apps job, push to %s of %s "+
+				"changed apps: %v, forced: %t", h.Cfg.GhRegistryRepoBranch,
+				registry.FullName(), appIDs, event.GetForced())
+
+			if !h.submitJob(w, delivery, jobs.JobTypeUpdateApps,
+				eventJobData(string(jobs.JobTypeUpdateApps), registry)) {
+				return
+			}
+		} else if strings.HasPrefix(event.GetRef(), "refs/tags/") &&
+			len(h.Cfg.GhTagJobType) > 0 {
+			// {{{2 Run configured job if tag was pushed
+			h.Logger.Debugf("submitted %s job for tag %s", h.Cfg.GhTagJobType,
+				event.GetRef())
+
+			if !h.submitJob(w, delivery, jobs.JobTypeT(h.Cfg.GhTagJobType),
+				eventJobData(h.Cfg.GhTagJobType, registry)) {
+				return
+			}
+		}
+	case "release":
+		// {{{2 Parse as ReleaseEvent
+		var event github.ReleaseEvent
+
+		if err := json.Unmarshal(bodyBytes, &event); err != nil {
+			panic(fmt.Errorf("failed to parse release event body as JSON: %s",
+				err.Error()))
+		}
+
+		h.Logger.Debugf("received release event: %s", bodyBytes)
+
+		// {{{2 Run configured job if release was published
+		if !h.Cfg.IsRegistryRepo(event.GetRepo().GetFullName()) ||
+			event.GetAction() != "published" || len(h.Cfg.GhReleaseJobType) == 0 {
+			break
+		}
+
+		h.Logger.Debugf("submitted %s job for release %s", h.Cfg.GhReleaseJobType,
+			event.GetRelease().GetTagName())
+
+		if !h.submitJob(w, delivery, jobs.JobTypeT(h.Cfg.GhReleaseJobType),
+			eventJobData(h.Cfg.GhReleaseJobType, registry)) {
+			return
+		}
+	case "issue_comment":
+		// {{{2 Parse as IssueCommentEvent
+		var event github.IssueCommentEvent
+
+		if err := json.Unmarshal(bodyBytes, &event); err != nil {
+			panic(fmt.Errorf("failed to parse issue comment event body as JSON: %s",
+				err.Error()))
+		}
+
+		h.Logger.Debugf("received issue comment event: %s", bodyBytes)
+
+		// {{{2 Only handle new comments by users on pull requests
+		if event.GetAction() != "created" || !event.GetIssue().IsPullRequest() ||
+			event.GetComment().GetUser().GetType() == "Bot" {
+			break
+		}
+
+		// {{{2 Submit command job for each slash command
+		for _, cmd := range jobs.ParseSlashCommands(event.GetComment().GetBody()) {
+			cmdBytes, err := json.Marshal(jobs.CommandJobDefinition{
+				PRNumber:  event.GetIssue().GetNumber(),
+				Commenter: event.GetComment().GetUser().GetLogin(),
+				Command:   cmd,
+				Registry:  registry,
+			})
+			if err != nil {
+				panic(fmt.Errorf("failed to marshal command job definition "+
+					"into JSON: %s", err.Error()))
+			}
+
+			h.Logger.Debugf("submitted command job for %s command on PR #%d",
+				cmd.Name, event.GetIssue().GetNumber())
+
+			if !h.submitJob(w, delivery, jobs.JobTypeCommand, cmdBytes) {
+				return
+			}
+		}
+	case "check_run":
+		// {{{2 Parse as CheckRunEvent so we can tell which check was re-run
+		var event github.CheckRunEvent
+
+		if err := json.Unmarshal(bodyBytes, &event); err != nil {
+			panic(fmt.Errorf("failed to parse check run event body as JSON: %s",
+				err.Error()))
+		}
+
+		h.Logger.Debugf("received check run event: %s", bodyBytes)
+
+		// {{{2 Re-validate pull requests if validation check run was re-run
+		if event.GetAction() != "rerequested" ||
+			event.GetCheckRun().GetName() != jobs.ValidateCheckRunName {
+			break
+		}
+
+		for _, checkRunPR := range event.GetCheckRun().PullRequests {
+			// Check run events only include a summary of each PR
+			pr, _, err := gh.PullRequests.Get(h.Ctx, registry.Owner,
+				registry.Name, checkRunPR.GetNumber())
+			if err != nil {
+				panic(fmt.Errorf("failed to get PR #%d for re-requested check "+
+					"run: %s", checkRunPR.GetNumber(), err.Error()))
+			}
+
+			if pr.GetState() != "open" {
+				continue
+			}
+
+			h.Logger.Debugf("submitted validate job for PR #%d, check run "+
+				"re-requested", pr.GetNumber())
+
+			prBytes, err := json.Marshal(*pr)
+			if err != nil {
+				panic(fmt.Errorf("failed to marshal PR into JSON: %s",
+					err.Error()))
+			}
+			if !h.submitJob(w, delivery, jobs.JobTypeValidate, prBytes) {
+				return
+			}
 		}
 	case "check_suite":
 		// {{{2 Parse as CheckSuiteEvent so we can extract pull requests
@@ -117,6 +657,13 @@ func (h WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		h.Logger.Debugf("received check suite event: %s", bodyBytes)
 
+		// {{{2 Only re-validate if the check suite was re-run
+		// Check suites are requested and completed for each push, which the
+		// pull_request synchronize action already validates
+		if event.GetAction() != "rerequested" {
+			break
+		}
+
 		// {{{2 Start job for each pull request
 		checkSuite := *event.CheckSuite
 		prs := []*github.PullRequest{}
@@ -127,8 +674,8 @@ func (h WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		// {{{3 If no PRs in webhook then use head SHA
 		if len(prs) == 0 {
-			searchedPRs, _, err := h.Gh.PullRequests.ListPullRequestsWithCommit(h.Ctx,
-				h.Cfg.GhRegistryRepoOwner, h.Cfg.GhRegistryRepoName,
+			searchedPRs, _, err := gh.PullRequests.ListPullRequestsWithCommit(h.Ctx,
+				registry.Owner, registry.Name,
 				*checkSuite.HeadSHA, &github.PullRequestListOptions{
 					State: "open",
 				})
@@ -151,9 +698,8 @@ func (h WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					continue
 				}
 			} else { // Some PRs do not have a populated Merged field so we must get it
-				pr, _, err := h.Gh.PullRequests.Get(h.Ctx,
-					h.Cfg.GhRegistryRepoOwner, h.Cfg.GhRegistryRepoName,
-					*pr.Number)
+				pr, _, err := gh.PullRequests.Get(h.Ctx,
+					registry.Owner, registry.Name, *pr.Number)
 				if err != nil {
 					panic(fmt.Errorf("failed to get PR details to see if "+
 						"already merged for PR #%d: %s", *pr.Number,
@@ -173,7 +719,9 @@ func (h WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				panic(fmt.Errorf("failed to marshal PR into JSON: %s",
 					err.Error()))
 			}
-			h.JobRunner.Submit(jobs.JobTypeValidate, prBytes)
+			if !h.submitJob(w, delivery, jobs.JobTypeValidate, prBytes) {
+				return
+			}
 		}
 	default:
 		h.RespondJSON(w, http.StatusNotAcceptable, map[string]string{
@@ -186,3 +734,42 @@ func (h WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"ok": true,
 	})
 }
+
+// eventJobData returns the data of a job submitted due to an event in a registry
+// repository. Update apps jobs are given the registry repository, other event job
+// types accept no data.
+func eventJobData(jobType string, registry jobs.RegistryRepo) []byte {
+	if jobs.JobTypeT(jobType) != jobs.JobTypeUpdateApps {
+		return nil
+	}
+
+	data, err := json.Marshal(jobs.UpdateAppsJobDefinition{
+		Registry: registry,
+	})
+	if err != nil {
+		panic(fmt.Errorf("failed to marshal UpdateAppsJobDefinition into JSON: %s",
+			err.Error()))
+	}
+
+	return data
+}
+
+// submitJob submits a job and adds its ID to the delivery. If the job runner rejects
+// the job a response is sent and false is returned.
+func (h WebhookHandler) submitJob(w http.ResponseWriter, delivery *models.WebhookDelivery,
+	t jobs.JobTypeT, data []byte) bool {
+
+	req, err := h.JobRunner.Submit(t, data)
+	if err != nil {
+		h.Logger.Errorf("failed to submit %s job: %s", t, err.Error())
+
+		h.RespondJSON(w, http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("failed to submit %s job: %s", t, err.Error()),
+		})
+		return false
+	}
+
+	delivery.JobIDs = append(delivery.JobIDs, req.ID)
+
+	return true
+}
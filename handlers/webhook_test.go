@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kscout/serverless-registry-api/config"
+	"github.com/kscout/serverless-registry-api/jobs"
+	"github.com/kscout/serverless-registry-api/models"
+	"github.com/kscout/serverless-registry-api/scm"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// webhookTestBody is the body of test webhook requests
+var webhookTestBody = []byte(`{"zen": "Keep it logically awesome."}`)
+
+// serveTestWebhook makes a ping webhook request with headers and returns the
+// response status code
+func serveTestWebhook(cfg *config.Config, headers map[string]string) int {
+	return serveTestWebhookEvent(cfg, "ping", webhookTestBody, headers)
+}
+
+// serveTestWebhookEvent makes a GitHub webhook request and returns the response
+// status code
+func serveTestWebhookEvent(cfg *config.Config, event string, body []byte,
+	headers map[string]string) int {
+
+	return serveTestProviderWebhook(cfg, scm.GitHub{Cfg: cfg}, body,
+		mergeHeaders(map[string]string{"X-Github-Event": event}, headers))
+}
+
+// mergeHeaders returns a map with the keys of both maps, b's values take precedence
+func mergeHeaders(a, b map[string]string) map[string]string {
+	merged := map[string]string{}
+
+	for _, headers := range []map[string]string{a, b} {
+		for key, value := range headers {
+			merged[key] = value
+		}
+	}
+
+	return merged
+}
+
+// serveTestProviderWebhook makes a webhook request from a provider and returns the
+// response status code
+func serveTestProviderWebhook(cfg *config.Config, provider scm.Provider, body []byte,
+	headers map[string]string) int {
+
+	return serveTestHandlerWebhook(WebhookHandler{
+		BaseHandler: BaseHandler{
+			Logger: golog.NewStdLogger("webhook-test"),
+			Cfg:    cfg,
+		},
+		SCM: provider,
+	}, body, headers)
+}
+
+// serveTestHandlerWebhook makes a webhook request to a handler and returns the
+// response status code
+func serveTestHandlerWebhook(handler WebhookHandler, body []byte,
+	headers map[string]string) int {
+
+	req := httptest.NewRequest("POST", "/apps/webhook", bytes.NewReader(body))
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	return recorder.Code
+}
+
+// testJobSubmitter records the types of submitted jobs instead of running them
+type testJobSubmitter struct {
+	// submitted job types, oldest first
+	submitted []jobs.JobTypeT
+}
+
+// Submit implements JobSubmitter
+func (s *testJobSubmitter) Submit(t jobs.JobTypeT,
+	data []byte) (*jobs.JobStartRequest, error) {
+
+	s.submitted = append(s.submitted, t)
+
+	return &jobs.JobStartRequest{
+		ID:   fmt.Sprintf("job-%d", len(s.submitted)),
+		Type: t,
+		Data: data,
+	}, nil
+}
+
+func TestWebhookSignatureSHA256(t *testing.T) {
+	cfg := &config.Config{
+		GhWebhookSecret: "current",
+	}
+
+	assert.Equal(t, http.StatusOK, serveTestWebhook(cfg, map[string]string{
+		"X-Hub-Signature-256": scm.ComputeGHWebhookSignature256([]byte("current"),
+			webhookTestBody),
+	}))
+
+	assert.Equal(t, http.StatusUnauthorized, serveTestWebhook(cfg, map[string]string{
+		"X-Hub-Signature-256": scm.ComputeGHWebhookSignature256([]byte("wrong"),
+			webhookTestBody),
+	}))
+}
+
+func TestWebhookSignaturePreviousSecrets(t *testing.T) {
+	cfg := &config.Config{
+		GhWebhookSecret:          "current",
+		GhWebhookPreviousSecrets: []string{"old", "older"},
+	}
+
+	for _, secret := range []string{"current", "old", "older"} {
+		assert.Equal(t, http.StatusOK, serveTestWebhook(cfg, map[string]string{
+			"X-Hub-Signature-256": scm.ComputeGHWebhookSignature256([]byte(secret),
+				webhookTestBody),
+		}), "secret %s should be accepted", secret)
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serveTestWebhook(cfg, map[string]string{
+		"X-Hub-Signature-256": scm.ComputeGHWebhookSignature256([]byte("retired"),
+			webhookTestBody),
+	}))
+}
+
+func TestWebhookSignatureSHA1Fallback(t *testing.T) {
+	sha1Headers := map[string]string{
+		"X-Hub-Signature": scm.ComputeGHWebhookSignature([]byte("current"),
+			webhookTestBody),
+	}
+
+	// Not allowed by default
+	cfg := &config.Config{
+		GhWebhookSecret: "current",
+	}
+
+	assert.Equal(t, http.StatusBadRequest, serveTestWebhook(cfg, sha1Headers))
+
+	// Allowed
+	cfg.GhWebhookAllowSHA1 = true
+
+	assert.Equal(t, http.StatusOK, serveTestWebhook(cfg, sha1Headers))
+
+	// SHA-256 is checked first, even if the SHA-1 signature is valid
+	assert.Equal(t, http.StatusUnauthorized, serveTestWebhook(cfg, map[string]string{
+		"X-Hub-Signature": scm.ComputeGHWebhookSignature([]byte("current"),
+			webhookTestBody),
+		"X-Hub-Signature-256": scm.ComputeGHWebhookSignature256([]byte("wrong"),
+			webhookTestBody),
+	}))
+}
+
+func TestWebhookSignatureMissing(t *testing.T) {
+	cfg := &config.Config{
+		GhWebhookSecret:    "current",
+		GhWebhookAllowSHA1: true,
+	}
+
+	assert.Equal(t, http.StatusBadRequest, serveTestWebhook(cfg, map[string]string{}))
+}
+
+func TestWebhookPushIgnored(t *testing.T) {
+	cfg := &config.Config{
+		GhWebhookSecret:      "current",
+		GhRegistryRepoOwner:  "kscout",
+		GhRegistryRepoName:   "serverless-apps",
+		GhRegistryRepoBranch: "master",
+	}
+
+	// No job runner is set, so these pushes must not submit jobs
+	for _, body := range []string{
+		// Other branch
+		`{"ref": "refs/heads/feature", "size": 1, "repository": {"full_name": "kscout/serverless-apps"}, "commits": [{"modified": ["hello-world/README.md"]}]}`,
+		// No apps touched
+		`{"ref": "refs/heads/master", "size": 1, "repository": {"full_name": "kscout/serverless-apps"}, "commits": [{"modified": ["README.md"]}]}`,
+		// Other repository
+		`{"ref": "refs/heads/master", "size": 1, "repository": {"full_name": "kscout/other"}, "commits": [{"modified": ["hello-world/README.md"]}]}`,
+		// Tag without configured job
+		`{"ref": "refs/tags/v1.0.0", "size": 0, "repository": {"full_name": "kscout/serverless-apps"}}`,
+	} {
+		assert.Equal(t, http.StatusOK, serveTestWebhookEvent(cfg, "push", []byte(body),
+			map[string]string{
+				"X-Hub-Signature-256": scm.ComputeGHWebhookSignature256(
+					[]byte("current"), []byte(body)),
+			}), "push should be ignored: %s", body)
+	}
+}
+
+func TestWebhookGitLab(t *testing.T) {
+	cfg := &config.Config{
+		RegistryWebhookSecret: "current",
+		GhRegistryRepoOwner:   "kscout",
+		GhRegistryRepoName:    "serverless-apps",
+		GhRegistryRepoBranch:  "master",
+	}
+	provider := scm.NewGitLab(cfg)
+
+	// Push to other branch, ignored since no job runner is set
+	body := []byte(`{"object_kind": "push", "ref": "refs/heads/feature", "after": "abc", "project": {"path_with_namespace": "kscout/serverless-apps"}}`)
+
+	assert.Equal(t, http.StatusOK, serveTestProviderWebhook(cfg, provider, body,
+		map[string]string{
+			"X-Gitlab-Event": "Push Hook",
+			"X-Gitlab-Token": "current",
+		}))
+
+	assert.Equal(t, http.StatusUnauthorized, serveTestProviderWebhook(cfg, provider,
+		body, map[string]string{
+			"X-Gitlab-Event": "Push Hook",
+			"X-Gitlab-Token": "wrong",
+		}))
+
+	assert.Equal(t, http.StatusBadRequest, serveTestProviderWebhook(cfg, provider,
+		body, map[string]string{
+			"X-Gitlab-Event": "Push Hook",
+		}))
+}
+
+func TestWebhookGitea(t *testing.T) {
+	cfg := &config.Config{
+		RegistryWebhookSecret: "current",
+		GhRegistryRepoOwner:   "kscout",
+		GhRegistryRepoName:    "serverless-apps",
+		GhRegistryRepoBranch:  "master",
+	}
+	provider := scm.NewGitea(cfg)
+
+	// Push to other repository, ignored since no job runner is set
+	body := []byte(`{"ref": "refs/heads/master", "after": "abc", "repository": {"full_name": "kscout/other"}}`)
+
+	assert.Equal(t, http.StatusOK, serveTestProviderWebhook(cfg, provider, body,
+		map[string]string{
+			"X-Gitea-Event": "push",
+			"X-Gitea-Signature": scm.ComputeGiteaWebhookSignature(
+				[]byte("current"), body),
+		}))
+
+	assert.Equal(t, http.StatusUnauthorized, serveTestProviderWebhook(cfg, provider,
+		body, map[string]string{
+			"X-Gitea-Event": "push",
+			"X-Gitea-Signature": scm.ComputeGiteaWebhookSignature(
+				[]byte("wrong"), body),
+		}))
+}
+
+func TestDeliveryClaimStatus(t *testing.T) {
+	assert.Equal(t, models.WebhookDeliveryClaimHandled, deliveryClaimStatus(200))
+	assert.Equal(t, models.WebhookDeliveryClaimHandled, deliveryClaimStatus(204))
+
+	// Rejected and failed deliveries are handled again if sent again
+	assert.Equal(t, models.WebhookDeliveryClaimFailed, deliveryClaimStatus(400))
+	assert.Equal(t, models.WebhookDeliveryClaimFailed, deliveryClaimStatus(500))
+}
+
+func TestReclaimDeliveryFilter(t *testing.T) {
+	now := time.Now()
+
+	failed := bson.D{{"status", models.WebhookDeliveryClaimFailed}}
+	abandoned := bson.D{
+		{"status", models.WebhookDeliveryClaimProcessing},
+		{"claimed_at", bson.D{{"$lt", now.Add(-webhookClaimTimeout)}}},
+	}
+
+	// Only failed claims and abandoned processing claims match, handled claims
+	// and claims being processed do not
+	assert.Equal(t, bson.D{
+		{"_id", "delivery"},
+		{"$or", bson.A{failed, abandoned}},
+	}, reclaimDeliveryFilter("delivery", now, false))
+
+	// Replays may also claim handled deliveries, but not ones being processed
+	assert.Equal(t, bson.D{
+		{"_id", "delivery"},
+		{"$or", bson.A{failed, abandoned,
+			bson.D{{"status", models.WebhookDeliveryClaimHandled}}}},
+	}, reclaimDeliveryFilter("delivery", now, true))
+}
+
+func TestIsDuplicateKeyError(t *testing.T) {
+	assert.True(t, isDuplicateKeyError(mongo.WriteException{
+		WriteErrors: mongo.WriteErrors{
+			mongo.WriteError{Code: mongoDuplicateKeyCode},
+		},
+	}))
+	assert.False(t, isDuplicateKeyError(mongo.WriteException{
+		WriteErrors: mongo.WriteErrors{
+			mongo.WriteError{Code: 2},
+		},
+	}))
+	assert.False(t, isDuplicateKeyError(errors.New("connection refused")))
+}
+
+func TestEventJobData(t *testing.T) {
+	registry := jobs.NewRegistryRepo(42, "other-org/apps")
+
+	// Update apps jobs act on the registry repository of the event
+	var jobDef jobs.UpdateAppsJobDefinition
+	assert.NoError(t, json.Unmarshal(eventJobData("update_apps", registry), &jobDef))
+	assert.Equal(t, registry, jobDef.Registry)
+
+	assert.Nil(t, eventJobData("stale_pr_sweep", registry))
+}
+
+func TestWebhookPushValidatesOnce(t *testing.T) {
+	cfg := &config.Config{
+		GhWebhookSecret:      "current",
+		GhRegistryRepoOwner:  "kscout",
+		GhRegistryRepoName:   "serverless-apps",
+		GhRegistryRepoBranch: "master",
+	}
+	submitter := &testJobSubmitter{}
+	handler := WebhookHandler{
+		BaseHandler: BaseHandler{
+			Logger: golog.NewStdLogger("webhook-test"),
+			Cfg:    cfg,
+		},
+		JobRunner: submitter,
+		SCM:       scm.GitHub{Cfg: cfg},
+	}
+
+	serve := func(event, body string) {
+		assert.Equal(t, http.StatusOK, serveTestHandlerWebhook(handler, []byte(body),
+			map[string]string{
+				"X-Github-Event": event,
+				"X-Hub-Signature-256": scm.ComputeGHWebhookSignature256(
+					[]byte("current"), []byte(body)),
+			}), "%s event should be handled: %s", event, body)
+	}
+
+	// A push to a pull request sends all of these events
+	serve("pull_request", `{"action": "synchronize", "number": 7, "pull_request": {"number": 7, "head": {"sha": "def"}}, "repository": {"full_name": "kscout/serverless-apps"}}`)
+	serve("check_suite", `{"action": "requested", "check_suite": {"head_sha": "def", "pull_requests": [{"number": 7}]}, "repository": {"full_name": "kscout/serverless-apps"}}`)
+	serve("check_suite", `{"action": "completed", "check_suite": {"head_sha": "def", "pull_requests": [{"number": 7}]}, "repository": {"full_name": "kscout/serverless-apps"}}`)
+
+	assert.Equal(t, []jobs.JobTypeT{jobs.JobTypeValidate}, submitter.submitted)
+
+	// Re-running the check suite validates again
+	serve("check_suite", `{"action": "rerequested", "check_suite": {"head_sha": "def", "pull_requests": [{"number": 7, "merged": false}]}, "repository": {"full_name": "kscout/serverless-apps"}}`)
+
+	assert.Equal(t, []jobs.JobTypeT{jobs.JobTypeValidate, jobs.JobTypeValidate},
+		submitter.submitted)
+}
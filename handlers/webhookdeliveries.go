@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kscout/serverless-registry-api/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultWebhookDeliveriesLimit is the number of webhook deliveries listed if no
+// limit is provided
+const defaultWebhookDeliveriesLimit = 50
+
+// WebhookDeliveriesHandler lists recorded webhook deliveries, newest first. The
+// event query parameter filters by event type. The limit query parameter sets the
+// maximum number of deliveries returned.
+type WebhookDeliveriesHandler struct {
+	BaseHandler
+
+	// MDbWebhookDeliveries is used to access the webhook_deliveries collection
+	MDbWebhookDeliveries *mongo.Collection
+}
+
+// ServeHTTP implements http.Handler
+func (h WebhookDeliveriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// {{{1 Parse query
+	filter := bson.D{}
+
+	if event := r.URL.Query().Get("event"); len(event) > 0 {
+		filter = append(filter, bson.E{"event", event})
+	}
+
+	limit := int64(defaultWebhookDeliveriesLimit)
+
+	if limitStr := r.URL.Query().Get("limit"); len(limitStr) > 0 {
+		parsed, err := strconv.ParseInt(limitStr, 10, 64)
+		if err != nil || parsed < 1 {
+			h.RespondJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "limit must be a positive integer",
+			})
+			return
+		}
+
+		limit = parsed
+	}
+
+	// {{{1 Query
+	cursor, err := h.MDbWebhookDeliveries.Find(h.Ctx, filter, options.Find().
+		SetSort(bson.D{{"received_at", -1}}).
+		SetLimit(limit))
+	if err != nil {
+		panic(fmt.Errorf("failed to query webhook deliveries: %s", err.Error()))
+	}
+	defer cursor.Close(h.Ctx)
+
+	deliveries := []models.WebhookDelivery{}
+
+	for cursor.Next(h.Ctx) {
+		var delivery models.WebhookDelivery
+		if err := cursor.Decode(&delivery); err != nil {
+			panic(fmt.Errorf("failed to decode webhook delivery: %s", err.Error()))
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := cursor.Err(); err != nil {
+		panic(fmt.Errorf("failed to iterate over webhook deliveries: %s",
+			err.Error()))
+	}
+
+	h.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"deliveries": deliveries,
+	})
+}
+
+// WebhookDeliveryReplayHandler handles a recorded webhook delivery again. The
+// delivery is claimed and recorded the same as a webhook request, the record's
+// ReplayOf field is the ID of the replayed record. The response is the response of
+// the webhook handler, or a conflict if the delivery is being handled.
+type WebhookDeliveryReplayHandler struct {
+	BaseHandler
+
+	// Webhook handles the delivery
+	Webhook WebhookHandler
+
+	// MDbWebhookDeliveries is used to access the webhook_deliveries collection
+	MDbWebhookDeliveries *mongo.Collection
+}
+
+// ServeHTTP implements http.Handler
+func (h WebhookDeliveryReplayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var delivery models.WebhookDelivery
+
+	err := h.MDbWebhookDeliveries.FindOne(h.Ctx, bson.D{{"_id", id}}).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		h.RespondJSON(w, http.StatusNotFound, map[string]string{
+			"error": "delivery not found",
+		})
+		return
+	} else if err != nil {
+		panic(fmt.Errorf("failed to get webhook delivery %s: %s", id, err.Error()))
+	}
+
+	h.Logger.Infof("replaying %s webhook delivery %s", delivery.Event, id)
+
+	h.Webhook.handleDelivery(w, newReplayDelivery(delivery))
+}
+
+// newReplayDelivery returns a new record for a replay of a recorded delivery
+func newReplayDelivery(delivery models.WebhookDelivery) *models.WebhookDelivery {
+	return &models.WebhookDelivery{
+		ID:         uuid.New().String(),
+		DeliveryID: delivery.DeliveryID,
+		Event:      delivery.Event,
+		Action:     delivery.Action,
+		Payload:    delivery.Payload,
+		JobIDs:     []string{},
+		ReplayOf:   delivery.ID,
+		ReceivedAt: time.Now(),
+	}
+}
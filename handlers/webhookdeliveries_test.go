@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kscout/serverless-registry-api/config"
+	"github.com/kscout/serverless-registry-api/jobs"
+	"github.com/kscout/serverless-registry-api/models"
+	"github.com/kscout/serverless-registry-api/scm"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewReplayDelivery(t *testing.T) {
+	original := models.WebhookDelivery{
+		ID:             "record",
+		DeliveryID:     "delivery",
+		Event:          "pull_request",
+		Action:         "opened",
+		Payload:        `{"action": "opened"}`,
+		JobIDs:         []string{"job"},
+		ResponseStatus: http.StatusOK,
+		Response:       `{"ok": true}`,
+		ReceivedAt:     time.Unix(0, 0),
+	}
+
+	replay := newReplayDelivery(original)
+
+	// Replays are new records of the same delivery
+	assert.NotEqual(t, original.ID, replay.ID)
+	assert.Equal(t, "record", replay.ReplayOf)
+	assert.Equal(t, original.DeliveryID, replay.DeliveryID)
+	assert.Equal(t, original.Event, replay.Event)
+	assert.Equal(t, original.Action, replay.Action)
+	assert.Equal(t, original.Payload, replay.Payload)
+
+	// The result of the replay is recorded once handled
+	assert.Equal(t, []string{}, replay.JobIDs)
+	assert.Equal(t, 0, replay.ResponseStatus)
+	assert.Empty(t, replay.Response)
+	assert.True(t, replay.ReceivedAt.After(original.ReceivedAt))
+}
+
+func TestReplayDeliveryJobs(t *testing.T) {
+	cfg := &config.Config{
+		GhRegistryRepoOwner:  "kscout",
+		GhRegistryRepoName:   "serverless-apps",
+		GhRegistryRepoBranch: "master",
+	}
+	submitter := &testJobSubmitter{}
+	handler := WebhookHandler{
+		BaseHandler: BaseHandler{
+			Logger: golog.NewStdLogger("webhook-deliveries-test"),
+			Cfg:    cfg,
+		},
+		JobRunner: submitter,
+		SCM:       scm.GitHub{Cfg: cfg},
+	}
+
+	replay := newReplayDelivery(models.WebhookDelivery{
+		ID:         "record",
+		DeliveryID: "delivery",
+		Event:      "pull_request",
+		Action:     "opened",
+		Payload:    `{"action": "opened", "number": 7, "pull_request": {"number": 7}, "repository": {"full_name": "kscout/serverless-apps"}}`,
+		JobIDs:     []string{"job"},
+	})
+
+	recorder := httptest.NewRecorder()
+	handler.handleDelivery(recorder, replay)
+
+	// Jobs submitted by the replay are added to its record
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, []jobs.JobTypeT{jobs.JobTypeValidate}, submitter.submitted)
+	assert.Equal(t, []string{"job-1"}, replay.JobIDs)
+}
@@ -0,0 +1,334 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kscout/serverless-registry-api/config"
+	"github.com/kscout/serverless-registry-api/models"
+	"github.com/kscout/serverless-registry-api/parsing"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/google/go-github/v26/github"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// slashCommandPrefix starts every slash command
+const slashCommandPrefix = "/kscout"
+
+// maxSlashCommands is the maximum number of slash commands run from one comment
+const maxSlashCommands = 5
+
+// Slash command names
+const (
+	// SlashCommandValidate re-validates the pull request
+	SlashCommandValidate = "validate"
+
+	// SlashCommandPreview replies with links to app previews
+	SlashCommandPreview = "preview"
+
+	// SlashCommandExplain replies with an explanation of an error code
+	SlashCommandExplain = "explain"
+
+	// SlashCommandApprove approves the pull request, maintainers only
+	SlashCommandApprove = "approve"
+)
+
+// SlashCommand is a command given to the pull request bot in a comment
+type SlashCommand struct {
+	// Name of command
+	Name string
+
+	// Args are the arguments which follow the command name
+	Args []string
+}
+
+// ParseSlashCommands finds slash commands in a comment. Each command must be on its
+// own line, in the format: /kscout NAME ARGS...
+func ParseSlashCommands(body string) []SlashCommand {
+	cmds := []SlashCommand{}
+
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(line)
+
+		if len(fields) < 2 || fields[0] != slashCommandPrefix {
+			continue
+		}
+
+		cmds = append(cmds, SlashCommand{
+			Name: strings.ToLower(fields[1]),
+			Args: fields[2:],
+		})
+
+		if len(cmds) == maxSlashCommands {
+			break
+		}
+	}
+
+	return cmds
+}
+
+// CommandJobDefinition specifies a slash command to run
+type CommandJobDefinition struct {
+	// PRNumber is the number of the pull request the command was given on
+	PRNumber int `validate:"required"`
+
+	// Commenter is the login of the user who gave the command
+	Commenter string `validate:"required"`
+
+	// Command to run
+	Command SlashCommand
+
+	// Registry is the registry repository the pull request was made in.
+	// Optional, defaults to the configured registry repository.
+	Registry RegistryRepo
+}
+
+// CommandJob runs a slash command given in a pull request comment. The commenter's
+// permission is checked before the command is run. The result is placed in a
+// comment.
+// The data field must be a JSON encoded CommandJobDefinition.
+type CommandJob struct {
+	// Logger
+	Logger golog.Logger
+
+	// Cfg is the server configuration
+	Cfg *config.Config
+
+	// Registries accesses registry repositories
+	Registries RegistryClients
+
+	// JobRunner is used to submit validate jobs
+	JobRunner *JobRunner
+
+	// MDbSubmissions is used to access the submissions collection
+	MDbSubmissions *mongo.Collection
+
+	// repo is the registry repository of the pull request, set by Do
+	repo RegistryRepo
+
+	// gh is a GitHub API client which can access repo, set by Do
+	gh *github.Client
+}
+
+// Do implements Job
+func (j CommandJob) Do(ctx context.Context, data []byte) error {
+	// {{{1 Parse definition
+	var jobDef CommandJobDefinition
+	if err := json.Unmarshal(data, &jobDef); err != nil {
+		return fmt.Errorf("failed to decode data field as CommandJobDefinition "+
+			"JSON: %s", err.Error())
+	}
+
+	// {{{1 Get registry repository client
+	var err error
+
+	j.repo, _, j.gh, err = j.Registries.Get(ctx, jobDef.Registry)
+	if err != nil {
+		return err
+	}
+
+	// {{{1 Get PR
+	pr, _, err := j.gh.PullRequests.Get(ctx, j.repo.Owner,
+		j.repo.Name, jobDef.PRNumber)
+	if err != nil {
+		return fmt.Errorf("failed to get PR #%d: %s", jobDef.PRNumber, err.Error())
+	}
+
+	// {{{1 Check permission
+	allowed, err := j.isAllowed(ctx, jobDef, pr)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		return j.reply(ctx, jobDef, fmt.Sprintf("you do not have permission to "+
+			"run `%s %s`", slashCommandPrefix, jobDef.Command.Name))
+	}
+
+	// {{{1 Run command
+	switch jobDef.Command.Name {
+	case SlashCommandValidate:
+		return j.validate(ctx, jobDef, pr)
+	case SlashCommandPreview:
+		return j.preview(ctx, jobDef)
+	case SlashCommandExplain:
+		return j.explain(ctx, jobDef)
+	case SlashCommandApprove:
+		return j.approve(ctx, jobDef)
+	default:
+		return j.reply(ctx, jobDef, fmt.Sprintf("I don't know the `%s` command. "+
+			"I understand:\n\n"+
+			"- `%s validate`: Validate this pull request again\n"+
+			"- `%s preview`: Link to previews of the apps in this pull request\n"+
+			"- `%s explain <error code>`: Explain an error\n"+
+			"- `%s approve`: Approve this pull request, maintainers only",
+			jobDef.Command.Name, slashCommandPrefix, slashCommandPrefix,
+			slashCommandPrefix, slashCommandPrefix))
+	}
+}
+
+// isAllowed returns true if the commenter can run the command. Anyone can run the
+// explain command. The validate and preview commands can be run by the pull request
+// author and maintainers. The approve command can only be run by maintainers.
+// Maintainers are users with write or admin permission for the registry repository.
+func (j CommandJob) isAllowed(ctx context.Context, jobDef CommandJobDefinition,
+	pr *github.PullRequest) (bool, error) {
+
+	if jobDef.Command.Name == SlashCommandExplain {
+		return true, nil
+	}
+
+	isAuthor := pr.GetUser().GetLogin() == jobDef.Commenter
+
+	if isAuthor && jobDef.Command.Name != SlashCommandApprove {
+		return true, nil
+	}
+
+	permission, _, err := j.gh.Repositories.GetPermissionLevel(ctx,
+		j.repo.Owner, j.repo.Name, jobDef.Commenter)
+	if err != nil {
+		return false, fmt.Errorf("failed to get repository permission of %s: %s",
+			jobDef.Commenter, err.Error())
+	}
+
+	switch permission.GetPermission() {
+	case "admin", "write":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// reply comments on the pull request, mentioning the commenter
+func (j CommandJob) reply(ctx context.Context, jobDef CommandJobDefinition,
+	body string) error {
+
+	body = fmt.Sprintf("@%s %s  \n---  \n*I am a bot*", jobDef.Commenter, body)
+
+	_, _, err := j.gh.Issues.CreateComment(ctx, j.repo.Owner,
+		j.repo.Name, jobDef.PRNumber, &github.IssueComment{
+			Body: &body,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to reply to %s command on PR #%d: %s",
+			jobDef.Command.Name, jobDef.PRNumber, err.Error())
+	}
+
+	return nil
+}
+
+// validate submits a validate job for the pull request
+func (j CommandJob) validate(ctx context.Context, jobDef CommandJobDefinition,
+	pr *github.PullRequest) error {
+
+	if pr.GetState() != "open" {
+		return j.reply(ctx, jobDef, "this pull request is closed, it will not "+
+			"be validated")
+	}
+
+	prBytes, err := json.Marshal(*pr)
+	if err != nil {
+		return fmt.Errorf("failed to marshal PR #%d into JSON: %s",
+			jobDef.PRNumber, err.Error())
+	}
+
+	// Submit in a goroutine b/c the JobRunner does not accept new jobs
+	// until this one has finished
+	go func() {
+		if _, err := j.JobRunner.Submit(JobTypeValidate, prBytes); err != nil {
+			j.Logger.Errorf("failed to submit validate job for PR #%d: %s",
+				jobDef.PRNumber, err.Error())
+		}
+	}()
+
+	return j.reply(ctx, jobDef, "I'll validate this pull request again")
+}
+
+// preview replies with links to the preview endpoints of each valid app in the
+// pull request
+func (j CommandJob) preview(ctx context.Context, jobDef CommandJobDefinition) error {
+	// {{{1 Get submission
+	var submission models.Submission
+
+	err := j.MDbSubmissions.FindOne(ctx, bson.D{
+		{"pr_number", jobDef.PRNumber},
+		RegistryFilter(j.Cfg, j.repo.FullName()),
+	}).Decode(&submission)
+	if err == mongo.ErrNoDocuments {
+		return j.reply(ctx, jobDef, "this pull request has not been validated "+
+			"yet, there is nothing to preview")
+	} else if err != nil {
+		return fmt.Errorf("failed to get submission for PR #%d: %s",
+			jobDef.PRNumber, err.Error())
+	}
+
+	// {{{1 Build links
+	appIDs := []string{}
+	for appID, submissionApp := range submission.Apps {
+		if submissionApp != nil && submissionApp.App != nil {
+			appIDs = append(appIDs, appID)
+		}
+	}
+	sort.Strings(appIDs)
+
+	if len(appIDs) == 0 {
+		return j.reply(ctx, jobDef, "no apps in this pull request are valid, "+
+			"there is nothing to preview")
+	}
+
+	body := fmt.Sprintf("here are previews of the apps in this pull request at "+
+		"commit %s:\n\n", submission.HeadSHA)
+
+	for _, appID := range appIDs {
+		body += fmt.Sprintf("- **%s**: [App](%s) / [deploy.sh](%s) / "+
+			"[deployment.json](%s)\n", appID,
+			previewURL(j.Cfg, j.repo, jobDef.PRNumber, appID, ""),
+			previewURL(j.Cfg, j.repo, jobDef.PRNumber, appID, "/deploy.sh"),
+			previewURL(j.Cfg, j.repo, jobDef.PRNumber, appID, "/deployment.json"))
+	}
+
+	return j.reply(ctx, jobDef, body)
+}
+
+// explain replies with an explanation of the error code given as an argument
+func (j CommandJob) explain(ctx context.Context, jobDef CommandJobDefinition) error {
+	if len(jobDef.Command.Args) == 0 {
+		return j.reply(ctx, jobDef, fmt.Sprintf("provide an error code, for "+
+			"example: `%s explain %s`", slashCommandPrefix,
+			parsing.ErrCodeManifestYAML))
+	}
+
+	code := strings.ToUpper(strings.Trim(jobDef.Command.Args[0], "`"))
+
+	explanation, ok := parsing.ExplainErrorCode(code)
+	if !ok {
+		return j.reply(ctx, jobDef, fmt.Sprintf("`%s` is not an error code I "+
+			"know", code))
+	}
+
+	return j.reply(ctx, jobDef, fmt.Sprintf("**%s**: %s", code, explanation))
+}
+
+// approve approves the pull request with a review
+func (j CommandJob) approve(ctx context.Context, jobDef CommandJobDefinition) error {
+	event := "APPROVE"
+	body := fmt.Sprintf("Approved by @%s", jobDef.Commenter)
+
+	_, _, err := j.gh.PullRequests.CreateReview(ctx, j.repo.Owner,
+		j.repo.Name, jobDef.PRNumber,
+		&github.PullRequestReviewRequest{
+			Event: &event,
+			Body:  &body,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to approve PR #%d: %s", jobDef.PRNumber,
+			err.Error())
+	}
+
+	return nil
+}
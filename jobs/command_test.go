@@ -0,0 +1,34 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSlashCommands(t *testing.T) {
+	cmds := ParseSlashCommands("Thanks!\n" +
+		"/kscout validate\n" +
+		"  /kscout EXPLAIN KS003  \n" +
+		"/kscoutvalidate\n" +
+		"/kscout\n" +
+		"please /kscout approve\n")
+
+	assert.Equal(t, []SlashCommand{
+		SlashCommand{Name: "validate", Args: []string{}},
+		SlashCommand{Name: "explain", Args: []string{"KS003"}},
+	}, cmds)
+}
+
+func TestParseSlashCommandsLimit(t *testing.T) {
+	body := ""
+	for i := 0; i < maxSlashCommands+2; i++ {
+		body += "/kscout preview\n"
+	}
+
+	assert.Len(t, ParseSlashCommands(body), maxSlashCommands)
+}
+
+func TestParseSlashCommandsNone(t *testing.T) {
+	assert.Empty(t, ParseSlashCommands("Looks good to me"))
+}
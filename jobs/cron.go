@@ -0,0 +1,213 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronMacros maps cron shorthand expressions to their full 5 field form
+var cronMacros map[string]string = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField describes the allowed values of one field in a cron expression
+type cronField struct {
+	// name of field, used in error messages
+	name string
+
+	// min is the smallest allowed value
+	min int
+
+	// max is the largest allowed value
+	max int
+}
+
+// cronFields are the fields of a cron expression, in the order they appear
+var cronFields []cronField = []cronField{
+	cronField{name: "minute", min: 0, max: 59},
+	cronField{name: "hour", min: 0, max: 23},
+	cronField{name: "day of month", min: 1, max: 31},
+	cronField{name: "month", min: 1, max: 12},
+	cronField{name: "day of week", min: 0, max: 7},
+}
+
+// CronSchedule is a parsed cron expression. Expressions have 5 space separated fields:
+// minute, hour, day of month, month, and day of week. Each field can be a "*", a
+// value, a range ("1-5"), a list ("1,3,5"), or a step ("*/15", "0-30/10").
+// The shorthand expressions @yearly, @monthly, @weekly, @daily, and @hourly are
+// also accepted.
+type CronSchedule struct {
+	// Spec is the expression the schedule was parsed from
+	Spec string
+
+	// minutes, hours, daysOfMonth, months, and daysOfWeek are bit sets where
+	// a 1 bit at index N indicates the value N matches the field
+	minutes     uint64
+	hours       uint64
+	daysOfMonth uint64
+	months      uint64
+	daysOfWeek  uint64
+
+	// anyDayOfMonth is true if the day of month field was "*"
+	anyDayOfMonth bool
+
+	// anyDayOfWeek is true if the day of week field was "*"
+	anyDayOfWeek bool
+}
+
+// ParseCronSchedule parses a cron expression
+func ParseCronSchedule(spec string) (*CronSchedule, error) {
+	expr := strings.TrimSpace(spec)
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("expected %d fields but found %d", len(cronFields),
+			len(parts))
+	}
+
+	sets := []uint64{}
+	for i, part := range parts {
+		set, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s field: %s", cronFields[i].name,
+				err.Error())
+		}
+
+		sets = append(sets, set)
+	}
+
+	// Sunday can be specified as 0 or 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return &CronSchedule{
+		Spec:          spec,
+		minutes:       sets[0],
+		hours:         sets[1],
+		daysOfMonth:   sets[2],
+		months:        sets[3],
+		daysOfWeek:    sets[4],
+		anyDayOfMonth: parts[2] == "*",
+		anyDayOfWeek:  parts[4] == "*",
+	}, nil
+}
+
+// parseCronField parses one field of a cron expression into a bit set
+func parseCronField(value string, field cronField) (uint64, error) {
+	var set uint64
+
+	for _, item := range strings.Split(value, ",") {
+		// {{{1 Split off step
+		step := 1
+		rangeStr := item
+
+		if i := strings.Index(item, "/"); i != -1 {
+			rangeStr = item[:i]
+
+			parsedStep, err := strconv.Atoi(item[i+1:])
+			if err != nil || parsedStep <= 0 {
+				return 0, fmt.Errorf("invalid step in \"%s\"", item)
+			}
+			step = parsedStep
+		}
+
+		// {{{1 Parse range
+		start := field.min
+		end := field.max
+
+		if rangeStr != "*" {
+			bounds := strings.SplitN(rangeStr, "-", 2)
+
+			parsedStart, err := strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid value \"%s\"", bounds[0])
+			}
+			start = parsedStart
+			end = parsedStart
+
+			if len(bounds) == 2 {
+				parsedEnd, err := strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, fmt.Errorf("invalid value \"%s\"", bounds[1])
+				}
+				end = parsedEnd
+			} else if step != 1 {
+				// "N/step" means from N to the field's max
+				end = field.max
+			}
+		}
+
+		if start < field.min || end > field.max || start > end {
+			return 0, fmt.Errorf("\"%s\" is outside the allowed range %d-%d",
+				item, field.min, field.max)
+		}
+
+		// {{{1 Set bits
+		for v := start; v <= end; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+// Next returns the first time after the provided time which matches the schedule.
+// Returns a zero time if no matching time exists within the next 5 years.
+func (s CronSchedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(),
+		after.Minute(), 0, 0, loc).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// dayMatches returns true if the day of t matches the day of month and day of
+// week fields. Like cron, if both fields are restricted a day matches if either
+// field matches.
+func (s CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.daysOfMonth&(1<<uint(t.Day())) != 0
+	dowMatch := s.daysOfWeek&(1<<uint(t.Weekday())) != 0
+
+	if s.anyDayOfMonth || s.anyDayOfWeek {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
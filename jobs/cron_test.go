@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	// Wednesday
+	after := time.Date(2019, time.July, 10, 13, 7, 30, 0, time.UTC)
+
+	cases := map[string]time.Time{
+		"* * * * *":    time.Date(2019, time.July, 10, 13, 8, 0, 0, time.UTC),
+		"*/15 * * * *": time.Date(2019, time.July, 10, 13, 15, 0, 0, time.UTC),
+		"@hourly":      time.Date(2019, time.July, 10, 14, 0, 0, 0, time.UTC),
+		"30 2 * * *":   time.Date(2019, time.July, 11, 2, 30, 0, 0, time.UTC),
+		"0 9 * * 1-5":  time.Date(2019, time.July, 11, 9, 0, 0, 0, time.UTC),
+		"0 0 * * 7":    time.Date(2019, time.July, 14, 0, 0, 0, 0, time.UTC),
+		"0 0 1 1 *":    time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 31 2 *":   time.Time{},
+	}
+
+	for spec, expected := range cases {
+		schedule, err := ParseCronSchedule(spec)
+		assert.NoErrorf(t, err, "failed to parse \"%s\"", spec)
+
+		assert.Equalf(t, expected, schedule.Next(after), "wrong next time for \"%s\"", spec)
+	}
+}
+
+func TestCronScheduleParseErrors(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := ParseCronSchedule(spec)
+		assert.Errorf(t, err, "\"%s\" should not parse", spec)
+	}
+}
@@ -3,5 +3,9 @@ Longer running tasks.
 
 The job system allows go routines running custom logic, called jobs, to be started.  
 See JobRunner for usage instructions.
+
+Each type of job is registered with JobRunner.Register() along with the schema of
+the data it accepts. Submitted data is checked against this schema before the job
+is queued.
 */
 package jobs
@@ -0,0 +1,414 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kscout/serverless-registry-api/models"
+	"github.com/kscout/serverless-registry-api/validation"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The apps collection is updated in generations so readers never see a partially
+// updated catalog. A new generation is built in the apps_staging collection. Once
+// complete and validated the current generation is copied to the apps_previous
+// collection and the staging collection replaces the apps collection. Each copy
+// uses the $out aggregation stage which replaces the destination
+// collection atomically and keeps its indexes.
+
+// AppsGenerations holds the collections used to build and swap app generations
+type AppsGenerations struct {
+	// Ctx is the context used for database operations, should be set to a job's
+	// context before use
+	Ctx context.Context
+
+	// MDbApps is the apps collection, holds the current generation
+	MDbApps *mongo.Collection
+
+	// MDbAppsStaging is the apps_staging collection, holds the generation being built
+	MDbAppsStaging *mongo.Collection
+
+	// MDbAppsPrevious is the apps_previous collection, holds the previous generation
+	MDbAppsPrevious *mongo.Collection
+
+	// MDbSyncState is the sync_state collection, holds the state of the current
+	// and previous generations
+	MDbSyncState *mongo.Collection
+}
+
+// copyCollection atomically replaces the contents of the dest collection with the
+// documents in the src collection
+func copyCollection(ctx context.Context, src *mongo.Collection, dest *mongo.Collection) error {
+	cursor, err := src.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{"$match", bson.D{}}},
+		bson.D{{"$out", dest.Name()}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy %s collection to %s collection: %s",
+			src.Name(), dest.Name(), err.Error())
+	}
+
+	return cursor.Close(ctx)
+}
+
+// GetSyncState returns the sync state with an ID. Returns a zero SyncState with the
+// ID set if none exists.
+func (g AppsGenerations) GetSyncState(id string) (models.SyncState, error) {
+	state := models.SyncState{
+		ID: id,
+	}
+
+	err := g.MDbSyncState.FindOne(g.Ctx, bson.D{{"_id", id}}).Decode(&state)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return state, fmt.Errorf("failed to get %s sync state from db: %s", id,
+			err.Error())
+	}
+
+	return state, nil
+}
+
+// registrySyncState returns how far a sync state has been synchronized with a
+// registry repository. The configured registry repository's state is held by the
+// sync state's own fields.
+func registrySyncState(state models.SyncState, registry string,
+	isDefault bool) models.RegistrySyncState {
+
+	if isDefault {
+		return models.RegistrySyncState{
+			Registry:  registry,
+			CommitSHA: state.CommitSHA,
+			FailedIDs: state.FailedIDs,
+		}
+	}
+
+	for _, regState := range state.Registries {
+		if regState.Registry == registry {
+			return regState
+		}
+	}
+
+	return models.RegistrySyncState{
+		Registry: registry,
+	}
+}
+
+// setRegistrySyncState returns a sync state with the state of a registry repository
+// replaced
+func setRegistrySyncState(state models.SyncState, regState models.RegistrySyncState,
+	isDefault bool) models.SyncState {
+
+	if isDefault {
+		state.CommitSHA = regState.CommitSHA
+		state.FailedIDs = regState.FailedIDs
+
+		return state
+	}
+
+	registries := []models.RegistrySyncState{}
+	for _, existing := range state.Registries {
+		if existing.Registry != regState.Registry {
+			registries = append(registries, existing)
+		}
+	}
+	state.Registries = append(registries, regState)
+
+	return state
+}
+
+// saveSyncState upserts a sync state
+func (g AppsGenerations) saveSyncState(state models.SyncState) error {
+	upsertTrue := true
+	_, err := g.MDbSyncState.ReplaceOne(g.Ctx, bson.D{{"_id", state.ID}}, state,
+		&options.ReplaceOptions{
+			Upsert: &upsertTrue,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to save %s sync state in db: %s", state.ID,
+			err.Error())
+	}
+
+	return nil
+}
+
+// StartStaging replaces the contents of the staging collection with the current
+// generation. Changes can then be made to the staging collection.
+func (g AppsGenerations) StartStaging() error {
+	return copyCollection(g.Ctx, g.MDbApps, g.MDbAppsStaging)
+}
+
+// ValidateStaging ensures every app in the staging collection is valid and that
+// app IDs are unique
+func (g AppsGenerations) ValidateStaging() error {
+	cursor, err := g.MDbAppsStaging.Find(g.Ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("failed to query staging collection: %s", err.Error())
+	}
+	defer cursor.Close(g.Ctx)
+
+	appIDs := map[string]bool{}
+
+	for cursor.Next(g.Ctx) {
+		var app models.App
+		if err := cursor.Decode(&app); err != nil {
+			return fmt.Errorf("failed to decode app in staging collection: %s",
+				err.Error())
+		}
+
+		if appIDs[app.AppID] {
+			return fmt.Errorf("app ID %s is not unique", app.AppID)
+		}
+		appIDs[app.AppID] = true
+
+		if err := validation.ValidateApp(app); err != nil {
+			return fmt.Errorf("app with ID %s is not valid: %s", app.AppID,
+				err.Error())
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to iterate over staging collection: %s",
+			err.Error())
+	}
+
+	return nil
+}
+
+// SwapInStaging makes the staging collection the current generation. The current
+// generation becomes the previous generation. The state argument describes the
+// new generation, its Generation field is set by this method.
+func (g AppsGenerations) SwapInStaging(state models.SyncState) error {
+	// {{{1 Get state of current generation
+	currentState, err := g.GetSyncState(models.SyncStateAppsID)
+	if err != nil {
+		return err
+	}
+
+	// {{{1 Keep current generation as previous generation
+	if err := copyCollection(g.Ctx, g.MDbApps, g.MDbAppsPrevious); err != nil {
+		return err
+	}
+
+	currentState.ID = models.SyncStateAppsPreviousID
+	if err := g.saveSyncState(currentState); err != nil {
+		return err
+	}
+
+	// {{{1 Swap in staging
+	if err := copyCollection(g.Ctx, g.MDbAppsStaging, g.MDbApps); err != nil {
+		return err
+	}
+
+	// If the process stops before the state is saved the next update will
+	// re-apply changes from the older commit, which is safe
+	state.ID = models.SyncStateAppsID
+	state.Generation = currentState.Generation + 1
+
+	return g.saveSyncState(state)
+}
+
+// Rollback swaps the current and previous generations. Calling Rollback twice
+// restores the original current generation.
+func (g AppsGenerations) Rollback() error {
+	// {{{1 Ensure a previous generation exists
+	previousState, err := g.GetSyncState(models.SyncStateAppsPreviousID)
+	if err != nil {
+		return err
+	}
+
+	if previousState.Generation == 0 && len(previousState.CommitSHA) == 0 {
+		return fmt.Errorf("no previous generation exists")
+	}
+
+	currentState, err := g.GetSyncState(models.SyncStateAppsID)
+	if err != nil {
+		return err
+	}
+
+	// {{{1 Swap collections
+	// Use staging collection as temporary storage for current generation
+	if err := copyCollection(g.Ctx, g.MDbApps, g.MDbAppsStaging); err != nil {
+		return err
+	}
+
+	if err := copyCollection(g.Ctx, g.MDbAppsPrevious, g.MDbApps); err != nil {
+		return err
+	}
+
+	if err := copyCollection(g.Ctx, g.MDbAppsStaging, g.MDbAppsPrevious); err != nil {
+		return err
+	}
+
+	// {{{1 Swap states
+	previousState.ID = models.SyncStateAppsID
+	currentState.ID = models.SyncStateAppsPreviousID
+
+	if err := g.saveSyncState(previousState); err != nil {
+		return err
+	}
+
+	return g.saveSyncState(currentState)
+}
+
+// loadApps returns all apps in a collection, keys are app IDs
+func (g AppsGenerations) loadApps(collection *mongo.Collection) (map[string]models.App, error) {
+	cursor, err := collection.Find(g.Ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s collection: %s", collection.Name(),
+			err.Error())
+	}
+	defer cursor.Close(g.Ctx)
+
+	apps := map[string]models.App{}
+
+	for cursor.Next(g.Ctx) {
+		var app models.App
+		if err := cursor.Decode(&app); err != nil {
+			return nil, fmt.Errorf("failed to decode app in %s collection: %s",
+				collection.Name(), err.Error())
+		}
+
+		apps[app.AppID] = app
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over %s collection: %s",
+			collection.Name(), err.Error())
+	}
+
+	return apps, nil
+}
+
+// appsEqual returns true if two apps have the same content. Parse failures are
+// ignored b/c they do not change the app users see. Update times are ignored b/c
+// they are derived from this comparison.
+func appsEqual(a, b models.App) (bool, error) {
+	a.ParseFailure = nil
+	b.ParseFailure = nil
+	a.UpdatedAt = time.Time{}
+	b.UpdatedAt = time.Time{}
+
+	aBytes, err := json.Marshal(a)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal app with ID %s into JSON: %s",
+			a.AppID, err.Error())
+	}
+
+	bBytes, err := json.Marshal(b)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal app with ID %s into JSON: %s",
+			b.AppID, err.Error())
+	}
+
+	return bytes.Equal(aBytes, bBytes), nil
+}
+
+// StagingDelta returns the apps which differ between the current generation and the
+// staging collection. Should be called before SwapInStaging.
+func (g AppsGenerations) StagingDelta(commitSHA string) (models.AppsDelta, error) {
+	// {{{1 Load generations
+	currentApps, err := g.loadApps(g.MDbApps)
+	if err != nil {
+		return models.AppsDelta{}, err
+	}
+
+	stagingApps, err := g.loadApps(g.MDbAppsStaging)
+	if err != nil {
+		return models.AppsDelta{}, err
+	}
+
+	return appsDelta(commitSHA, currentApps, stagingApps)
+}
+
+// appsDelta returns the apps which differ between two generations, keys of the
+// maps are app IDs
+func appsDelta(commitSHA string, currentApps, stagingApps map[string]models.App) (models.AppsDelta, error) {
+	delta := models.AppsDelta{
+		FormatVersion: models.AppsDeltaFormatVersion,
+		CommitSHA:     commitSHA,
+		Created:       []models.AppChange{},
+		Updated:       []models.AppChange{},
+		Deleted:       []models.AppChange{},
+	}
+
+	// {{{1 Compare
+	appIDs := []string{}
+	for appID, _ := range currentApps {
+		appIDs = append(appIDs, appID)
+	}
+	for appID, _ := range stagingApps {
+		if _, ok := currentApps[appID]; !ok {
+			appIDs = append(appIDs, appID)
+		}
+	}
+	sort.Strings(appIDs)
+
+	for _, appID := range appIDs {
+		currentApp, inCurrent := currentApps[appID]
+		stagingApp, inStaging := stagingApps[appID]
+
+		change := models.AppChange{
+			AppID: appID,
+		}
+
+		if inCurrent {
+			change.Previous = &currentApp
+		}
+		if inStaging {
+			change.Current = &stagingApp
+		}
+
+		if !inCurrent {
+			delta.Created = append(delta.Created, change)
+		} else if !inStaging {
+			delta.Deleted = append(delta.Deleted, change)
+		} else {
+			equal, err := appsEqual(currentApp, stagingApp)
+			if err != nil {
+				return delta, err
+			}
+
+			if !equal {
+				delta.Updated = append(delta.Updated, change)
+			}
+		}
+	}
+
+	return delta, nil
+}
+
+// MarkUpdated sets the update time of the apps created or updated in a delta, in
+// the staging collection and in the delta. Should be called before SwapInStaging.
+func (g AppsGenerations) MarkUpdated(delta *models.AppsDelta, updatedAt time.Time) error {
+	appIDs := []string{}
+
+	for _, changes := range [][]models.AppChange{delta.Created, delta.Updated} {
+		for _, change := range changes {
+			appIDs = append(appIDs, change.AppID)
+
+			if change.Current != nil {
+				change.Current.UpdatedAt = updatedAt
+			}
+		}
+	}
+
+	if len(appIDs) == 0 {
+		return nil
+	}
+
+	_, err := g.MDbAppsStaging.UpdateMany(g.Ctx,
+		bson.D{{"app_id", bson.D{{"$in", appIDs}}}},
+		bson.D{{"$set", bson.D{{"updated_at", updatedAt}}}})
+	if err != nil {
+		return fmt.Errorf("failed to set update time of apps in staging "+
+			"collection: %s", err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kscout/serverless-registry-api/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppsEqual(t *testing.T) {
+	app := models.App{
+		AppID:   "hello-world",
+		Name:    "Hello World",
+		Version: "1.0.0",
+	}
+
+	// Parse failures and update times do not change the app users see
+	failed := app
+	failed.ParseFailure = &models.AppParseFailure{
+		Errors:    []string{"bad manifest"},
+		CommitSHA: "abc",
+		FailedAt:  time.Now(),
+	}
+	failed.UpdatedAt = time.Now()
+
+	equal, err := appsEqual(app, failed)
+	assert.NoError(t, err)
+	assert.True(t, equal)
+
+	// Content changes do
+	changed := app
+	changed.Version = "1.1.0"
+
+	equal, err = appsEqual(app, changed)
+	assert.NoError(t, err)
+	assert.False(t, equal)
+}
+
+func TestAppsDelta(t *testing.T) {
+	unchanged := models.App{AppID: "unchanged", Version: "1.0.0"}
+	updated := models.App{AppID: "updated", Version: "1.0.0"}
+	deleted := models.App{AppID: "deleted", Version: "1.0.0"}
+	failed := models.App{AppID: "failed", Version: "1.0.0"}
+	created := models.App{AppID: "created", Version: "1.0.0"}
+
+	updatedNew := updated
+	updatedNew.Version = "2.0.0"
+
+	failedNew := failed
+	failedNew.ParseFailure = &models.AppParseFailure{Errors: []string{"bad manifest"}}
+
+	delta, err := appsDelta("abc", map[string]models.App{
+		"unchanged": unchanged,
+		"updated":   updated,
+		"deleted":   deleted,
+		"failed":    failed,
+	}, map[string]models.App{
+		"unchanged": unchanged,
+		"updated":   updatedNew,
+		"failed":    failedNew,
+		"created":   created,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, models.AppsDelta{
+		FormatVersion: models.AppsDeltaFormatVersion,
+		CommitSHA:     "abc",
+		Created: []models.AppChange{
+			models.AppChange{AppID: "created", Current: &created},
+		},
+		Updated: []models.AppChange{
+			models.AppChange{AppID: "updated", Previous: &updated, Current: &updatedNew},
+		},
+		Deleted: []models.AppChange{
+			models.AppChange{AppID: "deleted", Previous: &deleted},
+		},
+	}, delta)
+
+	// Nothing changed
+	delta, err = appsDelta("abc", map[string]models.App{"unchanged": unchanged},
+		map[string]models.App{"unchanged": unchanged})
+	assert.NoError(t, err)
+	assert.True(t, delta.Empty())
+}
+
+func TestRegistrySyncState(t *testing.T) {
+	state := models.SyncState{
+		CommitSHA: "abc",
+		FailedIDs: []string{"broken"},
+	}
+
+	// The configured registry repository uses the top level fields
+	defaultState := registrySyncState(state, "kscout/serverless-apps", true)
+	assert.Equal(t, "abc", defaultState.CommitSHA)
+	assert.Equal(t, []string{"broken"}, defaultState.FailedIDs)
+
+	// Other registry repositories have not been synced yet
+	otherState := registrySyncState(state, "other-org/apps", false)
+	assert.Equal(t, models.RegistrySyncState{Registry: "other-org/apps"}, otherState)
+
+	otherState.CommitSHA = "def"
+	updated := setRegistrySyncState(state, otherState, false)
+	assert.Equal(t, "abc", updated.CommitSHA)
+	assert.Empty(t, state.Registries, "original state should not change")
+	assert.Equal(t, otherState, registrySyncState(updated, "other-org/apps", false))
+
+	// Replacing a registry's state does not duplicate it
+	otherState.CommitSHA = "ghi"
+	updated = setRegistrySyncState(updated, otherState, false)
+	assert.Len(t, updated.Registries, 1)
+	assert.Equal(t, "ghi", updated.Registries[0].CommitSHA)
+
+	defaultState.CommitSHA = "jkl"
+	updated = setRegistrySyncState(updated, defaultState, true)
+	assert.Equal(t, "jkl", updated.CommitSHA)
+	assert.Len(t, updated.Registries, 1)
+}
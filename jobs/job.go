@@ -1,8 +1,13 @@
 package jobs
 
+import (
+	"context"
+)
+
 // Job is a piece of logic
 type Job interface {
-	// Do job. Data argument holds arbitrary data. It is up to each job
+	// Do job. The ctx argument is canceled when the job is canceled or exceeds
+	// its deadline. Data argument holds arbitrary data. It is up to each job
 	// to define what data it takes.
-	Do(data []byte) error
+	Do(ctx context.Context, data []byte) error
 }
@@ -0,0 +1,266 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/kscout/serverless-registry-api/models"
+	"github.com/kscout/serverless-registry-api/parsing"
+
+	"github.com/google/go-github/v26/github"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Keys of labels in Config.GhLabels which ValidateJob applies to pull requests
+const (
+	// LabelNewApp is applied if a pull request adds an app
+	LabelNewApp = "new_app"
+
+	// LabelUpdateApp is applied if a pull request modifies an existing app
+	LabelUpdateApp = "update_app"
+
+	// LabelDeleteApp is applied if a pull request deletes an app
+	LabelDeleteApp = "delete_app"
+
+	// LabelFormatError is applied if an app in a pull request is not formatted
+	// correctly
+	LabelFormatError = "format_error"
+
+	// LabelInternalError is applied if a pull request could not be validated due to
+	// a server error
+	LabelInternalError = "internal_error"
+)
+
+// labelColor is the color of labels created by ValidateJob
+const labelColor = "1d76db"
+
+// validationLabels computes the labels a pull request should have. The catalogApps
+// argument holds the apps currently in the catalog which the pull request modifies
+// or deletes, keys are app IDs.
+func (j ValidateJob) validationLabels(appIDs, deletedAppIDs []string,
+	apps map[string]*models.App, parseErrs map[string][]parsing.ParseError,
+	catalogApps map[string]models.App) []string {
+
+	labels := map[string]bool{}
+
+	addLabel := func(key string) {
+		if name, ok := j.Cfg.GhLabels[key]; ok && len(name) > 0 {
+			labels[name] = true
+		}
+	}
+
+	addCategories := func(categories []string) {
+		for _, category := range categories {
+			labels[j.Cfg.GhCategoryLabelPrefix+category] = true
+		}
+	}
+
+	// {{{1 Modified apps
+	for _, appID := range appIDs {
+		catalogApp, inCatalog := catalogApps[appID]
+
+		if inCatalog {
+			addLabel(LabelUpdateApp)
+			addCategories(catalogApp.Categories)
+		} else {
+			addLabel(LabelNewApp)
+		}
+
+		if app, ok := apps[appID]; ok {
+			addCategories(app.Categories)
+		}
+	}
+
+	// {{{1 Deleted apps
+	for _, appID := range deletedAppIDs {
+		addLabel(LabelDeleteApp)
+
+		if catalogApp, ok := catalogApps[appID]; ok {
+			addCategories(catalogApp.Categories)
+		}
+	}
+
+	// {{{1 Errors
+	for _, errs := range parseErrs {
+		for _, err := range errs {
+			if err.InternalError != nil {
+				addLabel(LabelInternalError)
+			} else {
+				addLabel(LabelFormatError)
+			}
+		}
+	}
+
+	names := []string{}
+	for name, _ := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// isManagedLabel returns true if a label is applied by ValidateJob
+func (j ValidateJob) isManagedLabel(name string) bool {
+	for _, managedName := range j.Cfg.GhLabels {
+		if name == managedName {
+			return true
+		}
+	}
+
+	return len(j.Cfg.GhCategoryLabelPrefix) > 0 &&
+		strings.HasPrefix(name, j.Cfg.GhCategoryLabelPrefix)
+}
+
+// labelPR computes and applies the labels a pull request should have
+func (j ValidateJob) labelPR(ctx context.Context, prNumber int, appIDs,
+	deletedAppIDs []string, apps map[string]*models.App,
+	parseErrs map[string][]parsing.ParseError) error {
+
+	catalogApps, err := j.getCatalogApps(ctx, append(append([]string{}, appIDs...),
+		deletedAppIDs...))
+	if err != nil {
+		return fmt.Errorf("failed to get apps modified by PR from catalog: %s",
+			err.Error())
+	}
+
+	labels := j.validationLabels(appIDs, deletedAppIDs, apps, parseErrs, catalogApps)
+	if err := j.applyLabels(ctx, prNumber, labels); err != nil {
+		return fmt.Errorf("failed to apply labels: %s", err.Error())
+	}
+
+	return nil
+}
+
+// getCatalogApps returns the apps in the catalog with IDs, keys are app IDs
+func (j ValidateJob) getCatalogApps(ctx context.Context,
+	appIDs []string) (map[string]models.App, error) {
+
+	cursor, err := j.MDbApps.Find(ctx, bson.D{{"app_id", bson.D{{"$in", appIDs}}}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query apps: %s", err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	apps := map[string]models.App{}
+
+	for cursor.Next(ctx) {
+		var app models.App
+		if err := cursor.Decode(&app); err != nil {
+			return nil, fmt.Errorf("failed to decode app: %s", err.Error())
+		}
+
+		apps[app.AppID] = app
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over apps: %s", err.Error())
+	}
+
+	return apps, nil
+}
+
+// ensureLabel creates a label in the registry repository if it does not exist
+func (j ValidateJob) ensureLabel(ctx context.Context, name string) error {
+	_, resp, err := j.gh.Issues.GetLabel(ctx, j.repo.Owner,
+		j.repo.Name, name)
+	if err == nil {
+		return nil
+	}
+
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to get label \"%s\": %s", name, err.Error())
+	}
+
+	color := labelColor
+	_, _, err = j.gh.Issues.CreateLabel(ctx, j.repo.Owner,
+		j.repo.Name, &github.Label{
+			Name:  &name,
+			Color: &color,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to create label \"%s\": %s", name, err.Error())
+	}
+
+	return nil
+}
+
+// applyLabels sets the labels managed by ValidateJob on a pull request. Labels which
+// are not managed by ValidateJob are not changed.
+func (j ValidateJob) applyLabels(ctx context.Context, prNumber int,
+	labels []string) error {
+
+	// {{{1 Get current labels
+	current := map[string]bool{}
+
+	listOpts := &github.ListOptions{
+		PerPage: 100,
+	}
+
+	for {
+		page, resp, err := j.gh.Issues.ListLabelsByIssue(ctx,
+			j.repo.Owner, j.repo.Name, prNumber,
+			listOpts)
+		if err != nil {
+			return fmt.Errorf("failed to list labels: %s", err.Error())
+		}
+
+		for _, label := range page {
+			current[label.GetName()] = true
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		listOpts.Page = resp.NextPage
+	}
+
+	// {{{1 Remove stale labels
+	desired := map[string]bool{}
+	for _, name := range labels {
+		desired[name] = true
+	}
+
+	for name, _ := range current {
+		if desired[name] || !j.isManagedLabel(name) {
+			continue
+		}
+
+		_, err := j.gh.Issues.RemoveLabelForIssue(ctx, j.repo.Owner,
+			j.repo.Name, prNumber, name)
+		if err != nil {
+			return fmt.Errorf("failed to remove label \"%s\": %s", name,
+				err.Error())
+		}
+	}
+
+	// {{{1 Add missing labels
+	missing := []string{}
+
+	for _, name := range labels {
+		if current[name] {
+			continue
+		}
+
+		if err := j.ensureLabel(ctx, name); err != nil {
+			return err
+		}
+
+		missing = append(missing, name)
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	_, _, err := j.gh.Issues.AddLabelsToIssue(ctx, j.repo.Owner,
+		j.repo.Name, prNumber, missing)
+	if err != nil {
+		return fmt.Errorf("failed to add labels: %s", err.Error())
+	}
+
+	return nil
+}
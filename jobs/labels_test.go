@@ -0,0 +1,59 @@
+package jobs
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kscout/serverless-registry-api/config"
+	"github.com/kscout/serverless-registry-api/models"
+	"github.com/kscout/serverless-registry-api/parsing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidationLabels(t *testing.T) {
+	j := ValidateJob{
+		Cfg: &config.Config{
+			GhLabels: map[string]string{
+				LabelNewApp:        "new-app",
+				LabelUpdateApp:     "update-app",
+				LabelDeleteApp:     "delete-app",
+				LabelFormatError:   "format-error",
+				LabelInternalError: "internal-error",
+			},
+			GhCategoryLabelPrefix: "category/",
+		},
+	}
+
+	catalogApps := map[string]models.App{
+		"updated": models.App{Categories: []string{"web"}},
+		"deleted": models.App{Categories: []string{"ml"}},
+	}
+
+	apps := map[string]*models.App{
+		"created": &models.App{Categories: []string{"web", "data"}},
+	}
+
+	parseErrs := map[string][]parsing.ParseError{
+		"broken": []parsing.ParseError{
+			parsing.ParseError{What: "manifest", Why: "missing"},
+		},
+	}
+
+	labels := j.validationLabels([]string{"created", "updated", "broken"},
+		[]string{"deleted"}, apps, parseErrs, catalogApps)
+
+	assert.Equal(t, []string{"category/data", "category/ml", "category/web",
+		"delete-app", "format-error", "new-app", "update-app"}, labels)
+
+	// Internal errors
+	parseErrs["broken"][0].InternalError = fmt.Errorf("oops")
+
+	labels = j.validationLabels([]string{"broken"}, nil, nil, parseErrs, nil)
+	assert.Equal(t, []string{"internal-error", "new-app"}, labels)
+
+	// Managed labels
+	assert.True(t, j.isManagedLabel("format-error"))
+	assert.True(t, j.isManagedLabel("category/web"))
+	assert.False(t, j.isManagedLabel("help wanted"))
+}
@@ -0,0 +1,143 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kscout/serverless-registry-api/config"
+	"github.com/kscout/serverless-registry-api/ghapp"
+	"github.com/kscout/serverless-registry-api/scm"
+
+	"github.com/google/go-github/v26/github"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RegistryRepo identifies the registry repository a job acts on. Jobs given the zero
+// value act on the configured GhRegistryRepoOwner/GhRegistryRepoName repository.
+type RegistryRepo struct {
+	// InstallationID is the ID of the GitHub App installation which can access
+	// the repository. If 0 the installation is found by the repository's name.
+	InstallationID int64 `json:",omitempty"`
+
+	// Owner of the repository
+	Owner string `json:",omitempty"`
+
+	// Name of the repository
+	Name string `json:",omitempty"`
+}
+
+// NewRegistryRepo creates a RegistryRepo from a repository full name, in the format
+// owner/name
+func NewRegistryRepo(installationID int64, fullName string) RegistryRepo {
+	repo := RegistryRepo{
+		InstallationID: installationID,
+	}
+
+	if parts := strings.SplitN(fullName, "/", 2); len(parts) == 2 {
+		repo.Owner = parts[0]
+		repo.Name = parts[1]
+	}
+
+	return repo
+}
+
+// FullName returns the lowercase full name of the repository, in the format
+// owner/name. Empty for the zero value.
+func (r RegistryRepo) FullName() string {
+	if len(r.Owner) == 0 && len(r.Name) == 0 {
+		return ""
+	}
+
+	return strings.ToLower(fmt.Sprintf("%s/%s", r.Owner, r.Name))
+}
+
+// resolve returns the configured registry repository if r has no name
+func (r RegistryRepo) resolve(cfg *config.Config) RegistryRepo {
+	if len(r.FullName()) == 0 {
+		r.Owner = cfg.GhRegistryRepoOwner
+		r.Name = cfg.GhRegistryRepoName
+	}
+
+	return r
+}
+
+// isDefault returns true if r is the configured registry repository
+func (r RegistryRepo) isDefault(cfg *config.Config) bool {
+	return r.resolve(cfg).FullName() == cfg.RegistryRepos()[0]
+}
+
+// RegistryFilter matches documents, in the apps or submissions collections, which
+// belong to a registry repository. Documents saved before the registry repository
+// was recorded belong to the configured registry repository.
+func RegistryFilter(cfg *config.Config, fullName string) bson.E {
+	fullName = strings.ToLower(fullName)
+
+	if fullName == cfg.RegistryRepos()[0] {
+		return bson.E{"registry", bson.D{{"$in", bson.A{fullName, nil}}}}
+	}
+
+	return bson.E{"registry", fullName}
+}
+
+// RegistryClients creates clients which access registry repositories
+type RegistryClients struct {
+	// Cfg is the server configuration
+	Cfg *config.Config
+
+	// SCM accesses the configured registry repository
+	SCM scm.Provider
+
+	// GH is a GitHub API client for the configured registry repository. Nil if
+	// the registry repository is not on GitHub.
+	GH *github.Client
+
+	// GhClients creates clients for GitHub App installations. Nil if the
+	// registry repository is not on GitHub.
+	GhClients *ghapp.Clients
+}
+
+// Get returns clients for a registry repository. The zero value is resolved to the
+// configured registry repository and returned. Returns an error if repo is not one
+// of the registry repositories.
+func (c RegistryClients) Get(ctx context.Context,
+	repo RegistryRepo) (RegistryRepo, scm.Provider, *github.Client, error) {
+
+	repo = repo.resolve(c.Cfg)
+
+	if !c.Cfg.IsRegistryRepo(repo.FullName()) {
+		return repo, nil, nil, fmt.Errorf("%s is not a registry repository",
+			repo.FullName())
+	}
+
+	// {{{1 Configured registry repository
+	if repo.isDefault(c.Cfg) && repo.InstallationID == 0 {
+		return repo, c.SCM, c.GH, nil
+	}
+
+	// {{{1 Repository of an installation
+	if c.GhClients == nil {
+		return repo, nil, nil, fmt.Errorf("cannot access registry repository "+
+			"%s without GitHub App clients", repo.FullName())
+	}
+
+	var gh *github.Client
+	var err error
+
+	if repo.InstallationID != 0 {
+		gh, err = c.GhClients.Installation(repo.InstallationID)
+	} else {
+		gh, err = c.GhClients.Repository(ctx, repo.Owner, repo.Name)
+	}
+	if err != nil {
+		return repo, nil, nil, fmt.Errorf("failed to get client for registry "+
+			"repository %s: %s", repo.FullName(), err.Error())
+	}
+
+	return repo, scm.GitHub{
+		Cfg:   c.Cfg,
+		GH:    gh,
+		Owner: repo.Owner,
+		Repo:  repo.Name,
+	}, gh, nil
+}
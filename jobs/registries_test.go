@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/kscout/serverless-registry-api/config"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// registriesTestCfg has a configured and an additional registry repository
+var registriesTestCfg = &config.Config{
+	ExternalURL:         url.URL{Scheme: "https", Host: "api.example.com"},
+	GhRegistryRepoOwner: "kscout",
+	GhRegistryRepoName:  "serverless-apps",
+	GhRegistryRepos:     []string{"other-org/apps"},
+}
+
+func TestNewRegistryRepo(t *testing.T) {
+	repo := NewRegistryRepo(42, "Other-Org/Apps")
+
+	assert.Equal(t, RegistryRepo{
+		InstallationID: 42,
+		Owner:          "Other-Org",
+		Name:           "Apps",
+	}, repo)
+	assert.Equal(t, "other-org/apps", repo.FullName())
+	assert.False(t, repo.isDefault(registriesTestCfg))
+
+	// Events without a repository have no full name
+	assert.Equal(t, RegistryRepo{InstallationID: 42}, NewRegistryRepo(42, ""))
+	assert.Equal(t, "", RegistryRepo{}.FullName())
+}
+
+func TestRegistryRepoResolve(t *testing.T) {
+	resolved := RegistryRepo{}.resolve(registriesTestCfg)
+	assert.Equal(t, "kscout/serverless-apps", resolved.FullName())
+	assert.True(t, RegistryRepo{}.isDefault(registriesTestCfg))
+
+	other := NewRegistryRepo(0, "other-org/apps")
+	assert.Equal(t, other, other.resolve(registriesTestCfg))
+}
+
+func TestRegistryFilter(t *testing.T) {
+	// Documents saved before the registry was recorded belong to the default
+	assert.Equal(t, bson.E{"registry", bson.D{{"$in",
+		bson.A{"kscout/serverless-apps", nil}}}},
+		RegistryFilter(registriesTestCfg, "KScout/serverless-apps"))
+
+	assert.Equal(t, bson.E{"registry", "other-org/apps"},
+		RegistryFilter(registriesTestCfg, "Other-Org/apps"))
+}
+
+func TestPreviewURL(t *testing.T) {
+	assert.Equal(t, "https://api.example.com/submissions/3/apps/hello/deploy.sh",
+		previewURL(registriesTestCfg, RegistryRepo{}, 3, "hello", "/deploy.sh"))
+
+	assert.Equal(t, "https://api.example.com/submissions/3/apps/hello/deploy.sh"+
+		"?registry=other-org%2Fapps", previewURL(registriesTestCfg,
+		NewRegistryRepo(0, "other-org/apps"), 3, "hello", "/deploy.sh"))
+}
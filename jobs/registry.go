@@ -0,0 +1,103 @@
+package jobs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// JobType describes a type of job which a JobRunner can run. Register job types
+// with JobRunner.Register.
+type JobType struct {
+	// Type identifies the job type
+	Type JobTypeT
+
+	// Job runs jobs of this type
+	Job Job
+
+	// NewDefinition returns a pointer to an empty value of the type of data the job
+	// accepts. Submitted data is decoded into this value as JSON, unknown fields
+	// are not allowed. If the value is a struct its `validate` field tags are
+	// checked. If nil the job does not accept data.
+	NewDefinition func() interface{}
+
+	// DefinitionOptional indicates that the job can be submitted without data
+	DefinitionOptional bool
+}
+
+// CheckDefinition ensures data is a valid definition for the job type
+func (t JobType) CheckDefinition(data []byte) error {
+	// {{{1 Check if data is provided
+	if len(data) == 0 {
+		if t.NewDefinition != nil && !t.DefinitionOptional {
+			return fmt.Errorf("%s jobs require data", t.Type)
+		}
+
+		return nil
+	}
+
+	if t.NewDefinition == nil {
+		return fmt.Errorf("%s jobs do not accept data", t.Type)
+	}
+
+	// {{{1 Decode
+	def := t.NewDefinition()
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(def); err != nil {
+		return fmt.Errorf("failed to decode data as %s job definition: %s", t.Type,
+			err.Error())
+	}
+
+	// {{{1 Validate
+	defValue := reflect.ValueOf(def)
+	if defValue.Kind() == reflect.Ptr {
+		defValue = defValue.Elem()
+	}
+
+	if defValue.Kind() == reflect.Struct {
+		if err := validator.New().Struct(def); err != nil {
+			return fmt.Errorf("invalid %s job definition: %s", t.Type, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Register adds a job type which the JobRunner can run. Returns an error if a job
+// type with the same name is already registered.
+func (r *JobRunner) Register(jobType JobType) error {
+	if len(jobType.Type) == 0 {
+		return fmt.Errorf("job type name cannot be empty")
+	}
+
+	if jobType.Job == nil {
+		return fmt.Errorf("job type %s must have a Job", jobType.Type)
+	}
+
+	r.jobTypesLock.Lock()
+	defer r.jobTypesLock.Unlock()
+
+	if _, ok := r.jobTypes[jobType.Type]; ok {
+		return fmt.Errorf("job type %s is already registered", jobType.Type)
+	}
+
+	r.jobTypes[jobType.Type] = jobType
+
+	return nil
+}
+
+// getJobType returns a registered job type, false if not registered
+func (r *JobRunner) getJobType(t JobTypeT) (JobType, bool) {
+	r.jobTypesLock.RLock()
+	defer r.jobTypesLock.RUnlock()
+
+	jobType, ok := r.jobTypes[t]
+
+	return jobType, ok
+}
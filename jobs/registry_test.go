@@ -0,0 +1,82 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kscout/serverless-registry-api/config"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/google/go-github/v26/github"
+	"github.com/stretchr/testify/assert"
+)
+
+type testJob struct{}
+
+func (j testJob) Do(ctx context.Context, data []byte) error {
+	return nil
+}
+
+type testJobDefinition struct {
+	Name string `json:"name" validate:"required"`
+}
+
+func TestJobTypeCheckDefinition(t *testing.T) {
+	withDef := JobType{
+		Type: "test",
+		Job:  testJob{},
+		NewDefinition: func() interface{} {
+			return &testJobDefinition{}
+		},
+	}
+
+	assert.NoError(t, withDef.CheckDefinition([]byte(`{"name": "foo"}`)))
+	assert.Error(t, withDef.CheckDefinition(nil), "data is required")
+	assert.Error(t, withDef.CheckDefinition([]byte(`{}`)), "name is required")
+	assert.Error(t, withDef.CheckDefinition([]byte(`{"name": "foo", "bar": 1}`)),
+		"unknown fields not allowed")
+	assert.Error(t, withDef.CheckDefinition([]byte(`not json`)))
+
+	withDef.DefinitionOptional = true
+	assert.NoError(t, withDef.CheckDefinition(nil))
+
+	withoutDef := JobType{
+		Type: "test",
+		Job:  testJob{},
+	}
+
+	assert.NoError(t, withoutDef.CheckDefinition(nil))
+	assert.Error(t, withoutDef.CheckDefinition([]byte(`{}`)))
+}
+
+func TestJobRunnerRegister(t *testing.T) {
+	runner := JobRunner{
+		jobTypes: map[JobTypeT]JobType{},
+	}
+
+	assert.NoError(t, runner.Register(JobType{Type: "test", Job: testJob{}}))
+	assert.Error(t, runner.Register(JobType{Type: "test", Job: testJob{}}),
+		"duplicate type")
+	assert.Error(t, runner.Register(JobType{Type: "", Job: testJob{}}))
+	assert.Error(t, runner.Register(JobType{Type: "other"}))
+
+	_, err := runner.Submit("unknown", nil)
+	assert.Error(t, err)
+}
+
+func TestEventJobTypesRegistered(t *testing.T) {
+	runner := &JobRunner{
+		Logger: golog.NewStdLogger("registry-test"),
+		Cfg:    &config.Config{},
+		GH:     github.NewClient(nil),
+	}
+	runner.Init()
+
+	// Tag and release events submit these job types without data
+	for _, jobType := range config.EventJobTypes {
+		registered, ok := runner.jobTypes[JobTypeT(jobType)]
+		if assert.True(t, ok, "%s is registered", jobType) {
+			assert.NoError(t, registered.CheckDefinition(nil), jobType)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+)
+
+// RollbackAppsJob swaps the current and previous generations of the apps collection.
+// Used to undo a bad update. Running the job again undoes the rollback.
+// The data argument passed to Do() is ignored.
+type RollbackAppsJob struct {
+	// Generations is used to swap generations of the apps collection
+	Generations AppsGenerations
+}
+
+// Do implements Job
+func (j RollbackAppsJob) Do(ctx context.Context, data []byte) error {
+	generations := j.Generations
+	generations.Ctx = ctx
+
+	if err := generations.Rollback(); err != nil {
+		return fmt.Errorf("failed to rollback apps collection: %s", err.Error())
+	}
+
+	return nil
+}
@@ -3,12 +3,20 @@ package jobs
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/kscout/serverless-registry-api/config"
+	"github.com/kscout/serverless-registry-api/events"
+	"github.com/kscout/serverless-registry-api/ghapp"
 	"github.com/kscout/serverless-registry-api/metrics"
+	"github.com/kscout/serverless-registry-api/outbox"
+	"github.com/kscout/serverless-registry-api/scm"
+	"github.com/kscout/serverless-registry-api/verification"
 
 	"github.com/Noah-Huppert/golog"
 	"github.com/google/go-github/v26/github"
+	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -18,12 +26,19 @@ type JobTypeT string
 
 // Job types identify different jobs which can be run
 const (
-	JobTypeUpdateApps JobTypeT = "update_apps"
-	JobTypeValidate            = "validate"
+	JobTypeUpdateApps        JobTypeT = "update_apps"
+	JobTypeValidate                   = "validate"
+	JobTypeStalePRSweep               = "stale_pr_sweep"
+	JobTypeRollbackApps               = "rollback_apps"
+	JobTypeCleanupSubmission          = "cleanup_submission"
+	JobTypeCommand                    = "command"
 )
 
 // JobStartRequest provides informtion required to start a job
 type JobStartRequest struct {
+	// ID uniquely identifies the job
+	ID string
+
 	// Type of job to start
 	Type JobTypeT
 
@@ -33,6 +48,9 @@ type JobStartRequest struct {
 	// CompleteChan will close when the job has been completed. This
 	// does not guarantee the job finished successfully
 	CompleteChan chan interface{}
+
+	// status records the execution of the job
+	status *JobStatus
 }
 
 // JobRunner manages starting jobs and shutting down gracefully
@@ -40,8 +58,17 @@ type JobRunner struct {
 	// queue is a channel to which requests to start jobs are sent
 	queue chan *JobStartRequest
 
-	// jobInstances holds jobs which can be run
-	jobInstances map[JobTypeT]Job
+	// jobTypes holds the types of jobs which can be run, keys are type names
+	jobTypes map[JobTypeT]JobType
+
+	// jobTypesLock protects jobTypes
+	jobTypesLock sync.RWMutex
+
+	// statuses holds the statuses of the most recently submitted jobs, oldest first
+	statuses []*JobStatus
+
+	// statusesLock protects statuses
+	statusesLock sync.Mutex
 
 	// Ctx
 	Ctx context.Context
@@ -55,84 +82,299 @@ type JobRunner struct {
 	// Metrics holds internal Prometheus metrics recorders
 	Metrics metrics.Metrics
 
-	// GH is a GitHub API client
+	// SCM accesses the configured registry repository
+	SCM scm.Provider
+
+	// GH is a GitHub API client for the configured registry repository. Nil if
+	// the registry repository is not on GitHub, in which case the GitHub only job
+	// types are not registered.
 	GH *github.Client
 
+	// GhClients creates GitHub API clients for the installations which can access
+	// other registry repositories. Nil if the registry repository is not on
+	// GitHub.
+	GhClients *ghapp.Clients
+
 	// MDbApps is used to access the apps collection
 	MDbApps *mongo.Collection
+
+	// MDbAppsStaging is used to access the apps_staging collection
+	MDbAppsStaging *mongo.Collection
+
+	// MDbAppsPrevious is used to access the apps_previous collection
+	MDbAppsPrevious *mongo.Collection
+
+	// MDbSyncState is used to access the sync_state collection
+	MDbSyncState *mongo.Collection
+
+	// MDbSubmissions is used to access the submissions collection
+	MDbSubmissions *mongo.Collection
+
+	// Outbox is used to reliably send requests to external services
+	Outbox outbox.Outbox
+
+	// Events is used to emit CloudEvents
+	Events events.Emitter
+
+	// Verifier manages the verification statuses of apps
+	Verifier verification.Verifier
 }
 
-// Init initializes a JobRunner. The Submit() and Run() methods will not work properly
-// unless this method is called.
+// Init initializes a JobRunner and registers the built in job types. The Register(),
+// Submit() and Run() methods will not work properly unless this method is called.
 func (r *JobRunner) Init() {
 	r.queue = make(chan *JobStartRequest)
+	r.jobTypes = map[JobTypeT]JobType{}
 
-	r.jobInstances = map[JobTypeT]Job{}
-	r.jobInstances[JobTypeUpdateApps] = UpdateAppsJob{
-		Ctx:     r.Ctx,
-		Cfg:     r.Cfg,
-		GH:      r.GH,
-		MDbApps: r.MDbApps,
+	generations := AppsGenerations{
+		MDbApps:         r.MDbApps,
+		MDbAppsStaging:  r.MDbAppsStaging,
+		MDbAppsPrevious: r.MDbAppsPrevious,
+		MDbSyncState:    r.MDbSyncState,
 	}
-	r.jobInstances[JobTypeValidate] = ValidateJob{
-		Ctx:    r.Ctx,
-		Logger: r.Logger.GetChild("job.validate"),
-		Cfg:    r.Cfg,
-		GH:     r.GH,
+
+	registries := RegistryClients{
+		Cfg:       r.Cfg,
+		SCM:       r.SCM,
+		GH:        r.GH,
+		GhClients: r.GhClients,
+	}
+
+	builtinTypes := []JobType{
+		JobType{
+			Type: JobTypeUpdateApps,
+			Job: UpdateAppsJob{
+				Cfg:         r.Cfg,
+				Registries:  registries,
+				Generations: generations,
+				Metrics:     r.Metrics,
+				Outbox:      r.Outbox,
+				Events:      r.Events,
+				Verifier:    r.Verifier,
+			},
+			NewDefinition: func() interface{} {
+				return &UpdateAppsJobDefinition{}
+			},
+			DefinitionOptional: true,
+		},
+		JobType{
+			Type: JobTypeRollbackApps,
+			Job: RollbackAppsJob{
+				Generations: generations,
+			},
+		},
+		JobType{
+			Type: JobTypeValidate,
+			Job: ValidateJob{
+				Logger:         r.Logger.GetChild("job.validate"),
+				Cfg:            r.Cfg,
+				Registries:     registries,
+				Events:         r.Events,
+				MDbSubmissions: r.MDbSubmissions,
+				MDbApps:        r.MDbApps,
+			},
+			// Accepts GitHub pull requests, which scm.MergeRequest is a
+			// subset of
+			NewDefinition: func() interface{} {
+				return &github.PullRequest{}
+			},
+		},
+		JobType{
+			Type: JobTypeCleanupSubmission,
+			Job: CleanupSubmissionJob{
+				Cfg:            r.Cfg,
+				MDbSubmissions: r.MDbSubmissions,
+			},
+			NewDefinition: func() interface{} {
+				return &CleanupSubmissionJobDefinition{}
+			},
+		},
+	}
+
+	// Commands and sweeps use GitHub features
+	if r.GH != nil {
+		builtinTypes = append(builtinTypes,
+			JobType{
+				Type: JobTypeCommand,
+				Job: CommandJob{
+					Logger:         r.Logger.GetChild("job.command"),
+					Cfg:            r.Cfg,
+					Registries:     registries,
+					JobRunner:      r,
+					MDbSubmissions: r.MDbSubmissions,
+				},
+				NewDefinition: func() interface{} {
+					return &CommandJobDefinition{}
+				},
+			},
+			JobType{
+				Type: JobTypeStalePRSweep,
+				Job: StalePRSweepJob{
+					Logger:         r.Logger.GetChild("job.stale-pr-sweep"),
+					Cfg:            r.Cfg,
+					Registries:     registries,
+					JobRunner:      r,
+					MDbSubmissions: r.MDbSubmissions,
+				},
+			})
+	}
+
+	for _, jobType := range builtinTypes {
+		if err := r.Register(jobType); err != nil {
+			r.Logger.Fatalf("failed to register built in job type: %s", err.Error())
+		}
 	}
 }
 
-// Submit new job
-func (r JobRunner) Submit(t JobTypeT, data []byte) *JobStartRequest {
+// Submit new job. Returns an error if the job type is not registered or if data
+// is not a valid definition for the job type.
+func (r *JobRunner) Submit(t JobTypeT, data []byte) (*JobStartRequest, error) {
+	// {{{1 Check job type and definition
+	jobType, ok := r.getJobType(t)
+	if !ok {
+		return nil, fmt.Errorf("unknown job type: %s", t)
+	}
+
+	if err := jobType.CheckDefinition(data); err != nil {
+		return nil, err
+	}
+
+	// {{{1 Queue job
 	req := JobStartRequest{
+		ID:           uuid.New().String(),
 		Type:         t,
 		Data:         data,
 		CompleteChan: make(chan interface{}),
 	}
 
+	req.status = &JobStatus{
+		ID:          req.ID,
+		Type:        t,
+		State:       JobStateQueued,
+		SubmittedAt: time.Now(),
+	}
+	r.recordStatus(req.status)
+
 	r.queue <- &req
 
-	return &req
+	return &req, nil
 }
 
-// Run reads requests off the Queue and starts go routines to run jobs
+// Run reads requests off the Queue and runs jobs one at a time.
 // If the JobRunner.Ctx is canceled JobRunner will stop accepting jobs and
 // return when there are no more jobs running.
 // Should be run in a goroutine b/c this method blocks to run jobs.
-func (r JobRunner) Run() {
+func (r *JobRunner) Run() {
 	for {
 		select {
 		case <-r.Ctx.Done():
 			return
 
 		case req := <-r.queue:
-			// Pre-metrics
-			durationTimer := r.Metrics.StartTimer()
+			r.runJob(req)
+		}
+	}
+}
 
-			// Run job
-			job, ok := r.jobInstances[req.Type]
-			if !ok {
-				r.Logger.Fatalf("cannot handle job type: %s", req.Type)
-			}
+// Timeout returns the maximum duration a job of a type may run for
+func (r *JobRunner) Timeout(t JobTypeT) time.Duration {
+	if timeout, ok := r.Cfg.JobTimeouts[string(t)]; ok {
+		return timeout
+	}
 
-			jobSuccessful := "1"
+	return r.Cfg.JobDefaultTimeout
+}
 
-			if err := job.Do(req.Data); err != nil {
-				r.Logger.Errorf("failed to run %s job: %s",
-					req.Type, err.Error())
+// runJob runs the job for a request with a context which is canceled when the
+// job's timeout is reached or when the job is canceled via Cancel()
+func (r *JobRunner) runJob(req *JobStartRequest) {
+	defer close(req.CompleteChan)
 
-				jobSuccessful = "0"
-			}
+	// {{{1 Pre-metrics
+	durationTimer := r.Metrics.StartTimer()
+
+	// {{{1 Get job
+	// Submit() ensures the job type is registered
+	jobType, _ := r.getJobType(req.Type)
+	job := jobType.Job
+
+	// {{{1 Setup job context
+	ctx, cancel := context.WithTimeout(r.Ctx, r.Timeout(req.Type))
+	defer cancel()
+
+	// Skip job if it was canceled while queued
+	skip := false
+
+	r.updateStatus(req.status, func(status *JobStatus) {
+		if status.State == JobStateCanceled {
+			skip = true
+			return
+		}
+
+		startedAt := time.Now()
+		status.StartedAt = &startedAt
+		status.State = JobStateRunning
+		status.cancel = cancel
+	})
 
-			close(req.CompleteChan)
-			r.Logger.Debugf("ran %s job", req.Type)
+	if skip {
+		r.Logger.Debugf("skipped %s job %s which was canceled before it started",
+			req.Type, req.ID)
+		return
+	}
+
+	// {{{1 Run job
+	jobSuccessful := "1"
+	jobState := JobStateT(JobStateSucceeded)
+	jobErr := ""
+	var jobFailures map[string]string
+
+	if err := job.Do(ctx, req.Data); err != nil {
+		if partialErr, ok := err.(PartialSuccessError); ok {
+			r.Logger.Warnf("%s job partially succeeded: %s",
+				req.Type, err.Error())
+
+			jobState = JobStatePartiallySucceeded
+			jobFailures = partialErr.Failures
+
+			r.Metrics.JobsPartialSuccessesTotal.With(prometheus.Labels{
+				"job_type": fmt.Sprintf("%s", req.Type),
+			}).Inc()
+		} else {
+			jobSuccessful = "0"
+			jobState = JobStateFailed
+			jobErr = err.Error()
+
+			if ctx.Err() == context.DeadlineExceeded {
+				jobErr = fmt.Sprintf("exceeded %s deadline: %s",
+					r.Timeout(req.Type), err.Error())
+			}
 
-			// Post-metrics
-			durationTimer.Finish(r.Metrics.JobsRunDurationsMilliseconds.
-				With(prometheus.Labels{
-					"job_type":   fmt.Sprintf("%s", req.Type),
-					"successful": jobSuccessful,
-				}))
+			r.Logger.Errorf("failed to run %s job: %s", req.Type, jobErr)
 		}
 	}
+
+	r.updateStatus(req.status, func(status *JobStatus) {
+		finishedAt := time.Now()
+		status.FinishedAt = &finishedAt
+		status.cancel = nil
+
+		// Keep canceled state set by Cancel()
+		if status.State == JobStateCanceled {
+			return
+		}
+
+		status.State = jobState
+		status.Error = jobErr
+		status.Failures = jobFailures
+	})
+
+	r.Logger.Debugf("ran %s job", req.Type)
+
+	// {{{1 Post-metrics
+	durationTimer.Finish(r.Metrics.JobsRunDurationsMilliseconds.
+		With(prometheus.Labels{
+			"job_type":   fmt.Sprintf("%s", req.Type),
+			"successful": jobSuccessful,
+		}))
 }
@@ -0,0 +1,185 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Noah-Huppert/golog"
+)
+
+// Schedule submits a job every time a cron expression matches
+type Schedule struct {
+	// Name identifies the schedule
+	Name string
+
+	// Cron determines when the job will be submitted
+	Cron *CronSchedule
+
+	// Type of job to submit
+	Type JobTypeT
+
+	// Data to submit job with
+	Data []byte
+
+	// LastRun is the last time the job was submitted, nil if never submitted
+	LastRun *time.Time
+
+	// NextRun is the next time the job will be submitted
+	NextRun time.Time
+}
+
+// ScheduleStatus is the user facing state of a Schedule
+type ScheduleStatus struct {
+	// Name identifies the schedule
+	Name string `json:"name"`
+
+	// Cron is the schedule's cron expression
+	Cron string `json:"cron"`
+
+	// JobType is the type of job the schedule submits
+	JobType JobTypeT `json:"job_type"`
+
+	// LastRun is the last time the job was submitted, nil if never submitted
+	LastRun *time.Time `json:"last_run"`
+
+	// NextRun is the next time the job will be submitted
+	NextRun time.Time `json:"next_run"`
+}
+
+// Scheduler submits jobs to a JobRunner on cron schedules
+type Scheduler struct {
+	// Ctx is the server context, when canceled the scheduler stops
+	Ctx context.Context
+
+	// Logger
+	Logger golog.Logger
+
+	// JobRunner is used to run scheduled jobs
+	JobRunner *JobRunner
+
+	// schedules holds all schedules which have been added
+	schedules []*Schedule
+
+	// lock protects schedules
+	lock sync.Mutex
+}
+
+// Add a job schedule. The spec argument is a cron expression, see CronSchedule for
+// the format. If spec is empty the schedule is not added and no error is returned,
+// this allows schedules to be disabled via configuration.
+func (s *Scheduler) Add(name, spec string, t JobTypeT, data []byte) error {
+	if len(spec) == 0 {
+		s.Logger.Debugf("%s schedule disabled", name)
+		return nil
+	}
+
+	cron, err := ParseCronSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("failed to parse cron expression \"%s\" for %s "+
+			"schedule: %s", spec, name, err.Error())
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.schedules = append(s.schedules, &Schedule{
+		Name:    name,
+		Cron:    cron,
+		Type:    t,
+		Data:    data,
+		NextRun: cron.Next(time.Now()),
+	})
+
+	return nil
+}
+
+// Status returns the state of all schedules
+func (s *Scheduler) Status() []ScheduleStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	statuses := []ScheduleStatus{}
+
+	for _, schedule := range s.schedules {
+		statuses = append(statuses, ScheduleStatus{
+			Name:    schedule.Name,
+			Cron:    schedule.Cron.Spec,
+			JobType: schedule.Type,
+			LastRun: schedule.LastRun,
+			NextRun: schedule.NextRun,
+		})
+	}
+
+	return statuses
+}
+
+// Run submits jobs when their schedules match. Returns when Scheduler.Ctx is canceled.
+// Should be run in a goroutine b/c this method blocks.
+func (s *Scheduler) Run() {
+	for {
+		// {{{1 Wait until the next schedule is due
+		timer := time.NewTimer(s.untilNextRun())
+
+		select {
+		case <-s.Ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		// {{{1 Submit due jobs
+		now := time.Now()
+
+		s.lock.Lock()
+		for _, schedule := range s.schedules {
+			if schedule.NextRun.IsZero() || now.Before(schedule.NextRun) {
+				continue
+			}
+
+			s.Logger.Debugf("submitting %s job for %s schedule", schedule.Type,
+				schedule.Name)
+
+			// Submit in a goroutine so a busy JobRunner does not delay
+			// other schedules
+			go func(schedule Schedule) {
+				_, err := s.JobRunner.Submit(schedule.Type, schedule.Data)
+				if err != nil {
+					s.Logger.Errorf("failed to submit %s job for %s schedule: %s",
+						schedule.Type, schedule.Name, err.Error())
+				}
+			}(*schedule)
+
+			lastRun := now
+			schedule.LastRun = &lastRun
+			schedule.NextRun = schedule.Cron.Next(now)
+		}
+		s.lock.Unlock()
+	}
+}
+
+// untilNextRun returns the duration until the soonest schedule is due. If there
+// are no schedules returns a long duration so Run can check again later.
+func (s *Scheduler) untilNextRun() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	wait := time.Hour
+
+	for _, schedule := range s.schedules {
+		if schedule.NextRun.IsZero() {
+			continue
+		}
+
+		if until := time.Until(schedule.NextRun); until < wait {
+			wait = until
+		}
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+
+	return wait
+}
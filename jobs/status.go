@@ -0,0 +1,160 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxJobStatuses is the number of most recent job statuses a JobRunner remembers
+const maxJobStatuses = 100
+
+// JobStateT indicates the stage of execution a job is in
+type JobStateT string
+
+// Job states
+const (
+	JobStateQueued             JobStateT = "queued"
+	JobStateRunning                      = "running"
+	JobStateSucceeded                    = "succeeded"
+	JobStatePartiallySucceeded           = "partially_succeeded"
+	JobStateFailed                       = "failed"
+	JobStateCanceled                     = "canceled"
+)
+
+// JobStatus records the execution of a job
+type JobStatus struct {
+	// ID uniquely identifies the job
+	ID string `json:"id"`
+
+	// Type of job
+	Type JobTypeT `json:"type"`
+
+	// State of job
+	State JobStateT `json:"state"`
+
+	// SubmittedAt is the time the job was submitted
+	SubmittedAt time.Time `json:"submitted_at"`
+
+	// StartedAt is the time the job started running, nil if not started
+	StartedAt *time.Time `json:"started_at"`
+
+	// FinishedAt is the time the job stopped running, nil if not finished
+	FinishedAt *time.Time `json:"finished_at"`
+
+	// Error which caused the job to fail, empty if the job did not fail
+	Error string `json:"error,omitempty"`
+
+	// Failures holds the items which failed if State is JobStatePartiallySucceeded.
+	// Keys identify items, values are reasons.
+	Failures map[string]string `json:"failures,omitempty"`
+
+	// cancel cancels the job's context, nil if the job is not running
+	cancel context.CancelFunc
+}
+
+// PartialSuccessError is returned by Job.Do when some items the job processed
+// failed but the job was still able to complete its work for the rest.
+type PartialSuccessError struct {
+	// Failures holds the items which failed. Keys identify items, values
+	// are reasons.
+	Failures map[string]string
+}
+
+// Error implements error
+func (e PartialSuccessError) Error() string {
+	keys := []string{}
+	for key, _ := range e.Failures {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	failures := []string{}
+	for _, key := range keys {
+		failures = append(failures, fmt.Sprintf("%s: %s", key, e.Failures[key]))
+	}
+
+	return fmt.Sprintf("%d item(s) failed: %s", len(e.Failures),
+		strings.Join(failures, "; "))
+}
+
+// recordStatus adds a status to the list of recent statuses, forgetting the oldest
+// if there are more than maxJobStatuses.
+func (r *JobRunner) recordStatus(status *JobStatus) {
+	r.statusesLock.Lock()
+	defer r.statusesLock.Unlock()
+
+	r.statuses = append(r.statuses, status)
+
+	if len(r.statuses) > maxJobStatuses {
+		r.statuses = r.statuses[len(r.statuses)-maxJobStatuses:]
+	}
+}
+
+// updateStatus safely modifies a job status
+func (r *JobRunner) updateStatus(status *JobStatus, update func(status *JobStatus)) {
+	r.statusesLock.Lock()
+	defer r.statusesLock.Unlock()
+
+	update(status)
+}
+
+// Statuses returns the statuses of the most recently submitted jobs, newest first
+func (r *JobRunner) Statuses() []JobStatus {
+	r.statusesLock.Lock()
+	defer r.statusesLock.Unlock()
+
+	statuses := []JobStatus{}
+	for i := len(r.statuses) - 1; i >= 0; i-- {
+		statuses = append(statuses, *r.statuses[i])
+	}
+
+	return statuses
+}
+
+// Status returns the status of a job, nil if a job with the ID was not found
+func (r *JobRunner) Status(id string) *JobStatus {
+	r.statusesLock.Lock()
+	defer r.statusesLock.Unlock()
+
+	for _, status := range r.statuses {
+		if status.ID == id {
+			statusCopy := *status
+			return &statusCopy
+		}
+	}
+
+	return nil
+}
+
+// Cancel stops a job. If the job is queued it will not be run. If the job is running
+// its context is canceled. Returns an error if the job does not exist or
+// has already finished.
+func (r *JobRunner) Cancel(id string) error {
+	r.statusesLock.Lock()
+	defer r.statusesLock.Unlock()
+
+	for _, status := range r.statuses {
+		if status.ID != id {
+			continue
+		}
+
+		switch status.State {
+		case JobStateQueued:
+		case JobStateRunning:
+			if status.cancel != nil {
+				status.cancel()
+			}
+		default:
+			return fmt.Errorf("job is %s", status.State)
+		}
+
+		status.State = JobStateCanceled
+
+		return nil
+	}
+
+	return fmt.Errorf("job not found")
+}
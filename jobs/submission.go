@@ -0,0 +1,138 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kscout/serverless-registry-api/config"
+	"github.com/kscout/serverless-registry-api/models"
+	"github.com/kscout/serverless-registry-api/parsing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// newSubmission creates a submission from the result of validating a pull request in
+// a registry repository
+func newSubmission(registry string, prNumber int, headSHA string,
+	apps map[string]*models.App,
+	parseErrs map[string][]parsing.ParseError, deletedAppIDs []string,
+	conclusion string) models.Submission {
+
+	submission := models.Submission{
+		PRNumber:      prNumber,
+		Registry:      registry,
+		HeadSHA:       headSHA,
+		Apps:          map[string]*models.SubmissionApp{},
+		DeletedAppIDs: deletedAppIDs,
+		ValidatedAt:   time.Now(),
+	}
+
+	switch conclusion {
+	case "success":
+		submission.Status = models.SubmissionStatusValid
+	case "failure":
+		submission.Status = models.SubmissionStatusInvalid
+	default:
+		submission.Status = models.SubmissionStatusInternalError
+	}
+
+	for appID, app := range apps {
+		submission.Apps[appID] = &models.SubmissionApp{
+			App: app,
+			VerificationStatus: models.AppVerificationStatus{
+				FormatCorrect: true,
+			},
+			ParseErrors: []models.SubmissionParseError{},
+		}
+	}
+
+	for appID, errs := range parseErrs {
+		submissionApp := &models.SubmissionApp{
+			ParseErrors: []models.SubmissionParseError{},
+		}
+
+		for _, err := range errs {
+			submissionApp.ParseErrors = append(submissionApp.ParseErrors,
+				models.SubmissionParseError{
+					Code:            err.ErrorCode(),
+					What:            err.What,
+					Why:             err.Why,
+					FixInstructions: err.FixInstructions,
+					Internal:        err.InternalError != nil,
+				})
+		}
+
+		submission.Apps[appID] = submissionApp
+	}
+
+	return submission
+}
+
+// saveSubmission upserts a submission into the submissions collection. The
+// registryFilter must match the submission's registry repository, see
+// RegistryFilter.
+func saveSubmission(ctx context.Context, mDbSubmissions *mongo.Collection,
+	registryFilter bson.E, submission models.Submission) error {
+
+	upsertTrue := true
+	_, err := mDbSubmissions.ReplaceOne(ctx, bson.D{
+		{"pr_number", submission.PRNumber},
+		registryFilter,
+	}, submission, &options.ReplaceOptions{
+		Upsert: &upsertTrue,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save submission for PR #%d in db: %s",
+			submission.PRNumber, err.Error())
+	}
+
+	return nil
+}
+
+// CleanupSubmissionJobDefinition specifies which submission a CleanupSubmissionJob
+// removes
+type CleanupSubmissionJobDefinition struct {
+	// PRNumber is the number of the closed pull request
+	PRNumber int `validate:"required"`
+
+	// Registry is the registry repository the pull request was made in.
+	// Optional, defaults to the configured registry repository.
+	Registry RegistryRepo
+}
+
+// CleanupSubmissionJob removes the submission, and with it the app previews, of a
+// pull request which was closed.
+// The data field must be a JSON encoded CleanupSubmissionJobDefinition.
+type CleanupSubmissionJob struct {
+	// Cfg is the server configuration
+	Cfg *config.Config
+
+	// MDbSubmissions is used to access the submissions collection
+	MDbSubmissions *mongo.Collection
+}
+
+// Do implements Job
+func (j CleanupSubmissionJob) Do(ctx context.Context, data []byte) error {
+	var jobDef CleanupSubmissionJobDefinition
+	if err := json.Unmarshal(data, &jobDef); err != nil {
+		return fmt.Errorf("failed to decode data field as "+
+			"CleanupSubmissionJobDefinition JSON: %s", err.Error())
+	}
+
+	registry := jobDef.Registry.resolve(j.Cfg).FullName()
+
+	_, err := j.MDbSubmissions.DeleteOne(ctx, bson.D{
+		{"pr_number", jobDef.PRNumber},
+		RegistryFilter(j.Cfg, registry),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete submission for PR #%d from db: %s",
+			jobDef.PRNumber, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kscout/serverless-registry-api/config"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/google/go-github/v26/github"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StalePRSweepJob finds open pull requests in each registry repository whose head
+// commit has no completed validation check run and submits a validate job for each.
+// Submissions of pull requests which are no longer open are deleted. This recovers
+// from missed webhooks. The data argument passed to Do() is ignored.
+type StalePRSweepJob struct {
+	// Logger
+	Logger golog.Logger
+
+	// Cfg is the server configuration
+	Cfg *config.Config
+
+	// Registries accesses registry repositories
+	Registries RegistryClients
+
+	// JobRunner is used to submit validate jobs
+	JobRunner *JobRunner
+
+	// MDbSubmissions is used to access the submissions collection
+	MDbSubmissions *mongo.Collection
+}
+
+// Do implements Job
+func (j StalePRSweepJob) Do(ctx context.Context, data []byte) error {
+	for _, fullName := range j.Cfg.RegistryRepos() {
+		repo, _, gh, err := j.Registries.Get(ctx, NewRegistryRepo(0, fullName))
+		if err != nil {
+			return err
+		}
+
+		if err := j.sweep(ctx, repo, gh); err != nil {
+			return fmt.Errorf("failed to sweep registry repository %s: %s",
+				repo.FullName(), err.Error())
+		}
+	}
+
+	return nil
+}
+
+// sweep validates the stale pull requests of one registry repository
+func (j StalePRSweepJob) sweep(ctx context.Context, repo RegistryRepo,
+	gh *github.Client) error {
+
+	// {{{1 Get open pull requests
+	prs := []*github.PullRequest{}
+
+	listOpts := &github.PullRequestListOptions{
+		State: "open",
+		ListOptions: github.ListOptions{
+			PerPage: 100,
+		},
+	}
+
+	for {
+		page, resp, err := gh.PullRequests.List(ctx, repo.Owner, repo.Name,
+			listOpts)
+		if err != nil {
+			return fmt.Errorf("failed to list open pull requests: %s", err.Error())
+		}
+
+		prs = append(prs, page...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		listOpts.Page = resp.NextPage
+	}
+
+	// {{{1 Delete submissions of closed PRs
+	openPRNumbers := []int{}
+	for _, pr := range prs {
+		openPRNumbers = append(openPRNumbers, *pr.Number)
+	}
+
+	_, err := j.MDbSubmissions.DeleteMany(ctx, bson.D{
+		{"pr_number", bson.D{{"$nin", openPRNumbers}}},
+		RegistryFilter(j.Cfg, repo.FullName()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete submissions of closed PRs: %s",
+			err.Error())
+	}
+
+	// {{{1 Submit validate job for each PR without a completed check run
+	checkRunName := ValidateCheckRunName
+	checkRunStatus := "completed"
+
+	for _, pr := range prs {
+		checkRuns, _, err := gh.Checks.ListCheckRunsForRef(ctx, repo.Owner,
+			repo.Name, *pr.Head.SHA,
+			&github.ListCheckRunsOptions{
+				CheckName: &checkRunName,
+				Status:    &checkRunStatus,
+			})
+		if err != nil {
+			return fmt.Errorf("failed to list check runs for PR #%d: %s",
+				*pr.Number, err.Error())
+		}
+
+		if checkRuns.GetTotal() > 0 {
+			continue
+		}
+
+		prBytes, err := json.Marshal(*pr)
+		if err != nil {
+			return fmt.Errorf("failed to marshal PR #%d into JSON: %s",
+				*pr.Number, err.Error())
+		}
+
+		j.Logger.Infof("PR #%d has not been validated at %s, submitting "+
+			"validate job", *pr.Number, *pr.Head.SHA)
+
+		// Submit in a goroutine b/c the JobRunner does not accept new jobs
+		// until this one has finished
+		go func(prNum int) {
+			if _, err := j.JobRunner.Submit(JobTypeValidate, prBytes); err != nil {
+				j.Logger.Errorf("failed to submit validate job for PR #%d: %s",
+					prNum, err.Error())
+			}
+		}(*pr.Number)
+	}
+
+	return nil
+}
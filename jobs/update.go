@@ -4,17 +4,17 @@ import (
 	"fmt"
 	"context"
 	"strings"
-	"net/http"
-	"bytes"
 	"encoding/json"
-	"io/ioutil"
+	"time"
 	
 	"github.com/kscout/serverless-registry-api/config"
+	"github.com/kscout/serverless-registry-api/events"
+	"github.com/kscout/serverless-registry-api/metrics"
 	"github.com/kscout/serverless-registry-api/parsing"
 	"github.com/kscout/serverless-registry-api/models"
-	"github.com/kscout/serverless-registry-api/req"
+	"github.com/kscout/serverless-registry-api/outbox"
+	"github.com/kscout/serverless-registry-api/verification"
 	
-	"github.com/google/go-github/v26/github"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/bson"
@@ -25,26 +25,56 @@ type UpdateAppsJobDefinition struct {
 	// NoBotAPINotify when true indicates that the job should not make a request 
 	// to the bot API new apps endpoint
 	NoBotAPINotify bool
+
+	// Full when true indicates that every app should be re-parsed. Otherwise only
+	// apps which changed since the last synchronized commit are re-parsed.
+	Full bool
+
+	// OutboxBatch is recorded on the notifications the job creates, so they can
+	// be delivered with outbox.Outbox.DeliverBatch. Optional.
+	OutboxBatch string `json:",omitempty"`
+
+	// Registry is the registry repository whose apps are updated. Optional,
+	// defaults to the configured registry repository.
+	Registry RegistryRepo
 }
 
-// UpdateAppsJob updates the apps collection based on the current master branch state
+// UpdateAppsJob updates the apps collection based on the current state of a
+// registry repository branch. Only the apps from that registry repository are
+// changed. App IDs are unique across registry repositories, apps whose IDs are used
+// by another registry repository fail to update.
+// The bot API is sent the apps which were created, updated, and deleted via the
+// outbox. A CloudEvent is emitted for each of these apps.
+// The commit which was last synchronized with each registry repository is stored in
+// the sync_state collection. Only apps which changed since this commit are updated,
+// unless a full update is requested or the changes can not be determined.
+// Apps keep their verification status while their version is unchanged.
 // The data field is optional. If provided must be a JSON encoded UpdateAppsJobDefinition.
 type UpdateAppsJob struct {
-	// Ctx
-	Ctx context.Context
-	
 	// Cfg is the server configuration
 	Cfg *config.Config
 	
-	// GH is a GitHub API client
-	GH *github.Client
+	// Registries accesses registry repositories
+	Registries RegistryClients
+
+	// Generations is used to update the apps collection atomically
+	Generations AppsGenerations
+
+	// Metrics holds internal Prometheus metrics recorders
+	Metrics metrics.Metrics
+
+	// Outbox is used to notify the bot API of changes
+	Outbox outbox.Outbox
+
+	// Events is used to emit CloudEvents when apps change
+	Events events.Emitter
 
-	// MDbApps is used to access the apps collection
-	MDbApps *mongo.Collection
+	// Verifier is used to keep the verification statuses of apps
+	Verifier verification.Verifier
 }
 
 // Do job actions
-func (j UpdateAppsJob) Do(data []byte) error {
+func (j UpdateAppsJob) Do(ctx context.Context, data []byte) error {
 	// {{{1 Parse data field if provided
 	var jobDef UpdateAppsJobDefinition
 	
@@ -55,43 +85,145 @@ func (j UpdateAppsJob) Do(data []byte) error {
 		}
 	}
 	
-	// {{{1 Get all apps in registry repository
+	generations := j.Generations
+	generations.Ctx = ctx
+
+	// {{{1 Get registry repository head commit
+	repo, scmProvider, _, err := j.Registries.Get(ctx, jobDef.Registry)
+	if err != nil {
+		return err
+	}
+
+	registry := repo.FullName()
+	isDefault := repo.isDefault(j.Cfg)
+
 	repoParser := parsing.RepoParser{
-		Ctx: j.Ctx,
-		GH: j.GH,
+		Ctx: ctx,
+		SCM: scmProvider,
 		GHDevTeamName: j.Cfg.GhDevTeamName,
 		SiteURL: j.Cfg.SiteURL,
-		RepoOwner: j.Cfg.GhRegistryRepoOwner,
-		RepoName: j.Cfg.GhRegistryRepoName,
-		RepoRef: "master",
+		RepoRef: j.Cfg.GhRegistryRepoBranch,
 	}
+
+	headSHA, err := repoParser.GetRefSHA()
+	if err != nil {
+		return fmt.Errorf("failed to get registry repository head commit: %s",
+			err.Error())
+	}
+
+	// Parse at the head commit so all files are read from the same commit
+	repoParser.RepoRef = headSHA
+	repoParser.GitHubURLRef = j.Cfg.GhRegistryRepoBranch
+
+	// {{{1 Get last synchronized commit
+	syncState, err := generations.GetSyncState(models.SyncStateAppsID)
+	if err != nil {
+		return fmt.Errorf("failed to get last synchronized commit: %s", err.Error())
+	}
+
+	regSyncState := registrySyncState(syncState, registry, isDefault)
+
+	// {{{1 Determine which apps to update
 	appIDs, err := repoParser.GetAppIDs()
 	if err != nil {
 		return fmt.Errorf("failed to get IDs of application in repository: %s",
 			err.Error())
 	}
 
+	full := jobDef.Full || len(regSyncState.CommitSHA) == 0
+
+	// updateAppIDs are the IDs of apps which will be parsed and saved
+	updateAppIDs := appIDs
+
+	// deletedAppIDs are the IDs of apps which will be removed from the database,
+	// only used if not doing a full update
+	deletedAppIDs := []string{}
+
+	if !full {
+		changedAppIDs, ok, err := repoParser.GetChangedAppIDs(regSyncState.CommitSHA)
+		if err != nil {
+			return fmt.Errorf("failed to get IDs of applications changed since "+
+				"commit %s: %s", regSyncState.CommitSHA, err.Error())
+		}
+
+		if ok {
+			presentAppIDs := map[string]bool{}
+			for _, appID := range appIDs {
+				presentAppIDs[appID] = true
+			}
+
+			// Retry apps which failed last time, the failure may have
+			// been caused by an internal error
+			retryAppIDs := map[string]bool{}
+			for _, appID := range append(changedAppIDs, regSyncState.FailedIDs...) {
+				retryAppIDs[appID] = true
+			}
+
+			updateAppIDs = []string{}
+			for appID, _ := range retryAppIDs {
+				if presentAppIDs[appID] {
+					updateAppIDs = append(updateAppIDs, appID)
+				} else {
+					deletedAppIDs = append(deletedAppIDs, appID)
+				}
+			}
+		} else {
+			full = true
+		}
+	}
+
+	// {{{1 Parse apps
 	apps := map[string]models.App{}
 
-	for _, appID := range appIDs {
+	// failures holds the errors of apps which failed to parse, keys are app IDs
+	failures := map[string][]string{}
+
+	for _, appID := range updateAppIDs {
 		app, errs := repoParser.GetApp(appID)
 		if errs != nil {
 			errStrs := []string{}
 			for _, err := range errs {
 				errStrs = append(errStrs, err.Error())
 			}
-			return fmt.Errorf("failed to get application with ID %s: %s",
-				appID, strings.Join(errStrs, ", "))
+			failures[appID] = errStrs
+			continue
 		}
 
+		app.Registry = registry
 		apps[appID] = *app
 	}
 
-	// {{{1 Save in database
+	j.Metrics.AppsParseFailures.Set(float64(len(failures)))
+
+	// {{{1 Build new generation of apps collection
+	// {{{2 Start with current generation
+	if err := generations.StartStaging(); err != nil {
+		return fmt.Errorf("failed to start new generation of apps: %s", err.Error())
+	}
+
+	// {{{2 Skip apps whose IDs are used by other registry repositories
+	registryFilter := RegistryFilter(j.Cfg, registry)
+
+	usedAppIDs, err := j.otherRegistryAppIDs(ctx, generations.MDbAppsStaging,
+		registryFilter, updateAppIDs)
+	if err != nil {
+		return err
+	}
+
+	for appID, otherRegistry := range usedAppIDs {
+		delete(apps, appID)
+		failures[appID] = []string{fmt.Sprintf("app ID is already used by "+
+			"registry repository %s", otherRegistry)}
+	}
+
+	// {{{2 Save apps
 	upsertTrue := true
 	for appID, app := range apps {
-		_, err := j.MDbApps.UpdateOne(j.Ctx, bson.D{{"app_id", appID}},
-			bson.D{{"$set", app}}, &options.UpdateOptions{
+		_, err := generations.MDbAppsStaging.UpdateOne(ctx, bson.D{{"app_id", appID}},
+			bson.D{
+				{"$set", app},
+				{"$unset", bson.D{{"parse_failure", ""}}},
+			}, &options.UpdateOptions{
 				Upsert: &upsertTrue,
 			})
 		if err != nil {
@@ -100,78 +232,227 @@ func (j UpdateAppsJob) Do(data []byte) error {
 		}
 	}
 
-	// {{{1 Delete any old apps
-	_, err = j.MDbApps.DeleteMany(j.Ctx, bson.D{{
-		"app_id",
-		bson.D{{
-			"$nin",
-			appIDs,
-		}},
-	}}, nil)
+	// {{{2 Flag apps which failed to parse
+	// The last version of the app which parsed successfully is kept. If the app
+	// has never parsed successfully there is nothing to flag.
+	failedAt := time.Now()
+	failedAppIDs := []string{}
+
+	for appID, errStrs := range failures {
+		failedAppIDs = append(failedAppIDs, appID)
+
+		_, err := generations.MDbAppsStaging.UpdateOne(ctx, bson.D{
+			{"app_id", appID},
+			registryFilter,
+		}, bson.D{{"$set", bson.D{{"parse_failure", models.AppParseFailure{
+				Errors: errStrs,
+				CommitSHA: headSHA,
+				FailedAt: failedAt,
+			}}}}})
+		if err != nil {
+			return fmt.Errorf("failed to flag app with ID %s as failing to "+
+				"parse in db: %s", appID, err.Error())
+		}
+	}
+
+	// {{{2 Delete any old apps
+	deleteFilter := bson.D{{"app_id", bson.D{{"$in", deletedAppIDs}}}, registryFilter}
+	if full {
+		deleteFilter = bson.D{{"app_id", bson.D{{"$nin", appIDs}}}, registryFilter}
+	}
+
+	_, err = generations.MDbAppsStaging.DeleteMany(ctx, deleteFilter, nil)
 	if err != nil {
 		return fmt.Errorf("failed to prune old apps from db: %s", err.Error())
 	}
 
-	// {{{1 Notify bot API of data change
-	// {{{2 Do not notify if UpdateAppsJobDefinition.NoBotAPINotify field is set
-	if jobDef.NoBotAPINotify {
-		return nil
+	// {{{2 Set verification statuses
+	verificationResets, err := j.Verifier.Apply(ctx, generations.MDbAppsStaging)
+	if err != nil {
+		return fmt.Errorf("failed to set verification statuses of apps: %s",
+			err.Error())
+	}
+
+	// {{{2 Validate new generation
+	if err := generations.ValidateStaging(); err != nil {
+		return fmt.Errorf("new generation of apps is not valid: %s", err.Error())
 	}
 
-	// {{{2 Setup request
-	// {{{3 URL
-	reqURL := j.Cfg.BotAPIURL
-	reqURL.Path = "/newapps"
+	// {{{2 Determine which apps changed
+	delta, err := generations.StagingDelta(headSHA)
+	if err != nil {
+		return fmt.Errorf("failed to determine changes in new generation of "+
+			"apps: %s", err.Error())
+	}
 
-	// {{{3 Body
-	appsValues := []models.App{}
-	for _, app := range apps {
-		appsValues = append(appsValues, app)
+	if err := generations.MarkUpdated(&delta, time.Now()); err != nil {
+		return fmt.Errorf("failed to record when apps changed: %s", err.Error())
 	}
 
-	reqBuf := bytes.NewBuffer(nil)
-	reqEncoder := json.NewEncoder(reqBuf)
+	// {{{1 Record notifications
+	// Notifications are held in the outbox until the new generation is swapped in
+	heldMsgs := []models.OutboxMessage{}
 
-	reqBody := map[string]interface{}{
-		"apps": appsValues,
+	// {{{2 Bot API
+	// Do not notify if UpdateAppsJobDefinition.NoBotAPINotify field is set or
+	// if nothing changed.
+	if !jobDef.NoBotAPINotify && !delta.Empty() {
+		msg, err := j.newBotAPIMessage(delta)
+		if err != nil {
+			return fmt.Errorf("failed to create bot API notification: %s",
+				err.Error())
+		}
+
+		heldMsgs = append(heldMsgs, msg)
 	}
 
-	if err := reqEncoder.Encode(reqBody); err != nil {
-		return fmt.Errorf("failed to encode apps array as JSON: %s", err.Error())
+	// {{{2 CloudEvents
+	if j.Events.Enabled() {
+		evs, err := events.AppsDeltaEvents(j.Events.Source(), delta)
+		if err != nil {
+			return fmt.Errorf("failed to create app events: %s", err.Error())
+		}
+
+		evMsgs, err := j.Events.Messages(evs)
+		if err != nil {
+			return fmt.Errorf("failed to create app event messages: %s",
+				err.Error())
+		}
+
+		heldMsgs = append(heldMsgs, evMsgs...)
 	}
 
-	reqReadCloser := req.ReaderDummyCloser{
-		reqBuf,
+	// {{{2 Hold
+	heldMsgIDs := []string{}
+
+	for _, msg := range heldMsgs {
+		msg.Batch = jobDef.OutboxBatch
+
+		if err := j.Outbox.Hold(ctx, msg); err != nil {
+			return fmt.Errorf("failed to record %s notification: %s",
+				msg.Destination, err.Error())
+		}
+		heldMsgIDs = append(heldMsgIDs, msg.ID)
 	}
 
-	// {{{3 Actual request
-	req := http.Request{
-		Method: "POST",
-		URL: &reqURL,
-		Header: map[string][]string{
-			"Content-Type": {"application/json"},
-			"X-Bot-API-Secret": {j.Cfg.BotAPISecret},
-		},
-		Body: reqReadCloser,
+	// {{{1 Swap in new generation and record synchronized commit
+	// {{{2 Set verification statuses again
+	// Reviewers may have changed verification statuses in the current
+	// generation while the new generation was built, these would be lost
+	verificationResets, err = j.Verifier.Apply(ctx, generations.MDbAppsStaging)
+	if err != nil {
+		if discardErr := j.Outbox.Discard(ctx, heldMsgIDs); discardErr != nil {
+			return fmt.Errorf("failed to set verification statuses of apps "+
+				"before swap: %s, then failed to discard notifications: %s",
+				err.Error(), discardErr.Error())
+		}
+
+		return fmt.Errorf("failed to set verification statuses of apps before "+
+			"swap: %s", err.Error())
 	}
 
-	// {{{2 Make request
-	resp, err := http.DefaultClient.Do(&req)
+	// {{{2 Swap
+	syncState = setRegistrySyncState(syncState, models.RegistrySyncState{
+		Registry: registry,
+		CommitSHA: headSHA,
+		FailedIDs: failedAppIDs,
+	}, isDefault)
+	syncState.SyncedAt = time.Now()
+
+	err = generations.SwapInStaging(syncState)
 	if err != nil {
-		return fmt.Errorf("failed to make new apps request to bot API: %s",
+		if discardErr := j.Outbox.Discard(ctx, heldMsgIDs); discardErr != nil {
+			return fmt.Errorf("failed to swap in new generation of apps: %s, "+
+				"then failed to discard notifications: %s", err.Error(),
+				discardErr.Error())
+		}
+
+		return fmt.Errorf("failed to swap in new generation of apps: %s",
 			err.Error())
 	}
-	if resp.StatusCode != http.StatusOK {
-		respBody, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("got non-OK response from new apps endpoint for "+
-				"bot API but failed to read response body, status: %s, "+
-				"body read error: %s",
-				resp.Status, err.Error())
+
+	// {{{1 Release notifications
+	if err := j.Outbox.Release(ctx, heldMsgIDs); err != nil {
+		return fmt.Errorf("failed to release notifications: %s", err.Error())
+	}
+
+	// {{{1 Record verification statuses reset by version changes
+	if err := j.Verifier.Record(ctx, verificationResets); err != nil {
+		return fmt.Errorf("failed to record verification status resets: %s",
+			err.Error())
+	}
+
+	// {{{1 Report apps which failed to parse
+	if len(failures) > 0 {
+		partialErr := PartialSuccessError{
+			Failures: map[string]string{},
+		}
+
+		for appID, errStrs := range failures {
+			partialErr.Failures[appID] = strings.Join(errStrs, ", ")
 		}
-		return fmt.Errorf("got non-OK response from new apps endpoint for bot API "+
-			"status: %s, body: %s", resp.Status, string(respBody))
+
+		return partialErr
 	}
 
 	return nil
 }
+
+// otherRegistryAppIDs returns which of the apps with IDs in a collection do not match
+// a registry filter. Values are the registry repositories of the apps, keys are app
+// IDs.
+func (j UpdateAppsJob) otherRegistryAppIDs(ctx context.Context,
+	collection *mongo.Collection, registryFilter bson.E,
+	appIDs []string) (map[string]string, error) {
+
+	cursor, err := collection.Find(ctx, bson.D{
+		{"app_id", bson.D{{"$in", appIDs}}},
+		{"$nor", bson.A{bson.D{registryFilter}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query apps from other registry "+
+			"repositories: %s", err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	used := map[string]string{}
+
+	for cursor.Next(ctx) {
+		var app models.App
+		if err := cursor.Decode(&app); err != nil {
+			return nil, fmt.Errorf("failed to decode app: %s", err.Error())
+		}
+
+		// Apps saved before registries were recorded are from the
+		// configured registry repository
+		if len(app.Registry) == 0 {
+			app.Registry = j.Cfg.RegistryRepos()[0]
+		}
+
+		used[app.AppID] = app.Registry
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over apps: %s", err.Error())
+	}
+
+	return used, nil
+}
+
+// newBotAPIMessage creates an outbox message which sends the apps which changed to
+// the bot API new apps endpoint
+func (j UpdateAppsJob) newBotAPIMessage(delta models.AppsDelta) (models.OutboxMessage, error) {
+	reqURL := j.Cfg.BotAPIURL
+	reqURL.Path = "/newapps"
+
+	reqBody, err := json.Marshal(delta)
+	if err != nil {
+		return models.OutboxMessage{}, fmt.Errorf("failed to encode apps delta "+
+			"as JSON: %s", err.Error())
+	}
+
+	return outbox.NewMessage(outbox.DestinationBotAPI, reqURL.String(),
+		map[string]string{
+			"Content-Type": "application/json",
+		}, reqBody), nil
+}
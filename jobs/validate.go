@@ -2,66 +2,98 @@ package jobs
 
 import (
 	"fmt"
+	"net/url"
 	"time"
 	"context"
 	"encoding/json"
 
+	"github.com/kscout/serverless-registry-api/models"
 	"github.com/kscout/serverless-registry-api/parsing"
 	"github.com/kscout/serverless-registry-api/config"
+	"github.com/kscout/serverless-registry-api/events"
+	"github.com/kscout/serverless-registry-api/scm"
 	
 	"github.com/google/go-github/v26/github"
 	"github.com/Noah-Huppert/golog"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// ValidateJob updates the apps collection based on the current master branch state
-// Expects the data passed to Do() to be a github.PullRequest in JSON form. This
-// pull request will be validated.
-type ValidateJob struct {
-	// Ctx
-	Ctx context.Context
+// ValidateCheckRunName is the name of the check run created by ValidateJob
+const ValidateCheckRunName = "KScout Format Validation"
 
+// ValidateJob validates the apps modified by a pull request. The result is placed
+// in a comment, a check, labels, and the submissions collection. Labels are only
+// applied on GitHub. The pull request's base repository must be a registry
+// repository, it is accessed as the installation which can access it.
+// Expects the data passed to Do() to be a scm.MergeRequest in JSON form, a
+// github.PullRequest is also accepted. This pull request will be validated.
+type ValidateJob struct {
 	// Logger
 	Logger golog.Logger
 
 	// Cfg is the server configuration
 	Cfg *config.Config
 	
-	// GH is a GitHub API client
-	GH *github.Client
+	// Registries accesses registry repositories
+	Registries RegistryClients
+
+	// Events is used to emit a CloudEvent when validation completes
+	Events events.Emitter
+
+	// MDbSubmissions is used to access the submissions collection
+	MDbSubmissions *mongo.Collection
+
+	// MDbApps is used to access the apps collection
+	MDbApps *mongo.Collection
+
+	// repo is the registry repository of the pull request, set by Do
+	repo RegistryRepo
+
+	// provider accesses repo, set by Do
+	provider scm.Provider
+
+	// gh is a GitHub API client which can access repo, used to label pull
+	// requests. Set by Do, nil if the registry repository is not on GitHub.
+	gh *github.Client
 }
 
 // Do implments Job
-func (j ValidateJob) Do(data []byte) error {
+func (j ValidateJob) Do(ctx context.Context, data []byte) error {
 	// {{{1 Parse PullRequestEvent
-	var pr github.PullRequest
+	var pr scm.MergeRequest
 	if err := json.Unmarshal(data, &pr); err != nil {
-		return fmt.Errorf("failed to unmarshal data as github.PullRequest: %s",
+		return fmt.Errorf("failed to unmarshal data as scm.MergeRequest: %s",
 			err.Error())
 	}
 
-	// {{{1 Create check run
-	checkRunStatus :="in_progress"
-	checkRunName := "KScout Format Validation"
-	checkRun, _, err := j.GH.Checks.CreateCheckRun(j.Ctx, j.Cfg.GhRegistryRepoOwner,
-		j.Cfg.GhRegistryRepoName, github.CreateCheckRunOptions{
-			Name: checkRunName,
-			HeadBranch: *pr.Head.Ref,
-			HeadSHA: *pr.Head.SHA,
-			StartedAt: &github.Timestamp{ time.Now() },
-			Status: &checkRunStatus,
-		})
+	// {{{1 Get registry repository clients
+	var err error
+
+	j.repo, j.provider, j.gh, err = j.Registries.Get(ctx, NewRegistryRepo(0,
+		pr.Base.Repo.FullName))
 	if err != nil {
-		return fmt.Errorf("failed to create initial check run status: %s", err.Error())
+		return err
+	}
+
+	// {{{1 Create check
+	check := scm.Check{
+		Name: ValidateCheckRunName,
+		HeadRef: pr.Head.Ref,
+		HeadSHA: pr.Head.SHA,
+		Status: scm.CheckStatusInProgress,
 	}
+	checkID, err := j.provider.CreateCheck(ctx, check)
+	if err != nil {
+		return fmt.Errorf("failed to create initial check status: %s", err.Error())
+	}
+	check.ID = checkID
 	
 	// {{{1 Get applications which were modified in PR
 	prParser := parsing.PRParser{
-		Ctx: j.Ctx,
-		GH: j.GH,
-		RepoOwner: j.Cfg.GhRegistryRepoOwner,
-		RepoName: j.Cfg.GhRegistryRepoName,
-		RepoRef: *pr.Head.Ref,
-		PRNumber: *pr.Number,
+		Ctx: ctx,
+		SCM: j.provider,
+		RepoRef: pr.Head.Ref,
+		PRNumber: pr.Number,
 	}
 	appIDs, deletedAppIDs, err := prParser.GetModifiedAppIDs()
 	if err != nil {
@@ -71,22 +103,24 @@ func (j ValidateJob) Do(data []byte) error {
 
 	// {{{1 Load each application
 	repoParser := parsing.RepoParser{
-		Ctx: j.Ctx,
-		GH: j.GH,
+		Ctx: ctx,
+		SCM: j.provider,
 		GHDevTeamName: j.Cfg.GhDevTeamName,
 		SiteURL: j.Cfg.SiteURL,
-		RepoOwner: j.Cfg.GhRegistryRepoOwner,
-		RepoName: j.Cfg.GhRegistryRepoName,
-		RepoRef: *pr.Head.Ref,
+		RepoRef: pr.Head.Ref,
 	}
 
         parseErrs := map[string][]parsing.ParseError{}
+	apps := map[string]*models.App{}
 
 	for _, appID := range appIDs {
-		_, errs := repoParser.GetApp(appID)
+		app, errs := repoParser.GetApp(appID)
 		if len(errs) > 0 {
 			parseErrs[appID] = errs
+			continue
 		}
+
+		apps[appID] = app
 	}
 
 	// {{{1 Comment with validation result
@@ -123,7 +157,11 @@ func (j ValidateJob) Do(data []byte) error {
 			}
 		} else {
 			status = "Good"
-			comment = ":+1:"
+			comment = fmt.Sprintf(":+1: [Preview](%s) / [deploy.sh](%s) / "+
+				"[deployment.json](%s)",
+				previewURL(j.Cfg, j.repo, pr.Number, appID, ""),
+				previewURL(j.Cfg, j.repo, pr.Number, appID, "/deploy.sh"),
+				previewURL(j.Cfg, j.repo, pr.Number, appID, "/deployment.json"))
 		}
 
 		statusTable += fmt.Sprintf("| %s | %s | %s |\n", appID, status, comment)
@@ -170,6 +208,10 @@ func (j ValidateJob) Do(data []byte) error {
 			} else {
 				errsDetails += fmt.Sprintf("%s\n", err.FixInstructions)
 			}
+
+			errsDetails += fmt.Sprintf("  - **Error code**: `%s`, comment "+
+				"`/kscout explain %s` for details\n", err.ErrorCode(),
+				err.ErrorCode())
 		}
 	}
 
@@ -183,47 +225,101 @@ func (j ValidateJob) Do(data []byte) error {
 	commentBody += "  \n---  \n"+
 		"*I am a bot*"
 
-	// {{{2 Make comment
-	_, _, err = j.GH.Issues.CreateComment(j.Ctx, j.Cfg.GhRegistryRepoOwner,
-		j.Cfg.GhRegistryRepoName, *pr.Number, &github.IssueComment{
-			Body: &commentBody,
-		})
-
-	if err != nil {
-		return fmt.Errorf("failed to create comment on PR: %s", err.Error())
-	}
-
-	// {{{1 Update check run status
+	// {{{2 Determine result
 	title := "Passed"
-	conclusion := "success"
+	conclusion := scm.CheckConclusionSuccess
 	
 	if len(parseErrs) > 0 {
 		title = "Failed"
-		conclusion = "failure"
+		conclusion = scm.CheckConclusionFailure
 	}
 
 	if internalErr {
 		title = "Internal Error"
-		conclusion = "cancelled"
+		conclusion = scm.CheckConclusionCancelled
+	}
+
+	// {{{2 Make comment
+	err = j.postValidateComment(ctx, pr.Number, commentBody, ValidationHistoryEntry{
+		HeadSHA: pr.Head.SHA,
+		Conclusion: conclusion,
+		Title: title,
+		ValidatedAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to comment on PR: %s", err.Error())
 	}
 
-	checkRunStatus = "completed"
+	// {{{1 Update check status
+	check.Status = scm.CheckStatusCompleted
+	check.Conclusion = conclusion
+	check.Title = title
+	check.Summary = statusTable
+	check.Text = errsDetails
 	
-	_, _, err = j.GH.Checks.UpdateCheckRun(j.Ctx, j.Cfg.GhRegistryRepoOwner,
-		j.Cfg.GhRegistryRepoName, *checkRun.ID, github.UpdateCheckRunOptions{
-			Name: checkRunName,
-			CompletedAt: &github.Timestamp{ time.Now() },
-			Status: &checkRunStatus,
-			Conclusion: &conclusion,
-			Output: &github.CheckRunOutput{
-				Title: &title,
-				Summary: &statusTable,
-				Text: &errsDetails,
-			},
+	if err := j.provider.UpdateCheck(ctx, check); err != nil {
+		return fmt.Errorf("failed to update check: %s", err.Error())
+	}
+
+	// {{{1 Save submission
+	err = saveSubmission(ctx, j.MDbSubmissions, RegistryFilter(j.Cfg,
+		j.repo.FullName()), newSubmission(j.repo.FullName(), pr.Number,
+		pr.Head.SHA, apps, parseErrs, deletedAppIDs, conclusion))
+	if err != nil {
+		return err
+	}
+
+	// {{{1 Label PR
+	// Labels are a convenience for reviewers, failing to apply them must not
+	// prevent the validation completed event from being emitted
+	if j.gh != nil {
+		if err := j.labelPR(ctx, pr.Number, appIDs, deletedAppIDs, apps,
+			parseErrs); err != nil {
+			j.Logger.Errorf("failed to label PR #%d: %s", pr.Number, err.Error())
+		}
+	}
+
+	// {{{1 Emit validation completed event
+	failedAppIDs := []string{}
+	for appID, _ := range parseErrs {
+		failedAppIDs = append(failedAppIDs, appID)
+	}
+
+	ev, err := events.NewEvent(j.Events.Source(), events.TypeAppValidationCompleted,
+		fmt.Sprintf("%d", pr.Number), events.ValidationCompletedData{
+			PullRequestNumber: pr.Number,
+			HeadSHA: pr.Head.SHA,
+			Conclusion: conclusion,
+			AppIDs: appIDs,
+			DeletedAppIDs: deletedAppIDs,
+			FailedAppIDs: failedAppIDs,
 		})
 	if err != nil {
-		return fmt.Errorf("failed to update check run: %s", err.Error())
+		return fmt.Errorf("failed to create validation completed event: %s",
+			err.Error())
+	}
+
+	if err := j.Events.Emit(ctx, ev); err != nil {
+		return fmt.Errorf("failed to emit validation completed event: %s",
+			err.Error())
 	}
 
 	return nil
 }
+
+// previewURL returns the URL of a preview endpoint for an app in a pull request.
+// The suffix is appended to the path of the app preview endpoint. Pull requests in
+// registry repositories other than the configured one are identified by the
+// registry query parameter.
+func previewURL(cfg *config.Config, repo RegistryRepo, prNumber int, appID,
+	suffix string) string {
+
+	u := cfg.ExternalURL
+	u.Path = fmt.Sprintf("/submissions/%d/apps/%s%s", prNumber, appID, suffix)
+
+	if !repo.isDefault(cfg) {
+		u.RawQuery = url.Values{"registry": []string{repo.FullName()}}.Encode()
+	}
+
+	return u.String()
+}
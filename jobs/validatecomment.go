@@ -0,0 +1,179 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kscout/serverless-registry-api/scm"
+)
+
+// validateCommentMarker is a hidden marker placed in the comment ValidateJob makes on
+// pull requests so the comment can be found and edited by later validations
+const validateCommentMarker = "<!-- kscout-validation -->"
+
+// validateHistoryLength is the maximum number of validation results stored in the
+// validation comment
+const validateHistoryLength = 10
+
+// validateHistoryRegexp matches the hidden validation history in a validation comment
+var validateHistoryRegexp = regexp.MustCompile(`<!-- kscout-validation-history: (.*) -->`)
+
+// ValidationHistoryEntry records the result of validating a pull request
+type ValidationHistoryEntry struct {
+	// HeadSHA is the commit which was validated
+	HeadSHA string `json:"head_sha"`
+
+	// Conclusion is the validation check run conclusion
+	Conclusion string `json:"conclusion"`
+
+	// Title is the validation check run title
+	Title string `json:"title"`
+
+	// ValidatedAt is the time validation completed
+	ValidatedAt time.Time `json:"validated_at"`
+}
+
+// parseValidationHistory extracts the validation history from a validation comment.
+// Returns an empty history if none is found.
+func parseValidationHistory(body string) []ValidationHistoryEntry {
+	history := []ValidationHistoryEntry{}
+
+	match := validateHistoryRegexp.FindStringSubmatch(body)
+	if match == nil {
+		return history
+	}
+
+	if err := json.Unmarshal([]byte(match[1]), &history); err != nil {
+		return []ValidationHistoryEntry{}
+	}
+
+	return history
+}
+
+// appendValidationHistory adds a result to the validation history. The oldest
+// results are removed so at most validateHistoryLength are kept.
+func appendValidationHistory(history []ValidationHistoryEntry,
+	entry ValidationHistoryEntry) []ValidationHistoryEntry {
+
+	history = append(history, entry)
+	if len(history) > validateHistoryLength {
+		history = history[len(history)-validateHistoryLength:]
+	}
+
+	return history
+}
+
+// renderValidationHistory creates the part of the validation comment which shows
+// earlier results and stores the history. The last entry is the current result.
+func renderValidationHistory(history []ValidationHistoryEntry) (string, error) {
+	historyBytes, err := json.Marshal(history)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal validation history into JSON: %s",
+			err.Error())
+	}
+
+	out := ""
+
+	if len(history) > 1 {
+		out += "  \n<details><summary>Earlier results</summary>\n\n" +
+			"| Commit | Result | Time |\n" +
+			"| ------ | ------ | ---- |\n"
+
+		for i := len(history) - 2; i >= 0; i-- {
+			entry := history[i]
+
+			shortSHA := entry.HeadSHA
+			if len(shortSHA) > 7 {
+				shortSHA = shortSHA[:7]
+			}
+
+			out += fmt.Sprintf("| %s | %s | %s |\n", shortSHA, entry.Title,
+				entry.ValidatedAt.UTC().Format(time.RFC1123))
+		}
+
+		out += "\n</details>\n"
+	}
+
+	out += fmt.Sprintf("\n<!-- kscout-validation-history: %s -->\n%s",
+		string(historyBytes), validateCommentMarker)
+
+	return out, nil
+}
+
+// findValidateComment returns the validation comment made on a pull request by an
+// earlier validation, nil if none exists
+func (j ValidateJob) findValidateComment(ctx context.Context,
+	prNumber int) (*scm.Comment, error) {
+
+	comments, err := j.provider.ListComments(ctx, prNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list comments: %s", err.Error())
+	}
+
+	var found *scm.Comment
+
+	for i, comment := range comments {
+		if !comment.ByBot {
+			continue
+		}
+
+		if strings.Contains(comment.Body, validateCommentMarker) {
+			found = &comments[i]
+		}
+	}
+
+	return found, nil
+}
+
+// postValidateComment places the result of a validation on a pull request. If
+// Cfg.ValidateStickyComment is true the comment made by an earlier validation is
+// edited, otherwise a new comment is made.
+func (j ValidateJob) postValidateComment(ctx context.Context, prNumber int,
+	body string, entry ValidationHistoryEntry) error {
+
+	// {{{1 Find existing comment
+	var existing *scm.Comment
+
+	if j.Cfg.ValidateStickyComment {
+		comment, err := j.findValidateComment(ctx, prNumber)
+		if err != nil {
+			return fmt.Errorf("failed to find existing validation comment: %s",
+				err.Error())
+		}
+		existing = comment
+	}
+
+	// {{{1 Add history
+	history := []ValidationHistoryEntry{}
+	if existing != nil {
+		history = parseValidationHistory(existing.Body)
+	}
+
+	history = appendValidationHistory(history, entry)
+
+	historyStr, err := renderValidationHistory(history)
+	if err != nil {
+		return err
+	}
+
+	body += historyStr
+
+	// {{{1 Create or edit comment
+	if existing == nil {
+		if err := j.provider.CreateComment(ctx, prNumber, body); err != nil {
+			return fmt.Errorf("failed to create comment: %s", err.Error())
+		}
+
+		return nil
+	}
+
+	if err := j.provider.EditComment(ctx, prNumber, existing.ID, body); err != nil {
+		return fmt.Errorf("failed to edit comment: %s", err.Error())
+	}
+
+	return nil
+}
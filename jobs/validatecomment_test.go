@@ -0,0 +1,80 @@
+package jobs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testValidationHistory creates a history with n entries, oldest first
+func testValidationHistory(n int) []ValidationHistoryEntry {
+	history := []ValidationHistoryEntry{}
+	validatedAt := time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < n; i++ {
+		history = append(history, ValidationHistoryEntry{
+			HeadSHA:     fmt.Sprintf("%040d", i),
+			Conclusion:  "success",
+			Title:       fmt.Sprintf("Result %d", i),
+			ValidatedAt: validatedAt.Add(time.Duration(i) * time.Hour),
+		})
+	}
+
+	return history
+}
+
+func TestValidationHistoryRoundTrip(t *testing.T) {
+	history := testValidationHistory(3)
+
+	rendered, err := renderValidationHistory(history)
+	assert.NoError(t, err)
+
+	// Comment text surrounds the history
+	body := "Validation passed\n" + rendered
+
+	assert.True(t, strings.HasSuffix(body, validateCommentMarker))
+	assert.Equal(t, history, parseValidationHistory(body))
+
+	// Earlier results are shown newest first, the current result is not shown
+	assert.True(t, strings.Index(body, "Result 1") < strings.Index(body, "Result 0"))
+	assert.NotContains(t, body, "| Result 2 |")
+}
+
+func TestParseValidationHistoryMissing(t *testing.T) {
+	assert.Equal(t, []ValidationHistoryEntry{},
+		parseValidationHistory("Validation passed\n"+validateCommentMarker))
+}
+
+func TestParseValidationHistoryMalformed(t *testing.T) {
+	for _, body := range []string{
+		"<!-- kscout-validation-history: not json -->",
+		`<!-- kscout-validation-history: [{"head_sha": 1}] -->`,
+		`<!-- kscout-validation-history: {"head_sha": "abc"} -->`,
+	} {
+		assert.Equal(t, []ValidationHistoryEntry{}, parseValidationHistory(body),
+			body)
+	}
+}
+
+func TestAppendValidationHistory(t *testing.T) {
+	// Under the limit nothing is removed
+	history := appendValidationHistory(testValidationHistory(2),
+		testValidationHistory(3)[2])
+	assert.Equal(t, testValidationHistory(3), history)
+
+	// Over the limit the oldest entries are removed
+	full := testValidationHistory(validateHistoryLength + 1)
+
+	history = appendValidationHistory(full[:validateHistoryLength],
+		full[validateHistoryLength])
+	assert.Len(t, history, validateHistoryLength)
+	assert.Equal(t, full[1:], history)
+
+	// The trimmed history survives a round trip
+	rendered, err := renderValidationHistory(history)
+	assert.NoError(t, err)
+	assert.Equal(t, full[1:], parseValidationHistory(rendered))
+}
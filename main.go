@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"flag"
@@ -12,19 +11,25 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/kscout/serverless-registry-api/config"
+	"github.com/kscout/serverless-registry-api/events"
+	"github.com/kscout/serverless-registry-api/ghapp"
 	"github.com/kscout/serverless-registry-api/handlers"
 	"github.com/kscout/serverless-registry-api/jobs"
 	"github.com/kscout/serverless-registry-api/metrics"
+	"github.com/kscout/serverless-registry-api/mockwebhook"
 	"github.com/kscout/serverless-registry-api/models"
-	"github.com/kscout/serverless-registry-api/req"
+	"github.com/kscout/serverless-registry-api/outbox"
+	"github.com/kscout/serverless-registry-api/scm"
 	"github.com/kscout/serverless-registry-api/validation"
+	"github.com/kscout/serverless-registry-api/verification"
 
 	"github.com/Noah-Huppert/golog"
-	"github.com/bradleyfalzon/ghinstallation"
 	"github.com/google/go-github/v26/github"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.mongodb.org/mongo-driver/bson"
@@ -32,6 +37,10 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// mongoNamespaceExistsCode is the MongoDB error code returned when creating a
+// collection which already exists
+const mongoNamespaceExistsCode = 48
+
 func main() {
 	// {{{1 Context
 	ctx, ctxCancel := context.WithCancel(context.Background())
@@ -94,6 +103,17 @@ func main() {
 
 	mDb := mDbClient.Database(cfg.DbName)
 	mDbApps := mDb.Collection("apps")
+	mDbAppsStaging := mDb.Collection("apps_staging")
+	mDbAppsPrevious := mDb.Collection("apps_previous")
+	mDbSyncState := mDb.Collection("sync_state")
+	mDbOutbox := mDb.Collection("outbox")
+	mDbSubmissions := mDb.Collection("submissions")
+	mDbVerifications := mDb.Collection("app_verifications")
+	mDbVerificationAudit := mDb.Collection("verification_audit")
+	mDbWebhookDeliveries := mDb.Collection("webhook_deliveries")
+	mDbWebhookDeliveryClaims := mDb.Collection("webhook_delivery_claims")
+	mDbInstallations := mDb.Collection("installations")
+	mDbAppStats := mDb.Collection("app_stats")
 
 	logger.Debug("connected to Db")
 
@@ -107,29 +127,118 @@ func main() {
 		logger.Fatalf("failed to create db index: %s", err.Error())
 	}
 
-	logger.Debugf("ensured db indexes exist")
+	_, err = mDbOutbox.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"status", 1}, {"next_attempt_at", 1}},
+	})
+	if err != nil {
+		logger.Fatalf("failed to create outbox db index: %s", err.Error())
+	}
+
+	// Pull request numbers are unique per registry repository. The index on only
+	// pr_number was created before there were multiple registry repositories.
+	_, err = mDbSubmissions.Indexes().DropOne(ctx, "pr_number_1")
+	if err != nil && !isIndexNotFoundError(err) {
+		logger.Fatalf("failed to drop old submissions db index: %s", err.Error())
+	}
 
-	// {{{1 GitHub
-	// {{{2 Create client
-	logger.Debug("authenticating with GitHub API")
+	uniqueTrue := true
+	_, err = mDbSubmissions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"registry", 1}, {"pr_number", 1}},
+		Options: &options.IndexOptions{
+			Unique: &uniqueTrue,
+		},
+	})
+	if err != nil {
+		logger.Fatalf("failed to create submissions db index: %s", err.Error())
+	}
 
-	ghAPIKeyTransport, err := ghinstallation.NewKeyFromFile(http.DefaultTransport,
-		cfg.GhIntegrationID, cfg.GhInstallationID, cfg.GhPrivateKeyPath)
+	_, err = mDbInstallations.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"repositories", 1}},
+	})
 	if err != nil {
-		logger.Fatalf("failed to load GitHub API secret key file: %s", err.Error())
+		logger.Fatalf("failed to create installations db index: %s", err.Error())
 	}
 
-	gh := github.NewClient(&http.Client{Transport: ghAPIKeyTransport})
+	_, err = mDbVerificationAudit.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"app_id", 1}, {"created_at", -1}},
+	})
+	if err != nil {
+		logger.Fatalf("failed to create verification audit db index: %s",
+			err.Error())
+	}
+
+	_, err = mDbAppStats.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"app_id", 1}},
+		Options: &options.IndexOptions{
+			Unique: &uniqueTrue,
+		},
+	})
+	if err != nil {
+		logger.Fatalf("failed to create app stats db index: %s", err.Error())
+	}
+
+	_, err = mDbWebhookDeliveryClaims.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"claimed_at", 1}},
+		Options: options.Index().SetExpireAfterSeconds(
+			int32(cfg.WebhookDeliveryClaimsTTL.Seconds())),
+	})
+	if err != nil {
+		logger.Fatalf("failed to create webhook delivery claims db index: %s",
+			err.Error())
+	}
+
+	logger.Debugf("ensured db indexes exist")
+
+	// {{{2 Ensure capped collections exist
+	err = mDb.RunCommand(ctx, bson.D{
+		{"create", mDbWebhookDeliveries.Name()},
+		{"capped", true},
+		{"size", cfg.WebhookDeliveriesMaxBytes},
+	}).Err()
+	if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Code == mongoNamespaceExistsCode {
+		err = nil
+	}
+	if err != nil {
+		logger.Fatalf("failed to create webhook deliveries capped collection: %s",
+			err.Error())
+	}
+
+	logger.Debugf("ensured capped collections exist")
+
+	// {{{1 Registry repository provider
+	// {{{2 Create GitHub clients
+	// ghClients and gh are nil if the registry repository is not on GitHub
+	var ghClients *ghapp.Clients
+	var gh *github.Client
+
+	if cfg.RegistryProvider == scm.ProviderGitHub {
+		logger.Debug("authenticating with GitHub API")
+
+		ghClients, err = ghapp.NewClients(cfg, mDbInstallations)
+		if err != nil {
+			logger.Fatalf("failed to create GitHub API clients: %s", err.Error())
+		}
+
+		// gh authenticates as the installation which can access the registry
+		// repository
+		gh = ghClients.Registry()
+	}
+
+	// {{{2 Create provider
+	scmProvider, err := scm.NewProvider(cfg, gh)
+	if err != nil {
+		logger.Fatalf("failed to create registry repository provider: %s",
+			err.Error())
+	}
 
 	// {{{2 Ensure registry repository exists
-	_, _, err = gh.Repositories.Get(ctx, cfg.GhRegistryRepoOwner,
-		cfg.GhRegistryRepoName)
+	_, err = scmProvider.GetRefSHA(ctx, cfg.GhRegistryRepoBranch)
 	if err != nil {
 		logger.Fatalf("failed to get information about serverless application "+
 			"registry repository: %s", err.Error())
 	}
 
-	logger.Debug("authenticated with GitHub API")
+	logger.Debugf("authenticated with %s API", scmProvider.Name())
 
 	// {{{1 Setup Prometheus metrics
 	metricsInstance := metrics.NewMetrics()
@@ -138,14 +247,53 @@ func main() {
 	// shutdownWaitGroup is used to ensure that all components have gracefuly shut down before the process exists
 	var shutdownWaitGroup sync.WaitGroup
 
+	// {{{1 Outbox
+	outboxInstance := outbox.Outbox{
+		Ctx:       ctx,
+		Logger:    logger.GetChild("outbox"),
+		Cfg:       cfg,
+		Metrics:   metricsInstance,
+		MDbOutbox: mDbOutbox,
+	}
+
+	shutdownWaitGroup.Add(1)
+	go func() {
+		defer shutdownWaitGroup.Done()
+
+		logger.Debug("started outbox")
+
+		outboxInstance.Run()
+
+		logger.Debug("stopped outbox")
+	}()
+
+	// {{{1 Verifier
+	verifier := verification.Verifier{
+		MDbApps:              mDbApps,
+		MDbVerifications:     mDbVerifications,
+		MDbVerificationAudit: mDbVerificationAudit,
+	}
+
 	// {{{1 Job runner
 	jobRunner := &jobs.JobRunner{
-		Ctx:     ctx,
-		Logger:  logger.GetChild("job-runner"),
-		Cfg:     cfg,
-		Metrics: metricsInstance,
-		GH:      gh,
-		MDbApps: mDbApps,
+		Ctx:             ctx,
+		Logger:          logger.GetChild("job-runner"),
+		Cfg:             cfg,
+		Metrics:         metricsInstance,
+		SCM:             scmProvider,
+		GH:              gh,
+		GhClients:       ghClients,
+		MDbApps:         mDbApps,
+		MDbAppsStaging:  mDbAppsStaging,
+		MDbAppsPrevious: mDbAppsPrevious,
+		MDbSyncState:    mDbSyncState,
+		MDbSubmissions:  mDbSubmissions,
+		Outbox:          outboxInstance,
+		Events: events.Emitter{
+			Cfg:    cfg,
+			Outbox: outboxInstance,
+		},
+		Verifier: verifier,
 	}
 	jobRunner.Init()
 
@@ -172,6 +320,13 @@ func main() {
 	// the bot API after the update apps job is complete
 	var updateJobNotifyBotAPI bool
 
+	// updateJobFull indicates if the update apps job should re-parse every app
+	var updateJobFull bool
+
+	// doRollback indicates that the server should swap the current and previous
+	// generations of the apps collection and exit
+	var doRollback bool
+
 	// doSeed indicates that the server should import seed data into the datbase and exit
 	var doSeed bool
 
@@ -187,13 +342,41 @@ func main() {
 	// mockWebhookEvent is the X-Github-Event header value for the mock webhook request.
 	var mockWebhookEvent string
 
+	// doGenerateWebhook indicates that the server should generate a webhook payload.
+	// The value is the kind of payload, one of mockwebhook.Kinds
+	var doGenerateWebhook string
+
+	// fixture* options override values in the generated webhook payload
+	var fixturePRNum int
+	var fixtureHeadRef string
+	var fixtureHeadSHA string
+	var fixtureBeforeSHA string
+	var fixtureBaseRef string
+	var fixtureUser string
+	var fixtureFiles string
+	var fixtureInstallationID int64
+
+	// fixtureOut is the file the generated webhook payload is saved in
+	var fixtureOut string
+
+	// fixtureSend indicates the generated webhook payload should be sent to the server
+	var fixtureSend bool
+
 	flag.BoolVar(&doUpdateJob, "update-apps", false,
 		"If provided server will run one update job and exit. -notify-bot-api "+
-			"must be the only other option provided.")
+			"and -full must be the only other options provided.")
 	flag.BoolVar(&updateJobNotifyBotAPI, "notify-bot-api", false,
 		"Specifies if the server should make a new aps request to the bot "+
 			"API after it is finished running the update apps job. Can "+
 			"only be specified with the -update-apps option")
+	flag.BoolVar(&updateJobFull, "full", false,
+		"Specifies if the update apps job should re-parse every app instead of "+
+			"only the apps which changed since the last update. Can only be "+
+			"specified with the -update-apps option")
+	flag.BoolVar(&doRollback, "rollback-apps", false,
+		"If provided server will replace the apps in the database with the "+
+			"apps from before the last update and exit. Running again undoes "+
+			"the rollback. Must be the only option provided")
 	flag.BoolVar(&doSeed, "seed", false,
 		"If provided server will import seed data from the ./seed-data folder. This "+
 			"folder should hold JSON files which contain 1 app each. Must be "+
@@ -209,6 +392,34 @@ func main() {
 	flag.StringVar(&mockWebhookEvent, "mock-webhook-event", "",
 		"X-Github-Event header value for mock webhook request, -mock-webhook must be only "+
 			"other option provided.")
+	flag.StringVar(&doGenerateWebhook, "generate-webhook", "",
+		"If provided will generate a webhook payload of the specified kind, one of: "+
+			strings.Join(mockwebhook.Kinds, ", ")+". The -fixture-* options "+
+			"are the only other options allowed.")
+	flag.IntVar(&fixturePRNum, "fixture-pr", 0,
+		"Number of pull request to generate webhook payload for, its values are "+
+			"used unless overridden by other -fixture-* options")
+	flag.StringVar(&fixtureHeadRef, "fixture-head-ref", "",
+		"Head branch of pull request in generated webhook payload")
+	flag.StringVar(&fixtureHeadSHA, "fixture-head-sha", "",
+		"Head commit of pull request, or pushed commit, in generated webhook payload")
+	flag.StringVar(&fixtureBeforeSHA, "fixture-before-sha", "",
+		"Commit before a synchronize or push in generated webhook payload")
+	flag.StringVar(&fixtureBaseRef, "fixture-base-ref", cfg.GhRegistryRepoBranch,
+		"Branch pull request merges into, or which is pushed to, in generated "+
+			"webhook payload")
+	flag.StringVar(&fixtureUser, "fixture-user", "",
+		"Login of user who opened pull request, or pushed, in generated webhook payload")
+	flag.StringVar(&fixtureFiles, "fixture-files", "",
+		"Comma separated files modified by push in generated webhook payload")
+	flag.Int64Var(&fixtureInstallationID, "fixture-installation-id", 0,
+		"GitHub App installation ID in generated webhook payload, omitted if 0")
+	flag.StringVar(&fixtureOut, "fixture-out", "",
+		"File to save generated webhook payload in, for use with -mock-webhook. If "+
+			"not provided and -fixture-send is not provided the payload is printed")
+	flag.BoolVar(&fixtureSend, "fixture-send", false,
+		"If provided will send the generated webhook payload to the server's webhook "+
+			"endpoint and print the response")
 	flag.Parse()
 
 	// {{{2 Do actions
@@ -219,20 +430,58 @@ func main() {
 			logger.Info("will notify the bot API of new apps after the UpdateApps job runs")
 		}
 
-		jobDef := jobs.UpdateAppsJobDefinition{
-			NoBotAPINotify: !updateJobNotifyBotAPI,
+		outboxBatch := uuid.New().String()
+
+		// Each registry repository is updated by its own job
+		for _, registry := range cfg.RegistryRepos() {
+			jobDef := jobs.UpdateAppsJobDefinition{
+				NoBotAPINotify: !updateJobNotifyBotAPI,
+				Full:           updateJobFull,
+				OutboxBatch:    outboxBatch,
+				Registry:       jobs.NewRegistryRepo(0, registry),
+			}
+
+			jobDefBytes, err := json.Marshal(jobDef)
+			if err != nil {
+				logger.Fatalf("failed to marshal UpdateAppsJobDefinition to "+
+					"JSON: %s", err.Error())
+			}
+
+			req, err := jobRunner.Submit(jobs.JobTypeUpdateApps, jobDefBytes)
+			if err != nil {
+				logger.Fatalf("failed to submit UpdateApps job: %s", err.Error())
+			}
+
+			<-req.CompleteChan
+
+			if status := jobRunner.Status(req.ID); status != nil {
+				logger.Infof("UpdateApps job for %s %s", registry, status.State)
+			}
 		}
 
-		jobDefBytes, err := json.Marshal(jobDef)
-		if err != nil {
-			logger.Fatalf("failed to marshal UpdateAppsJobDefinition to JSON: %s",
-				err.Error())
+		// Deliver this run's notifications now b/c the outbox does not run in
+		// the background before exiting. Other messages are left for the
+		// server. If delivery fails it is retried the next time the server
+		// runs.
+		if err := outboxInstance.DeliverBatch(outboxBatch); err != nil {
+			logger.Errorf("failed to deliver notifications: %s", err.Error())
 		}
 
-		req := jobRunner.Submit(jobs.JobTypeUpdateApps, jobDefBytes)
+		os.Exit(0)
+	} else if doRollback {
+		logger.Info("rolling back apps then exiting")
+
+		req, err := jobRunner.Submit(jobs.JobTypeRollbackApps, nil)
+		if err != nil {
+			logger.Fatalf("failed to submit RollbackApps job: %s", err.Error())
+		}
 
 		<-req.CompleteChan
 
+		if status := jobRunner.Status(req.ID); status != nil {
+			logger.Infof("RollbackApps job %s", status.State)
+		}
+
 		os.Exit(0)
 	} else if doSeed {
 		logger.Info("seeding database then exiting")
@@ -303,8 +552,7 @@ func main() {
 		}
 
 		// Get PR
-		pr, _, err := gh.PullRequests.Get(ctx, cfg.GhRegistryRepoOwner,
-			cfg.GhRegistryRepoName, prNum)
+		pr, err := scmProvider.GetMergeRequest(ctx, prNum)
 		if err != nil {
 			logger.Fatalf("failed to get pull request with number %d: %s",
 				prNum, err.Error())
@@ -315,7 +563,10 @@ func main() {
 		if err != nil {
 			logger.Fatalf("failed to marshal PR into JSON: %s", err.Error())
 		}
-		req := jobRunner.Submit(jobs.JobTypeValidate, prBytes)
+		req, err := jobRunner.Submit(jobs.JobTypeValidate, prBytes)
+		if err != nil {
+			logger.Fatalf("failed to submit Validate job: %s", err.Error())
+		}
 		<-req.CompleteChan
 		os.Exit(0)
 	} else if len(doMockWebhook) > 0 {
@@ -338,46 +589,144 @@ func main() {
 				"for use as mock request body: %s", err.Error())
 		}
 
-		bodyReader := bytes.NewReader(bodyBytes)
+		// Make request
+		webhookURL := cfg.ExternalURL
+		webhookURL.Path = "/apps/webhook"
 
-		bodyReadCloser := req.ReaderDummyCloser{
-			bodyReader,
+		status, respBytes, err := mockwebhook.Send(webhookURL, scmProvider,
+			mockwebhook.Payload{
+				Event: mockWebhookEvent,
+				Body:  bodyBytes,
+			})
+		if err != nil {
+			logger.Fatalf("failed to make mock webhook request: %s", err.Error())
+		}
+
+		logger.Info("mock response:")
+		logger.Info(status)
+		logger.Info(string(respBytes))
+		os.Exit(0)
+	} else if len(doGenerateWebhook) > 0 {
+		logger.Infof("generating %s webhook payload then exiting",
+			doGenerateWebhook)
+
+		opts := mockwebhook.Options{
+			Kind:           doGenerateWebhook,
+			Provider:       cfg.RegistryProvider,
+			RepoOwner:      cfg.GhRegistryRepoOwner,
+			RepoName:       cfg.GhRegistryRepoName,
+			BaseRef:        fixtureBaseRef,
+			BeforeSHA:      fixtureBeforeSHA,
+			InstallationID: fixtureInstallationID,
 		}
 
-		// Make webhook request signature
-		sig := handlers.ComputeGHWebhookSignature([]byte(cfg.GhWebhookSecret), bodyBytes)
+		// Start with the pull request's real values
+		if fixturePRNum > 0 {
+			pr, err := scmProvider.GetMergeRequest(ctx, fixturePRNum)
+			if err != nil {
+				logger.Fatalf("failed to get pull request with number %d: %s",
+					fixturePRNum, err.Error())
+			}
 
-		// Make request
-		webhookURL := cfg.ExternalURL
-		webhookURL.Path = "/apps/webhook"
+			opts.MergeRequest = *pr
+		}
 
-		req := http.Request{
-			Method: "POST",
-			URL:    &webhookURL,
-			Header: map[string][]string{
-				"X-Hub-Signature": {sig},
-				"X-Github-Event":  {mockWebhookEvent},
-				"Conent-Type":     {"application/json"},
-			},
-			Body: bodyReadCloser,
+		if len(fixtureHeadRef) > 0 {
+			opts.MergeRequest.Head.Ref = fixtureHeadRef
+		}
+		if len(fixtureHeadSHA) > 0 {
+			opts.MergeRequest.Head.SHA = fixtureHeadSHA
+		}
+		if len(fixtureUser) > 0 {
+			opts.MergeRequest.User.Login = fixtureUser
+		}
+		if len(fixtureFiles) > 0 {
+			opts.Files = strings.Split(fixtureFiles, ",")
 		}
 
-		resp, err := http.DefaultClient.Do(&req)
+		payload, err := mockwebhook.Generate(opts)
 		if err != nil {
-			logger.Fatalf("failed to make mock webhook request: %s", err.Error())
+			logger.Fatalf("failed to generate webhook payload: %s", err.Error())
 		}
 
-		respBytes, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			logger.Fatalf("failed to read mock webhook response body: %s", err.Error())
+		// Save or print
+		if len(fixtureOut) > 0 {
+			if err := ioutil.WriteFile(fixtureOut, payload.Body, 0644); err != nil {
+				logger.Fatalf("failed to write webhook payload to %s: %s",
+					fixtureOut, err.Error())
+			}
+
+			logger.Infof("saved payload to %s, replay with: -mock-webhook %s "+
+				"-mock-webhook-event %s", fixtureOut, fixtureOut, payload.Event)
+		} else if !fixtureSend {
+			logger.Infof("%s payload:", payload.Event)
+			logger.Info(string(payload.Body))
+		}
+
+		// Send
+		if fixtureSend {
+			webhookURL := cfg.ExternalURL
+			webhookURL.Path = "/apps/webhook"
+
+			status, respBytes, err := mockwebhook.Send(webhookURL, scmProvider,
+				*payload)
+			if err != nil {
+				logger.Fatalf("failed to make mock webhook request: %s",
+					err.Error())
+			}
+
+			logger.Info("mock response:")
+			logger.Info(status)
+			logger.Info(string(respBytes))
 		}
 
-		logger.Info("mock response:")
-		logger.Info(resp.Status)
-		logger.Info(string(respBytes))
 		os.Exit(0)
 	}
 
+	// {{{1 Job scheduler
+	scheduler := &jobs.Scheduler{
+		Ctx:       ctx,
+		Logger:    logger.GetChild("job-scheduler"),
+		JobRunner: jobRunner,
+	}
+
+	// Each registry repository is updated by its own job
+	for _, registry := range cfg.RegistryRepos() {
+		jobDefBytes, err := json.Marshal(jobs.UpdateAppsJobDefinition{
+			Registry: jobs.NewRegistryRepo(0, registry),
+		})
+		if err != nil {
+			logger.Fatalf("failed to marshal UpdateAppsJobDefinition to JSON: %s",
+				err.Error())
+		}
+
+		if err := scheduler.Add("update-apps "+registry, cfg.UpdateAppsSchedule,
+			jobs.JobTypeUpdateApps, jobDefBytes); err != nil {
+			logger.Fatalf("failed to add update apps job schedule: %s",
+				err.Error())
+		}
+	}
+
+	// Sweeps are only registered if the registry repository is on GitHub
+	if gh != nil {
+		if err := scheduler.Add("stale-pr-sweep", cfg.StalePRSweepSchedule,
+			jobs.JobTypeStalePRSweep, nil); err != nil {
+			logger.Fatalf("failed to add stale PR sweep job schedule: %s",
+				err.Error())
+		}
+	}
+
+	shutdownWaitGroup.Add(1)
+	go func() {
+		defer shutdownWaitGroup.Done()
+
+		logger.Debug("started job scheduler")
+
+		scheduler.Run()
+
+		logger.Debug("stopped job scheduler")
+	}()
+
 	// {{{1 Load applications from database if none exist yet
 	go func() {
 		loadLogger := logger.GetChild("populate-apps-db")
@@ -398,7 +747,20 @@ func main() {
 		// {{{1 Load all apps if empty
 		loadLogger.Debugf("no apps found, will load apps into database")
 
-		jobRunner.Submit(jobs.JobTypeUpdateApps, nil)
+		for _, registry := range cfg.RegistryRepos() {
+			jobDefBytes, err := json.Marshal(jobs.UpdateAppsJobDefinition{
+				Full:     true,
+				Registry: jobs.NewRegistryRepo(0, registry),
+			})
+			if err != nil {
+				loadLogger.Fatalf("failed to marshal UpdateAppsJobDefinition to "+
+					"JSON: %s", err.Error())
+			}
+
+			if _, err := jobRunner.Submit(jobs.JobTypeUpdateApps, jobDefBytes); err != nil {
+				loadLogger.Fatalf("failed to submit UpdateApps job: %s", err.Error())
+			}
+		}
 	}()
 
 	// {{{1 Prometheus metrics server
@@ -459,7 +821,8 @@ func main() {
 	}).Methods("GET")
 
 	apiRouter.Handle("/apps", handlers.AppSearchHandler{
-		baseHandler.GetChild("app-search"),
+		BaseHandler: baseHandler.GetChild("app-search"),
+		MDbAppStats: mDbAppStats,
 	}).Methods("GET")
 
 	apiRouter.Handle("/apps/tags", handlers.AppTagsHandler{
@@ -470,27 +833,147 @@ func main() {
 		baseHandler.GetChild("get-apps-categories"),
 	}).Methods("GET")
 
-	apiRouter.Handle("/apps/webhook", handlers.WebhookHandler{
-		BaseHandler: baseHandler.GetChild("webhook"),
-		JobRunner:   jobRunner,
-	}).Methods("POST")
+	webhookHandler := handlers.WebhookHandler{
+		BaseHandler:              baseHandler.GetChild("webhook"),
+		JobRunner:                jobRunner,
+		MDbWebhookDeliveries:     mDbWebhookDeliveries,
+		MDbWebhookDeliveryClaims: mDbWebhookDeliveryClaims,
+		SCM:                      scmProvider,
+		GhClients:                ghClients,
+	}
+
+	apiRouter.Handle("/apps/webhook", webhookHandler).Methods("POST")
 
 	apiRouter.Handle("/apps/id/{id}/deployment-instructions", handlers.DeployInstructionsHandler{
 		baseHandler.GetChild("deploy-instructions"),
 	}).Methods("GET")
 
 	apiRouter.Handle("/nsearch", handlers.NaturalSearchHandler{
-		baseHandler.GetChild("nsearch"),
+		BaseHandler: baseHandler.GetChild("nsearch"),
+		MDbAppStats: mDbAppStats,
 	}).Methods("GET")
 
 	apiRouter.Handle("/apps/id/{appID}/deploy.sh", handlers.AppsDeployHandler{
-		baseHandler.GetChild("appsDeploy"),
+		BaseHandler: baseHandler.GetChild("appsDeploy"),
+		MDbAppStats: mDbAppStats,
 	}).Methods("GET")
 
 	apiRouter.Handle("/apps/id/{appID}/deployment.json", handlers.AppsDeployResourcesHandler{
-		baseHandler.GetChild("appsDeployResources"),
+		BaseHandler: baseHandler.GetChild("appsDeployResources"),
+		MDbAppStats: mDbAppStats,
+	}).Methods("GET")
+
+	apiRouter.Handle("/apps/id/{id}/verification", handlers.AppVerificationHandler{
+		BaseHandler: baseHandler.GetChild("app-verification"),
+		Verifier:    verifier,
 	}).Methods("GET")
 
+	apiRouter.Handle("/apps/id/{id}/verification", handlers.ReviewerAuthHandler{
+		BaseHandler: baseHandler.GetChild("reviewer-auth"),
+		Handler: handlers.AppVerificationTransitionHandler{
+			BaseHandler: baseHandler.GetChild("app-verification-transition"),
+			Verifier:    verifier,
+		},
+	}).Methods("POST")
+
+	apiRouter.Handle("/submissions", handlers.SubmissionsHandler{
+		BaseHandler:    baseHandler.GetChild("submissions"),
+		MDbSubmissions: mDbSubmissions,
+	}).Methods("GET")
+
+	apiRouter.Handle("/submissions/{pr}", handlers.SubmissionByPRHandler{
+		BaseHandler:    baseHandler.GetChild("submission-by-pr"),
+		MDbSubmissions: mDbSubmissions,
+	}).Methods("GET")
+
+	apiRouter.Handle("/submissions/{pr}/apps/{id}", handlers.SubmissionAppHandler{
+		BaseHandler:    baseHandler.GetChild("submission-app"),
+		MDbSubmissions: mDbSubmissions,
+	}).Methods("GET")
+
+	apiRouter.Handle("/submissions/{pr}/apps/{id}/deploy.sh", handlers.SubmissionAppDeployHandler{
+		BaseHandler:    baseHandler.GetChild("submission-app-deploy"),
+		MDbSubmissions: mDbSubmissions,
+	}).Methods("GET")
+
+	apiRouter.Handle("/submissions/{pr}/apps/{id}/deployment.json", handlers.SubmissionAppDeployResourcesHandler{
+		BaseHandler:    baseHandler.GetChild("submission-app-deploy-resources"),
+		MDbSubmissions: mDbSubmissions,
+	}).Methods("GET")
+
+	apiRouter.Handle("/admin/jobs/schedules", handlers.AdminAuthHandler{
+		BaseHandler: baseHandler.GetChild("admin-auth"),
+		Handler: handlers.JobSchedulesHandler{
+			BaseHandler: baseHandler.GetChild("job-schedules"),
+			Scheduler:   scheduler,
+		},
+	}).Methods("GET")
+
+	apiRouter.Handle("/admin/jobs", handlers.AdminAuthHandler{
+		BaseHandler: baseHandler.GetChild("admin-auth"),
+		Handler: handlers.JobsStatusHandler{
+			BaseHandler: baseHandler.GetChild("jobs-status"),
+			JobRunner:   jobRunner,
+		},
+	}).Methods("GET")
+
+	apiRouter.Handle("/admin/jobs/id/{id}", handlers.AdminAuthHandler{
+		BaseHandler: baseHandler.GetChild("admin-auth"),
+		Handler: handlers.JobStatusByIDHandler{
+			BaseHandler: baseHandler.GetChild("job-status-by-id"),
+			JobRunner:   jobRunner,
+		},
+	}).Methods("GET")
+
+	apiRouter.Handle("/admin/jobs/id/{id}/cancel", handlers.AdminAuthHandler{
+		BaseHandler: baseHandler.GetChild("admin-auth"),
+		Handler: handlers.JobCancelHandler{
+			BaseHandler: baseHandler.GetChild("job-cancel"),
+			JobRunner:   jobRunner,
+		},
+	}).Methods("POST")
+
+	apiRouter.Handle("/admin/apps/rollback", handlers.AdminAuthHandler{
+		BaseHandler: baseHandler.GetChild("admin-auth"),
+		Handler: handlers.AppsRollbackHandler{
+			BaseHandler: baseHandler.GetChild("apps-rollback"),
+			JobRunner:   jobRunner,
+		},
+	}).Methods("POST")
+
+	apiRouter.Handle("/admin/outbox", handlers.AdminAuthHandler{
+		BaseHandler: baseHandler.GetChild("admin-auth"),
+		Handler: handlers.OutboxMessagesHandler{
+			BaseHandler: baseHandler.GetChild("outbox-messages"),
+			Outbox:      outboxInstance,
+		},
+	}).Methods("GET")
+
+	apiRouter.Handle("/admin/outbox/id/{id}/replay", handlers.AdminAuthHandler{
+		BaseHandler: baseHandler.GetChild("admin-auth"),
+		Handler: handlers.OutboxReplayHandler{
+			BaseHandler: baseHandler.GetChild("outbox-replay"),
+			Outbox:      outboxInstance,
+		},
+	}).Methods("POST")
+
+	apiRouter.Handle("/admin/webhook/deliveries", handlers.AdminAuthHandler{
+		BaseHandler: baseHandler.GetChild("admin-auth"),
+		Handler: handlers.WebhookDeliveriesHandler{
+			BaseHandler:          baseHandler.GetChild("webhook-deliveries"),
+			MDbWebhookDeliveries: mDbWebhookDeliveries,
+		},
+	}).Methods("GET")
+
+	apiRouter.Handle("/admin/webhook/deliveries/id/{id}/replay", handlers.AdminAuthHandler{
+		BaseHandler: baseHandler.GetChild("admin-auth"),
+		Handler: handlers.WebhookDeliveryReplayHandler{
+			BaseHandler:          baseHandler.GetChild("webhook-delivery-replay"),
+			Webhook:              webhookHandler,
+			MDbWebhookDeliveries: mDbWebhookDeliveries,
+		},
+	}).Methods("POST")
+
 	// !!! Must always be last !!!
 	apiRouter.Handle("/", handlers.PreFlightOptionsHandler{
 		baseHandler.GetChild("pre-flight-options"),
@@ -546,3 +1029,15 @@ func main() {
 
 	logger.Info("done")
 }
+
+// isIndexNotFoundError returns true if err was caused by dropping an index, or an
+// index of a collection, which does not exist
+func isIndexNotFoundError(err error) bool {
+	cmdErr, ok := err.(mongo.CommandError)
+	if !ok {
+		return false
+	}
+
+	// Codes are IndexNotFound and NamespaceNotFound
+	return cmdErr.Code == 27 || cmdErr.Code == 26
+}
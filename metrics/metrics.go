@@ -24,6 +24,22 @@ type Metrics struct {
 	//
 	// Labels: job_type (jobs.JobStartRequest.Type field), successful (0 = fail, 1 = success)
 	JobsRunDurationsMilliseconds *prometheus.HistogramVec
+
+	// JobsPartialSuccessesTotal is the number of jobs which completed but failed to
+	// process some items.
+	//
+	// Labels: job_type (jobs.JobStartRequest.Type field)
+	JobsPartialSuccessesTotal *prometheus.CounterVec
+
+	// AppsParseFailures is the number of apps in the registry repository which
+	// failed to parse during the most recent update apps job.
+	AppsParseFailures prometheus.Gauge
+
+	// OutboxDeliveriesTotal is the number of outbox message delivery attempts.
+	//
+	// Labels: destination (models.OutboxMessage.Destination field),
+	// successful (0 = fail, 1 = success)
+	OutboxDeliveriesTotal *prometheus.CounterVec
 }
 
 // NewMetrics creates a Metrics struct with all the Prometheus metrics recorders initialized
@@ -47,11 +63,32 @@ func NewMetrics() Metrics {
 			Name:      "run_durations_milliseconds",
 			Help:      "Duration, in milliseconds, of jobs",
 		}, []string{"job_type", "successful"}),
+		JobsPartialSuccessesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "serverless_registry_api",
+			Subsystem: "jobs",
+			Name:      "partial_successes_total",
+			Help:      "Total number of jobs which failed to process some items",
+		}, []string{"job_type"}),
+		AppsParseFailures: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "serverless_registry_api",
+			Subsystem: "apps",
+			Name:      "parse_failures",
+			Help:      "Number of apps which failed to parse during the last update",
+		}),
+		OutboxDeliveriesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "serverless_registry_api",
+			Subsystem: "outbox",
+			Name:      "deliveries_total",
+			Help:      "Total number of outbox message delivery attempts",
+		}, []string{"destination", "successful"}),
 	}
 
 	prometheus.MustRegister(metrics.APIResponseDurationsMilliseconds)
 	prometheus.MustRegister(metrics.APIHandlerPanicsTotal)
 	prometheus.MustRegister(metrics.JobsRunDurationsMilliseconds)
+	prometheus.MustRegister(metrics.JobsPartialSuccessesTotal)
+	prometheus.MustRegister(metrics.AppsParseFailures)
+	prometheus.MustRegister(metrics.OutboxDeliveriesTotal)
 
 	return metrics
 }
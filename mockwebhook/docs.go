@@ -0,0 +1,9 @@
+/*
+Synthesize and send mock webhook requests.
+
+Generate builds event payloads shaped like those sent by the registry repository
+provider, for pull requests being opened, synchronized and merged, check suites
+and pushes. Payloads can be saved as fixtures for the -mock-webhook flag, or sent
+to a running server with Send, which signs them like the provider would.
+*/
+package mockwebhook
@@ -0,0 +1,404 @@
+package mockwebhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kscout/serverless-registry-api/scm"
+
+	"github.com/google/go-github/v26/github"
+	"github.com/google/uuid"
+)
+
+// Kinds of payloads which can be generated
+const (
+	KindOpened      = "opened"
+	KindSynchronize = "synchronize"
+	KindMerged      = "merged"
+	KindCheckSuite  = "check_suite"
+	KindPush        = "push"
+)
+
+// Kinds are all the kinds of payloads which can be generated
+var Kinds = []string{KindOpened, KindSynchronize, KindMerged, KindCheckSuite, KindPush}
+
+// Options specify the payload to generate
+type Options struct {
+	// Kind of payload, one of the Kind* constants
+	Kind string
+
+	// Provider is the name of the provider which would send the payload, one of
+	// the scm.Provider* constants
+	Provider string
+
+	// RepoOwner is the owner of the registry repository
+	RepoOwner string
+
+	// RepoName is the name of the registry repository
+	RepoName string
+
+	// BaseRef is the branch merge requests merge into, and the branch pushes are
+	// made to
+	BaseRef string
+
+	// MergeRequest is the merge request the payload is about. For pushes the
+	// head SHA is the pushed commit.
+	MergeRequest scm.MergeRequest
+
+	// BeforeSHA is the commit the branch pointed to before a synchronize or push
+	BeforeSHA string
+
+	// Files are the paths modified by a push
+	Files []string
+
+	// InstallationID is the ID of the GitHub App installation which sends the
+	// payload, omitted if 0
+	InstallationID int64
+}
+
+// Payload is a generated webhook request
+type Payload struct {
+	// Event is the provider's event type, sent in a header
+	Event string
+
+	// Body of the request
+	Body []byte
+}
+
+// Send makes a webhook request to a server signed with the provider's headers.
+// Returns the response status and body.
+func Send(webhookURL url.URL, provider scm.Provider, payload Payload) (string, []byte, error) {
+	req, err := http.NewRequest(http.MethodPost, webhookURL.String(),
+		bytes.NewReader(payload.Body))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create request: %s", err.Error())
+	}
+
+	req.Header = provider.WebhookHeaders(payload.Event, uuid.New().String(),
+		payload.Body)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to make request: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read response body: %s", err.Error())
+	}
+
+	return resp.Status, respBytes, nil
+}
+
+// Generate builds a webhook request payload
+func Generate(opts Options) (*Payload, error) {
+	var event string
+	var body interface{}
+	var err error
+
+	switch opts.Provider {
+	case scm.ProviderGitHub:
+		event, body, err = generateGitHub(opts)
+	case scm.ProviderGitLab:
+		event, body, err = generateGitLab(opts)
+	case scm.ProviderGitea:
+		event, body, err = generateGitea(opts)
+	default:
+		return nil, fmt.Errorf("unknown provider: %s", opts.Provider)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	bodyBytes, err := json.MarshalIndent(body, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload into JSON: %s", err.Error())
+	}
+
+	return &Payload{
+		Event: event,
+		Body:  bodyBytes,
+	}, nil
+}
+
+// unknownKindError returns the error for a kind a provider can not generate
+func unknownKindError(opts Options) error {
+	return fmt.Errorf("cannot generate %s payload for %s, must be one of: %s",
+		opts.Kind, opts.Provider, strings.Join(Kinds, ", "))
+}
+
+// generateGitHub builds a GitHub webhook payload
+func generateGitHub(opts Options) (string, interface{}, error) {
+	// {{{1 Common objects
+	fullName := fmt.Sprintf("%s/%s", opts.RepoOwner, opts.RepoName)
+	repo := &github.Repository{
+		Name:     &opts.RepoName,
+		FullName: &fullName,
+		Owner: &github.User{
+			Login: &opts.RepoOwner,
+		},
+	}
+
+	user := &github.User{
+		Login: &opts.MergeRequest.User.Login,
+		Type:  github.String("User"),
+	}
+
+	var installation *github.Installation
+	if opts.InstallationID != 0 {
+		installation = &github.Installation{
+			ID: &opts.InstallationID,
+		}
+	}
+
+	mr := opts.MergeRequest
+	pr := &github.PullRequest{
+		Number: &mr.Number,
+		State:  github.String(scm.MergeRequestStateOpen),
+		Merged: github.Bool(false),
+		Head: &github.PullRequestBranch{
+			Ref:  &mr.Head.Ref,
+			SHA:  &mr.Head.SHA,
+			Repo: repo,
+		},
+		Base: &github.PullRequestBranch{
+			Ref:  &opts.BaseRef,
+			Repo: repo,
+		},
+		User: user,
+	}
+
+	prEvent := github.PullRequestEvent{
+		Number:       &mr.Number,
+		PullRequest:  pr,
+		Repo:         repo,
+		Sender:       user,
+		Installation: installation,
+	}
+
+	// {{{1 Build event
+	switch opts.Kind {
+	case KindOpened:
+		prEvent.Action = github.String("opened")
+
+		return "pull_request", prEvent, nil
+	case KindSynchronize:
+		prEvent.Action = github.String("synchronize")
+
+		// go-github does not include the commits in synchronize events
+		return "pull_request", struct {
+			github.PullRequestEvent
+			Before string `json:"before"`
+			After  string `json:"after"`
+		}{prEvent, opts.BeforeSHA, mr.Head.SHA}, nil
+	case KindMerged:
+		prEvent.Action = github.String("closed")
+		pr.State = github.String(scm.MergeRequestStateClosed)
+		pr.Merged = github.Bool(true)
+		mergedAt := time.Now()
+		pr.MergedAt = &mergedAt
+
+		return "pull_request", prEvent, nil
+	case KindCheckSuite:
+		// Check suites only include a summary of each pull request
+		return "check_suite", github.CheckSuiteEvent{
+			Action: github.String("rerequested"),
+			CheckSuite: &github.CheckSuite{
+				HeadBranch: &mr.Head.Ref,
+				HeadSHA:    &mr.Head.SHA,
+				Status:     github.String("queued"),
+				PullRequests: []*github.PullRequest{&github.PullRequest{
+					Number: &mr.Number,
+					Head:   pr.Head,
+					Base:   pr.Base,
+				}},
+			},
+			Repo:         repo,
+			Sender:       user,
+			Installation: installation,
+		}, nil
+	case KindPush:
+		commit := github.PushEventCommit{
+			ID:       &mr.Head.SHA,
+			Message:  github.String("Mock commit"),
+			Modified: opts.Files,
+			Added:    []string{},
+			Removed:  []string{},
+		}
+
+		return "push", github.PushEvent{
+			Ref:        github.String("refs/heads/" + opts.BaseRef),
+			Before:     &opts.BeforeSHA,
+			After:      &mr.Head.SHA,
+			Size:       github.Int(1),
+			Commits:    []github.PushEventCommit{commit},
+			HeadCommit: &commit,
+			Created:    github.Bool(false),
+			Deleted:    github.Bool(false),
+			Forced:     github.Bool(false),
+			Repo: &github.PushEventRepository{
+				Name:     &opts.RepoName,
+				FullName: &fullName,
+				Owner: &github.User{
+					Login: &opts.RepoOwner,
+				},
+			},
+			Pusher:       user,
+			Sender:       user,
+			Installation: installation,
+		}, nil
+	default:
+		return "", nil, unknownKindError(opts)
+	}
+}
+
+// generateGitLab builds a GitLab webhook payload
+func generateGitLab(opts Options) (string, interface{}, error) {
+	mr := opts.MergeRequest
+
+	project := map[string]interface{}{
+		"name":                opts.RepoName,
+		"path_with_namespace": fmt.Sprintf("%s/%s", opts.RepoOwner, opts.RepoName),
+		"default_branch":      opts.BaseRef,
+	}
+
+	user := map[string]interface{}{
+		"username": mr.User.Login,
+	}
+
+	attrs := map[string]interface{}{
+		"iid":           mr.Number,
+		"state":         "opened",
+		"source_branch": mr.Head.Ref,
+		"target_branch": opts.BaseRef,
+		"last_commit": map[string]interface{}{
+			"id": mr.Head.SHA,
+		},
+	}
+
+	mrEvent := map[string]interface{}{
+		"object_kind":       "merge_request",
+		"event_type":        "merge_request",
+		"user":              user,
+		"project":           project,
+		"object_attributes": attrs,
+	}
+
+	switch opts.Kind {
+	case KindOpened:
+		attrs["action"] = "open"
+
+		return "Merge Request Hook", mrEvent, nil
+	case KindSynchronize:
+		attrs["action"] = "update"
+		attrs["oldrev"] = opts.BeforeSHA
+
+		return "Merge Request Hook", mrEvent, nil
+	case KindMerged:
+		attrs["action"] = "merge"
+		attrs["state"] = "merged"
+
+		return "Merge Request Hook", mrEvent, nil
+	case KindPush:
+		return "Push Hook", map[string]interface{}{
+			"object_kind":         "push",
+			"event_name":          "push",
+			"ref":                 "refs/heads/" + opts.BaseRef,
+			"before":              opts.BeforeSHA,
+			"after":               mr.Head.SHA,
+			"user_username":       mr.User.Login,
+			"project":             project,
+			"total_commits_count": 1,
+			"commits": []map[string]interface{}{map[string]interface{}{
+				"id":       mr.Head.SHA,
+				"message":  "Mock commit",
+				"added":    []string{},
+				"modified": opts.Files,
+				"removed":  []string{},
+			}},
+		}, nil
+	default:
+		return "", nil, unknownKindError(opts)
+	}
+}
+
+// generateGitea builds a Gitea webhook payload
+func generateGitea(opts Options) (string, interface{}, error) {
+	mr := opts.MergeRequest
+
+	repo := map[string]interface{}{
+		"name":      opts.RepoName,
+		"full_name": fmt.Sprintf("%s/%s", opts.RepoOwner, opts.RepoName),
+		"owner": map[string]interface{}{
+			"login": opts.RepoOwner,
+		},
+	}
+
+	user := map[string]interface{}{
+		"login": mr.User.Login,
+	}
+
+	pr := map[string]interface{}{
+		"number": mr.Number,
+		"state":  scm.MergeRequestStateOpen,
+		"merged": false,
+		"head": map[string]interface{}{
+			"ref": mr.Head.Ref,
+			"sha": mr.Head.SHA,
+		},
+		"base": map[string]interface{}{
+			"ref": opts.BaseRef,
+		},
+		"user": user,
+	}
+
+	prEvent := map[string]interface{}{
+		"number":       mr.Number,
+		"pull_request": pr,
+		"repository":   repo,
+		"sender":       user,
+	}
+
+	switch opts.Kind {
+	case KindOpened:
+		prEvent["action"] = "opened"
+
+		return "pull_request", prEvent, nil
+	case KindSynchronize:
+		prEvent["action"] = "synchronized"
+
+		return "pull_request", prEvent, nil
+	case KindMerged:
+		prEvent["action"] = "closed"
+		pr["state"] = scm.MergeRequestStateClosed
+		pr["merged"] = true
+
+		return "pull_request", prEvent, nil
+	case KindPush:
+		return "push", map[string]interface{}{
+			"ref":    "refs/heads/" + opts.BaseRef,
+			"before": opts.BeforeSHA,
+			"after":  mr.Head.SHA,
+			"commits": []map[string]interface{}{map[string]interface{}{
+				"id":       mr.Head.SHA,
+				"message":  "Mock commit",
+				"added":    []string{},
+				"modified": opts.Files,
+				"removed":  []string{},
+			}},
+			"repository": repo,
+			"pusher":     user,
+			"sender":     user,
+		}, nil
+	default:
+		return "", nil, unknownKindError(opts)
+	}
+}
@@ -0,0 +1,163 @@
+package mockwebhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/kscout/serverless-registry-api/config"
+	"github.com/kscout/serverless-registry-api/scm"
+
+	"github.com/google/go-github/v26/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// testOptions returns options for generating a payload of kind
+func testOptions(provider, kind string) Options {
+	return Options{
+		Kind:      kind,
+		Provider:  provider,
+		RepoOwner: "kscout",
+		RepoName:  "serverless-apps",
+		BaseRef:   "master",
+		MergeRequest: scm.MergeRequest{
+			Number: 7,
+			Head: scm.MergeRequestHead{
+				Ref: "new-app",
+				SHA: "def",
+			},
+			User: scm.MergeRequestUser{
+				Login: "alice",
+			},
+		},
+		BeforeSHA: "abc",
+		Files:     []string{"new-app/manifest.yaml"},
+	}
+}
+
+// testProviders returns every provider, configured for parsing payloads
+func testProviders() []scm.Provider {
+	cfg := &config.Config{
+		GhWebhookSecret:       "github",
+		RegistryWebhookSecret: "secret",
+	}
+
+	return []scm.Provider{scm.GitHub{Cfg: cfg}, scm.NewGitLab(cfg), scm.NewGitea(cfg)}
+}
+
+func TestGenerateParses(t *testing.T) {
+	expectedActions := map[string]string{
+		KindOpened:      scm.MergeRequestActionOpened,
+		KindSynchronize: scm.MergeRequestActionUpdated,
+		KindMerged:      scm.MergeRequestActionClosed,
+	}
+
+	for _, provider := range testProviders() {
+		for kind, action := range expectedActions {
+			payload, err := Generate(testOptions(provider.Name(), kind))
+			assert.NoError(t, err, provider.Name(), kind)
+
+			event, err := provider.ParseWebhook(payload.Event, payload.Body)
+			assert.NoError(t, err, provider.Name(), kind)
+
+			assert.Equal(t, scm.WebhookEventMergeRequest, event.Kind, provider.Name(), kind)
+			assert.Equal(t, action, event.Action, provider.Name(), kind)
+			assert.Equal(t, "kscout/serverless-apps", event.Repository, provider.Name(), kind)
+			assert.Equal(t, 7, event.MergeRequest.Number, provider.Name(), kind)
+			assert.Equal(t, "new-app", event.MergeRequest.Head.Ref, provider.Name(), kind)
+			assert.Equal(t, "def", event.MergeRequest.Head.SHA, provider.Name(), kind)
+			assert.Equal(t, kind == KindMerged, event.MergeRequest.Merged, provider.Name(), kind)
+		}
+
+		payload, err := Generate(testOptions(provider.Name(), KindPush))
+		assert.NoError(t, err, provider.Name())
+
+		event, err := provider.ParseWebhook(payload.Event, payload.Body)
+		assert.NoError(t, err, provider.Name())
+
+		assert.Equal(t, scm.WebhookEventPush, event.Kind, provider.Name())
+		assert.Equal(t, "refs/heads/master", event.Ref, provider.Name())
+		assert.False(t, event.Deleted, provider.Name())
+	}
+}
+
+func TestGenerateGitHubEvents(t *testing.T) {
+	// Merged pull request
+	opts := testOptions(scm.ProviderGitHub, KindMerged)
+	opts.InstallationID = 3
+
+	payload, err := Generate(opts)
+	assert.NoError(t, err)
+
+	var prEvent github.PullRequestEvent
+	assert.NoError(t, json.Unmarshal(payload.Body, &prEvent))
+	assert.Equal(t, "closed", prEvent.GetAction())
+	assert.True(t, prEvent.GetPullRequest().GetMerged())
+	assert.Equal(t, int64(3), prEvent.GetInstallation().GetID())
+
+	// Check suite
+	payload, err = Generate(testOptions(scm.ProviderGitHub, KindCheckSuite))
+	assert.NoError(t, err)
+	assert.Equal(t, "check_suite", payload.Event)
+
+	var checkEvent github.CheckSuiteEvent
+	assert.NoError(t, json.Unmarshal(payload.Body, &checkEvent))
+	assert.Equal(t, "rerequested", checkEvent.GetAction())
+	assert.Equal(t, "def", checkEvent.GetCheckSuite().GetHeadSHA())
+	assert.Equal(t, 7, checkEvent.GetCheckSuite().PullRequests[0].GetNumber())
+	assert.Nil(t, checkEvent.Installation)
+
+	// Push
+	payload, err = Generate(testOptions(scm.ProviderGitHub, KindPush))
+	assert.NoError(t, err)
+
+	var pushEvent github.PushEvent
+	assert.NoError(t, json.Unmarshal(payload.Body, &pushEvent))
+	assert.Equal(t, []string{"new-app/manifest.yaml"}, pushEvent.Commits[0].Modified)
+}
+
+func TestGenerateUnsupported(t *testing.T) {
+	_, err := Generate(testOptions(scm.ProviderGitLab, KindCheckSuite))
+	assert.Error(t, err)
+
+	_, err = Generate(testOptions(scm.ProviderGitHub, "unknown"))
+	assert.Error(t, err)
+
+	_, err = Generate(testOptions("unknown", KindOpened))
+	assert.Error(t, err)
+}
+
+func TestSend(t *testing.T) {
+	for _, provider := range testProviders() {
+		payload, err := Generate(testOptions(provider.Name(), KindOpened))
+		assert.NoError(t, err, provider.Name())
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			assert.NoError(t, err, provider.Name())
+			assert.Equal(t, payload.Body, body, provider.Name())
+
+			eventType, err := provider.WebhookEventType(r)
+			assert.NoError(t, err, provider.Name())
+			assert.Equal(t, payload.Event, eventType, provider.Name())
+
+			assert.NoError(t, provider.VerifyWebhook(r, body), provider.Name())
+
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"ok": true}`))
+		}))
+
+		serverURL, err := url.Parse(server.URL)
+		assert.NoError(t, err, provider.Name())
+
+		status, respBody, err := Send(*serverURL, provider, *payload)
+		assert.NoError(t, err, provider.Name())
+		assert.Equal(t, "202 Accepted", status, provider.Name())
+		assert.Equal(t, `{"ok": true}`, string(respBody), provider.Name())
+
+		server.Close()
+	}
+}
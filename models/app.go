@@ -1,5 +1,9 @@
 package models
 
+import (
+	"time"
+)
+
 // App is a serverless application from the repository
 // Stores the json file format of the response
 type App struct {
@@ -34,7 +38,8 @@ type App struct {
 	LogoURL string `json:"logo_url" bson:"logo_url" validate:"required,url"`
 
 	// VerificationStatus indicates the stage of the verification process the app
-	// is currently in. Can be one of: "pending", "verifying", "good", "bad"
+	// is currently in. One of the VerificationStatus* constants. Managed by the
+	// verification package.
 	VerificationStatus string `json:"verification_status" bson:"verification_status" validate:"required"`
 
 	// GitHubURL is a link to the GitHub files for the app in the serverless apps registry repository
@@ -48,6 +53,32 @@ type App struct {
 
 	// SiteURL is a link to the application on the website
 	SiteURL string `json:"site_url" bson:"site_url" validate:"required"`
+
+	// Registry is the lowercase full name, in the format owner/name, of the
+	// registry repository the app is from. Empty for apps saved before registries
+	// were recorded, which are from the configured registry repository.
+	Registry string `json:"registry" bson:"registry,omitempty"`
+
+	// UpdatedAt is the last time the app's content changed in the registry
+	// repository. Zero if the app has not changed since this was first recorded.
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+
+	// ParseFailure is set if the latest version of the app in the registry
+	// repository failed to parse. In this case the other fields hold the last
+	// version of the app which parsed successfully. Nil if the app parsed.
+	ParseFailure *AppParseFailure `json:"parse_failure,omitempty" bson:"parse_failure,omitempty"`
+}
+
+// AppParseFailure records why an app failed to parse
+type AppParseFailure struct {
+	// Errors which occurred while parsing
+	Errors []string `json:"errors" bson:"errors"`
+
+	// CommitSHA is the registry repository commit at which the app failed to parse
+	CommitSHA string `json:"commit_sha" bson:"commit_sha"`
+
+	// FailedAt is the time the app failed to parse
+	FailedAt time.Time `json:"failed_at" bson:"failed_at"`
 }
 
 // ContactInfo
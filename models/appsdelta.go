@@ -0,0 +1,41 @@
+package models
+
+// AppsDeltaFormatVersion is the version of the AppsDelta format. Incremented
+// whenever the format changes in a way which is not backwards compatible.
+const AppsDeltaFormatVersion = 1
+
+// AppsDelta describes the apps which changed between two generations of the apps
+// collection
+type AppsDelta struct {
+	// FormatVersion is the AppsDeltaFormatVersion the delta was created with
+	FormatVersion int `json:"format_version"`
+
+	// CommitSHA is the registry repository commit of the new generation
+	CommitSHA string `json:"commit_sha"`
+
+	// Created are apps which did not exist in the previous generation
+	Created []AppChange `json:"created"`
+
+	// Updated are apps which changed between generations
+	Updated []AppChange `json:"updated"`
+
+	// Deleted are apps which do not exist in the new generation
+	Deleted []AppChange `json:"deleted"`
+}
+
+// Empty returns true if no apps changed
+func (d AppsDelta) Empty() bool {
+	return len(d.Created) == 0 && len(d.Updated) == 0 && len(d.Deleted) == 0
+}
+
+// AppChange holds the previous and current versions of an app
+type AppChange struct {
+	// AppID identifies the app
+	AppID string `json:"app_id"`
+
+	// Previous is the app in the previous generation, nil if the app was created
+	Previous *App `json:"previous"`
+
+	// Current is the app in the new generation, nil if the app was deleted
+	Current *App `json:"current"`
+}
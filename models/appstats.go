@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// AppStats records how often an app is used. Stored in the app_stats collection,
+// separately from apps so stats are kept when a new generation of apps is
+// swapped in.
+type AppStats struct {
+	// AppID is the ID of the app
+	AppID string `json:"app_id" bson:"app_id"`
+
+	// Deploys is the number of times the app's deployment script or deployment
+	// file was downloaded
+	Deploys int64 `json:"deploys" bson:"deploys"`
+
+	// LastDeployedAt is the last time the app was deployed
+	LastDeployedAt time.Time `json:"last_deployed_at" bson:"last_deployed_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// Installation is an installation of the GitHub App on an account. Stored in the
+// installations collection.
+type Installation struct {
+	// ID is the GitHub installation ID
+	ID int64 `json:"id" bson:"_id"`
+
+	// Account is the login of the user or organization the app is installed on
+	Account string `json:"account" bson:"account"`
+
+	// Repositories are the full names, in the format owner/name, of the
+	// repositories the installation can access. Lowercase.
+	Repositories []string `json:"repositories" bson:"repositories"`
+
+	// UpdatedAt is the last time the installation was changed
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+// Outbox message statuses
+const (
+	// OutboxStatusHeld indicates the message will be delivered once the change
+	// it describes has been committed
+	OutboxStatusHeld = "held"
+
+	// OutboxStatusPending indicates the message is waiting to be delivered
+	OutboxStatusPending = "pending"
+
+	// OutboxStatusDelivered indicates the message was delivered
+	OutboxStatusDelivered = "delivered"
+
+	// OutboxStatusFailed indicates the message could not be delivered after the
+	// maximum number of attempts
+	OutboxStatusFailed = "failed"
+
+	// OutboxStatusDiscarded indicates the message was held and the change it
+	// describes was not committed
+	OutboxStatusDiscarded = "discarded"
+)
+
+// OutboxMessage is an HTTP request which must be delivered to an external service.
+// Stored in the outbox collection.
+type OutboxMessage struct {
+	// ID uniquely identifies the message
+	ID string `json:"id" bson:"_id"`
+
+	// Destination identifies the service the message is sent to. Headers with
+	// secrets for the destination are added when the message is delivered so
+	// they are never stored.
+	Destination string `json:"destination" bson:"destination"`
+
+	// URL the message is sent to
+	URL string `json:"url" bson:"url"`
+
+	// Headers sent with the message
+	Headers map[string]string `json:"headers" bson:"headers"`
+
+	// Body of the message
+	Body string `json:"body" bson:"body"`
+
+	// Status of delivery
+	Status string `json:"status" bson:"status"`
+
+	// Attempts is the number of times delivery has been attempted
+	Attempts int `json:"attempts" bson:"attempts"`
+
+	// NextAttemptAt is the earliest time the next delivery attempt will be made
+	NextAttemptAt time.Time `json:"next_attempt_at" bson:"next_attempt_at"`
+
+	// LastError is the reason the last delivery attempt failed
+	LastError string `json:"last_error,omitempty" bson:"last_error"`
+
+	// Batch identifies the run which created the message, so the run can deliver
+	// its own messages. Empty if not set by the creator.
+	Batch string `json:"batch,omitempty" bson:"batch,omitempty"`
+
+	// CreatedAt is the time the message was created
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+
+	// DeliveredAt is the time the message was delivered, nil if not delivered
+	DeliveredAt *time.Time `json:"delivered_at" bson:"delivered_at"`
+}
@@ -1,31 +1,90 @@
 package models
 
+import (
+	"time"
+)
+
+// Submission statuses
+const (
+	// SubmissionStatusValid indicates every app in the submission is valid
+	SubmissionStatusValid = "valid"
+
+	// SubmissionStatusInvalid indicates some apps in the submission are not valid
+	SubmissionStatusInvalid = "invalid"
+
+	// SubmissionStatusInternalError indicates the submission could not be
+	// validated due to a server error
+	SubmissionStatusInternalError = "internal_error"
+)
+
 // Submission holds information about a serverless application which is
 // being submitted to the registry repository.
 // Currently applications are submitted via pull requests.
+// Stored in the submissions collection.
 type Submission struct {
 	// PRNumber is the user facing ID number of the pull request
-	PRNumber int `bson:"pr_number"`
+	PRNumber int `json:"pr_number" bson:"pr_number"`
+
+	// Registry is the lowercase full name, in the format owner/name, of the
+	// registry repository the pull request was made in. Empty for submissions
+	// saved before registries were recorded, which are from the configured
+	// registry repository.
+	Registry string `json:"registry" bson:"registry,omitempty"`
+
+	// HeadSHA is the pull request commit which was last validated
+	HeadSHA string `json:"head_sha" bson:"head_sha"`
+
+	// Status of the submission, one of the SubmissionStatus* constants
+	Status string `json:"status" bson:"status"`
 
 	// Apps are the applications which are currently in the pull request.
 	// Keys are app IDs.
 	// A value can be nil if an internal system error occurred while parsing /
 	// loading the app.
-	Apps map[string]*SubmissionApp `bson:"apps"`
+	Apps map[string]*SubmissionApp `json:"apps" bson:"apps"`
+
+	// DeletedAppIDs are the IDs of apps which the pull request deletes
+	DeletedAppIDs []string `json:"deleted_app_ids" bson:"deleted_app_ids"`
+
+	// ValidatedAt is the time the submission was last validated
+	ValidatedAt time.Time `json:"validated_at" bson:"validated_at"`
 }
 
 // SubmissionApp associates an app in a submission with a verification status entry
 type SubmissionApp struct {
 	// App is an app which is present in the submission, nil if
 	// the VerificationStatus.FormatCorrect field is false.
-	App *App `bson:"app"`
+	App *App `json:"app" bson:"app"`
 
 	// VerificationStatus of the App
-	VerificationStatus AppVerificationStatus `bson:"verification_status"`
+	VerificationStatus AppVerificationStatus `json:"verification_status" bson:"verification_status"`
+
+	// ParseErrors are the reasons the app failed to parse, empty if
+	// VerificationStatus.FormatCorrect is true
+	ParseErrors []SubmissionParseError `json:"parse_errors" bson:"parse_errors"`
 }
 
 // AppVerificationStatus holds the verification status of an app
 type AppVerificationStatus struct {
 	// FormatCorrect indicates if the app submission files are formatted correctly
-	FormatCorrect bool `bson:"format_correct"`
+	FormatCorrect bool `json:"format_correct" bson:"format_correct"`
+}
+
+// SubmissionParseError is a user presentable reason an app in a submission failed
+// to parse
+type SubmissionParseError struct {
+	// Code identifies the type of error
+	Code string `json:"code" bson:"code"`
+
+	// What failed to parse
+	What string `json:"what" bson:"what"`
+
+	// Why it failed to parse
+	Why string `json:"why" bson:"why"`
+
+	// FixInstructions tell the user how to fix the error, empty if Internal
+	FixInstructions string `json:"fix_instructions" bson:"fix_instructions"`
+
+	// Internal indicates the error was caused by the server
+	Internal bool `json:"internal" bson:"internal"`
 }
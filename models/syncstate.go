@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+)
+
+// SyncState IDs
+const (
+	// SyncStateAppsID is the ID of the state of the apps collection
+	SyncStateAppsID = "apps"
+
+	// SyncStateAppsPreviousID is the ID of the state of the apps_previous
+	// collection, which holds the previous generation of the apps collection
+	SyncStateAppsPreviousID = "apps_previous"
+)
+
+// SyncState records how far a collection has been synchronized with the registry
+// repository. Stored in the sync_state collection.
+type SyncState struct {
+	// ID identifies what is being synchronized
+	ID string `json:"id" bson:"_id"`
+
+	// CommitSHA is the registry repository commit which was last synchronized
+	CommitSHA string `json:"commit_sha" bson:"commit_sha"`
+
+	// SyncedAt is the time the last synchronization completed
+	SyncedAt time.Time `json:"synced_at" bson:"synced_at"`
+
+	// Generation is incremented every time the collection is replaced
+	Generation int `json:"generation" bson:"generation"`
+
+	// FailedIDs are the IDs of items which failed to synchronize. These will be
+	// retried during the next synchronization even if they have not changed.
+	FailedIDs []string `json:"failed_ids" bson:"failed_ids"`
+
+	// Registries hold how far each registry repository, other than the
+	// configured registry repository, has been synchronized. The configured
+	// registry repository's state is held by the CommitSHA and FailedIDs fields.
+	Registries []RegistrySyncState `json:"registries" bson:"registries"`
+}
+
+// RegistrySyncState records how far a collection has been synchronized with one
+// registry repository
+type RegistrySyncState struct {
+	// Registry is the lowercase full name, in the format owner/name, of the
+	// registry repository
+	Registry string `json:"registry" bson:"registry"`
+
+	// CommitSHA is the registry repository commit which was last synchronized
+	CommitSHA string `json:"commit_sha" bson:"commit_sha"`
+
+	// FailedIDs are the IDs of items which failed to synchronize
+	FailedIDs []string `json:"failed_ids" bson:"failed_ids"`
+}
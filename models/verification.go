@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+)
+
+// App verification statuses
+const (
+	// VerificationStatusPending indicates the app has not been reviewed
+	VerificationStatusPending = "pending"
+
+	// VerificationStatusVerifying indicates a reviewer is reviewing the app
+	VerificationStatusVerifying = "verifying"
+
+	// VerificationStatusGood indicates a reviewer found the app works and is safe
+	VerificationStatusGood = "good"
+
+	// VerificationStatusBad indicates a reviewer found a problem with the app
+	VerificationStatusBad = "bad"
+)
+
+// AppVerification is the current verification status of an app. Stored in the
+// app_verifications collection, which is the source of the App.VerificationStatus
+// field.
+type AppVerification struct {
+	// AppID is the ID of the app
+	AppID string `json:"app_id" bson:"_id"`
+
+	// Status is the verification status, one of the VerificationStatus* constants
+	Status string `json:"status" bson:"status"`
+
+	// Version of the app which Status applies to
+	Version string `json:"version" bson:"version"`
+
+	// Reason for the last transition
+	Reason string `json:"reason" bson:"reason"`
+
+	// Reviewer who made the last transition, empty if made by the server
+	Reviewer string `json:"reviewer" bson:"reviewer"`
+
+	// UpdatedAt is the time of the last transition
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// VerificationTransition records a change of an app's verification status. Stored
+// in the verification_audit collection.
+type VerificationTransition struct {
+	// ID uniquely identifies the transition
+	ID string `json:"id" bson:"_id"`
+
+	// AppID is the ID of the app
+	AppID string `json:"app_id" bson:"app_id"`
+
+	// Version of the app when the transition was made
+	Version string `json:"version" bson:"version"`
+
+	// From is the status before the transition
+	From string `json:"from" bson:"from"`
+
+	// To is the status after the transition
+	To string `json:"to" bson:"to"`
+
+	// Reason the transition was made
+	Reason string `json:"reason" bson:"reason"`
+
+	// Reviewer who made the transition, empty if made by the server
+	Reviewer string `json:"reviewer" bson:"reviewer"`
+
+	// CreatedAt is the time the transition was made
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+)
+
+// WebhookDelivery is a verified request made to the webhook endpoint. Stored in the
+// capped webhook_deliveries collection.
+type WebhookDelivery struct {
+	// ID identifies the recorded request. A delivery which is sent again after
+	// failing is recorded once per request.
+	ID string `json:"id" bson:"_id"`
+
+	// DeliveryID is the X-GitHub-Delivery header value which identifies the
+	// delivery
+	DeliveryID string `json:"delivery_id" bson:"delivery_id"`
+
+	// Event is the X-GitHub-Event header value
+	Event string `json:"event" bson:"event"`
+
+	// Action is the action field of the payload, empty if the event does not
+	// have actions
+	Action string `json:"action" bson:"action"`
+
+	// Payload is the request body
+	Payload string `json:"payload" bson:"payload"`
+
+	// JobIDs are the IDs of jobs submitted due to the delivery
+	JobIDs []string `json:"job_ids" bson:"job_ids"`
+
+	// ResponseStatus is the HTTP status code of the response
+	ResponseStatus int `json:"response_status" bson:"response_status"`
+
+	// Response is the response body
+	Response string `json:"response" bson:"response"`
+
+	// ReplayOf is the ID of the recorded request which was replayed, empty if the
+	// request was not a replay
+	ReplayOf string `json:"replay_of" bson:"replay_of"`
+
+	// ReceivedAt is the time the delivery was received
+	ReceivedAt time.Time `json:"received_at" bson:"received_at"`
+}
+
+// Statuses of a WebhookDeliveryClaim
+const (
+	// WebhookDeliveryClaimProcessing indicates the delivery is being handled
+	WebhookDeliveryClaimProcessing = "processing"
+
+	// WebhookDeliveryClaimHandled indicates the delivery was handled with a 2xx
+	// response
+	WebhookDeliveryClaimHandled = "handled"
+
+	// WebhookDeliveryClaimFailed indicates the delivery was handled with a non 2xx
+	// response, it will be handled again if sent again
+	WebhookDeliveryClaimFailed = "failed"
+)
+
+// WebhookDeliveryClaim ensures a delivery is only handled once. Stored in the
+// webhook_delivery_claims collection, which expires claims after a time.
+type WebhookDeliveryClaim struct {
+	// ID is the X-GitHub-Delivery header value which identifies the delivery
+	ID string `bson:"_id"`
+
+	// Status is one of the WebhookDeliveryClaim* constants
+	Status string `bson:"status"`
+
+	// ResponseStatus is the HTTP status code of the response, 0 while processing
+	ResponseStatus int `bson:"response_status"`
+
+	// ClaimedAt is the time the delivery was last claimed
+	ClaimedAt time.Time `bson:"claimed_at"`
+}
@@ -0,0 +1,7 @@
+/*
+Reliable delivery of requests to external services.
+
+Messages are stored in the outbox collection and delivered by Outbox.Run() with
+retries. Messages which can not be delivered are kept so they can be replayed.
+*/
+package outbox
@@ -0,0 +1,410 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/kscout/serverless-registry-api/config"
+	"github.com/kscout/serverless-registry-api/metrics"
+	"github.com/kscout/serverless-registry-api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Destinations to which messages can be sent
+const (
+	// DestinationBotAPI is the bot API
+	DestinationBotAPI = "bot_api"
+
+	// DestinationCloudEventsSink is the sink to which CloudEvents are sent
+	DestinationCloudEventsSink = "cloudevents_sink"
+)
+
+// ErrMessageNotFound is returned when a message does not exist
+var ErrMessageNotFound = fmt.Errorf("message not found")
+
+// ErrMessageNotReplayable is returned when a message which has not failed or been
+// discarded is replayed
+var ErrMessageNotReplayable = fmt.Errorf("only failed or discarded messages can " +
+	"be replayed")
+
+// replayableStatuses are the statuses of messages which can be replayed. Other
+// messages are delivered, or will be, without a replay.
+var replayableStatuses = []string{models.OutboxStatusFailed,
+	models.OutboxStatusDiscarded}
+
+// canReplay returns true if a message with status can be replayed
+func canReplay(status string) bool {
+	for _, replayable := range replayableStatuses {
+		if status == replayable {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewMessage creates a message which is ready to be delivered
+func NewMessage(destination, url string, headers map[string]string,
+	body []byte) models.OutboxMessage {
+
+	now := time.Now()
+
+	return models.OutboxMessage{
+		ID:            uuid.New().String(),
+		Destination:   destination,
+		URL:           url,
+		Headers:       headers,
+		Body:          string(body),
+		Status:        models.OutboxStatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+}
+
+// Outbox stores messages and delivers them with retries
+type Outbox struct {
+	// Ctx
+	Ctx context.Context
+
+	// Logger
+	Logger golog.Logger
+
+	// Cfg is the server configuration
+	Cfg *config.Config
+
+	// Metrics holds internal Prometheus metrics recorders
+	Metrics metrics.Metrics
+
+	// MDbOutbox is used to access the outbox collection
+	MDbOutbox *mongo.Collection
+}
+
+// Enqueue stores a message so it will be delivered
+func (o Outbox) Enqueue(ctx context.Context, msg models.OutboxMessage) error {
+	msg.Status = models.OutboxStatusPending
+
+	if _, err := o.MDbOutbox.InsertOne(ctx, msg); err != nil {
+		return fmt.Errorf("failed to insert message into outbox: %s", err.Error())
+	}
+
+	return nil
+}
+
+// Hold stores a message which will not be delivered until Release is called. Used
+// to record a message in the same step as the change it describes. If the change
+// fails call Discard.
+func (o Outbox) Hold(ctx context.Context, msg models.OutboxMessage) error {
+	msg.Status = models.OutboxStatusHeld
+
+	if _, err := o.MDbOutbox.InsertOne(ctx, msg); err != nil {
+		return fmt.Errorf("failed to insert held message into outbox: %s",
+			err.Error())
+	}
+
+	return nil
+}
+
+// Release allows held messages to be delivered
+func (o Outbox) Release(ctx context.Context, ids []string) error {
+	_, err := o.MDbOutbox.UpdateMany(ctx, bson.D{
+		{"_id", bson.D{{"$in", ids}}},
+		{"status", models.OutboxStatusHeld},
+	}, bson.D{{"$set", bson.D{
+		{"status", models.OutboxStatusPending},
+		{"next_attempt_at", time.Now()},
+	}}})
+	if err != nil {
+		return fmt.Errorf("failed to release held messages: %s", err.Error())
+	}
+
+	return nil
+}
+
+// Discard marks held messages as discarded, they are not delivered unless replayed
+func (o Outbox) Discard(ctx context.Context, ids []string) error {
+	_, err := o.MDbOutbox.UpdateMany(ctx, bson.D{
+		{"_id", bson.D{{"$in", ids}}},
+		{"status", models.OutboxStatusHeld},
+	}, bson.D{{"$set", bson.D{
+		{"status", models.OutboxStatusDiscarded},
+	}}})
+	if err != nil {
+		return fmt.Errorf("failed to discard held messages: %s", err.Error())
+	}
+
+	return nil
+}
+
+// List returns messages with a status, newest first
+func (o Outbox) List(ctx context.Context, status string) ([]models.OutboxMessage, error) {
+	cursor, err := o.MDbOutbox.Find(ctx, bson.D{{"status", status}},
+		options.Find().SetSort(bson.D{{"created_at", -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox: %s", err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	msgs := []models.OutboxMessage{}
+
+	for cursor.Next(ctx) {
+		var msg models.OutboxMessage
+		if err := cursor.Decode(&msg); err != nil {
+			return nil, fmt.Errorf("failed to decode outbox message: %s",
+				err.Error())
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over outbox messages: %s",
+			err.Error())
+	}
+
+	return msgs, nil
+}
+
+// Replay resets a message which failed or was discarded so it will be delivered
+// again. Returns ErrMessageNotFound if the message does not exist, and
+// ErrMessageNotReplayable if it has another status.
+func (o Outbox) Replay(ctx context.Context, id string) error {
+	// {{{1 Reset if replayable
+	res, err := o.MDbOutbox.UpdateOne(ctx, bson.D{
+		{"_id", id},
+		{"status", bson.D{{"$in", replayableStatuses}}},
+	}, bson.D{{"$set", bson.D{
+		{"status", models.OutboxStatusPending},
+		{"attempts", 0},
+		{"next_attempt_at", time.Now()},
+	}}})
+	if err != nil {
+		return fmt.Errorf("failed to reset message in outbox: %s", err.Error())
+	}
+
+	if res.MatchedCount > 0 {
+		return nil
+	}
+
+	// {{{1 Find why message was not reset
+	var msg models.OutboxMessage
+	err = o.MDbOutbox.FindOne(ctx, bson.D{{"_id", id}}).Decode(&msg)
+	if err == mongo.ErrNoDocuments {
+		return ErrMessageNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to get message from outbox: %s", err.Error())
+	}
+
+	if !canReplay(msg.Status) {
+		return ErrMessageNotReplayable
+	}
+
+	// Status changed between the update and the find
+	return fmt.Errorf("failed to reset message in outbox, its status changed")
+}
+
+// Run delivers messages until Outbox.Ctx is canceled. Should be run in a goroutine.
+func (o Outbox) Run() {
+	ticker := time.NewTicker(o.Cfg.OutboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-o.Ctx.Done():
+			return
+		case <-ticker.C:
+			if err := o.DeliverDue(); err != nil {
+				o.Logger.Errorf("failed to deliver outbox messages: %s", err.Error())
+			}
+		}
+	}
+}
+
+// DeliverDue delivers all pending messages whose next attempt time has passed
+func (o Outbox) DeliverDue() error {
+	return o.deliverDue(bson.D{})
+}
+
+// DeliverBatch delivers the pending messages in a batch whose next attempt time
+// has passed. Messages in other batches are left for Run.
+func (o Outbox) DeliverBatch(batch string) error {
+	return o.deliverDue(bson.D{{"batch", batch}})
+}
+
+// deliverDue delivers all pending messages which match filter and whose next
+// attempt time has passed
+func (o Outbox) deliverDue(filter bson.D) error {
+	for {
+		msg, err := o.claim(filter)
+		if err != nil {
+			return err
+		}
+
+		if msg == nil {
+			return nil
+		}
+
+		o.attempt(*msg)
+	}
+}
+
+// claim returns a message which matches filter and is due for delivery, nil if
+// none are due. The message's next attempt time is pushed back so it is not
+// claimed again while being delivered.
+func (o Outbox) claim(filter bson.D) (*models.OutboxMessage, error) {
+	now := time.Now()
+	lease := now.Add(2 * o.Cfg.OutboxDeliveryTimeout)
+
+	var msg models.OutboxMessage
+
+	err := o.MDbOutbox.FindOneAndUpdate(o.Ctx, append(bson.D{
+		{"status", models.OutboxStatusPending},
+		{"next_attempt_at", bson.D{{"$lte", now}}},
+	}, filter...), bson.D{{"$set", bson.D{{"next_attempt_at", lease}}}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{"next_attempt_at", 1}}).
+			SetReturnDocument(options.After)).Decode(&msg)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to claim message from outbox: %s",
+			err.Error())
+	}
+
+	return &msg, nil
+}
+
+// attempt delivers a message and records the result
+func (o Outbox) attempt(msg models.OutboxMessage) {
+	// {{{1 Deliver
+	deliverErr := o.deliver(msg)
+
+	successful := "1"
+	if deliverErr != nil {
+		successful = "0"
+	}
+
+	o.Metrics.OutboxDeliveriesTotal.With(prometheus.Labels{
+		"destination": msg.Destination,
+		"successful":  successful,
+	}).Inc()
+
+	// {{{1 Record result
+	msg.Attempts++
+	update := o.attemptUpdate(msg, deliverErr, time.Now())
+
+	_, err := o.MDbOutbox.UpdateOne(o.Ctx, bson.D{{"_id", msg.ID}},
+		bson.D{{"$set", update}})
+	if err != nil {
+		o.Logger.Errorf("failed to record delivery attempt for message %s: %s",
+			msg.ID, err.Error())
+	}
+}
+
+// attemptUpdate returns the fields to set on a message after a delivery attempt.
+// msg.Attempts must include the attempt. Delivered messages are marked delivered,
+// messages which failed are retried after a backoff until
+// Cfg.OutboxMaxAttempts is reached, then marked failed.
+func (o Outbox) attemptUpdate(msg models.OutboxMessage, deliverErr error,
+	now time.Time) bson.D {
+
+	update := bson.D{{"attempts", msg.Attempts}}
+
+	if deliverErr == nil {
+		return append(update, bson.E{"status", models.OutboxStatusDelivered},
+			bson.E{"delivered_at", now}, bson.E{"last_error", ""})
+	}
+
+	if msg.Attempts >= o.Cfg.OutboxMaxAttempts {
+		o.Logger.Errorf("giving up on delivering %s message %s after %d "+
+			"attempts: %s", msg.Destination, msg.ID, msg.Attempts,
+			deliverErr.Error())
+
+		return append(update, bson.E{"status", models.OutboxStatusFailed},
+			bson.E{"last_error", deliverErr.Error()})
+	}
+
+	o.Logger.Warnf("failed to deliver %s message %s, attempt %d: %s",
+		msg.Destination, msg.ID, msg.Attempts, deliverErr.Error())
+
+	return append(update,
+		bson.E{"next_attempt_at", now.Add(o.backoff(msg.Attempts))},
+		bson.E{"last_error", deliverErr.Error()})
+}
+
+// backoff returns how long to wait before the next delivery attempt. Doubles with
+// each attempt up to Cfg.OutboxRetryMaxDelay.
+func (o Outbox) backoff(attempts int) time.Duration {
+	delay := o.Cfg.OutboxRetryBaseDelay
+
+	for i := 1; i < attempts && delay < o.Cfg.OutboxRetryMaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > o.Cfg.OutboxRetryMaxDelay {
+		delay = o.Cfg.OutboxRetryMaxDelay
+	}
+
+	return delay
+}
+
+// destinationHeaders returns secret headers which must be sent to a destination
+func (o Outbox) destinationHeaders(destination string) map[string]string {
+	switch destination {
+	case DestinationBotAPI:
+		return map[string]string{
+			"X-Bot-API-Secret": o.Cfg.BotAPISecret,
+		}
+	default:
+		return map[string]string{}
+	}
+}
+
+// deliver makes a message's HTTP request
+func (o Outbox) deliver(msg models.OutboxMessage) error {
+	// {{{1 Build request
+	ctx, cancel := context.WithTimeout(o.Ctx, o.Cfg.OutboxDeliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest("POST", msg.URL, bytes.NewReader([]byte(msg.Body)))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %s", err.Error())
+	}
+
+	for key, value := range msg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	for key, value := range o.destinationHeaders(msg.Destination) {
+		req.Header.Set(key, value)
+	}
+
+	// {{{1 Make request
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to make request: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("got non-OK response, status: %s, but failed "+
+				"to read response body: %s", resp.Status, err.Error())
+		}
+
+		return fmt.Errorf("got non-OK response, status: %s, body: %s",
+			resp.Status, string(respBody))
+	}
+
+	return nil
+}
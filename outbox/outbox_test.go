@@ -0,0 +1,159 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kscout/serverless-registry-api/config"
+	"github.com/kscout/serverless-registry-api/models"
+
+	"github.com/Noah-Huppert/golog"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// newTestOutbox creates an outbox which does not need a database
+func newTestOutbox() Outbox {
+	return Outbox{
+		Ctx:    context.Background(),
+		Logger: golog.NewStdLogger("outbox-test"),
+		Cfg: &config.Config{
+			OutboxDeliveryTimeout: time.Second,
+			OutboxMaxAttempts:     3,
+			OutboxRetryBaseDelay:  10 * time.Second,
+			OutboxRetryMaxDelay:   time.Minute,
+			BotAPISecret:          "bot-secret",
+		},
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	o := newTestOutbox()
+
+	for _, test := range []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, time.Minute},
+		{50, time.Minute},
+	} {
+		assert.Equal(t, test.expected, o.backoff(test.attempts), "attempts=%d",
+			test.attempts)
+	}
+}
+
+func TestAttemptUpdate(t *testing.T) {
+	o := newTestOutbox()
+	now := time.Now()
+	deliverErr := errors.New("connection refused")
+
+	for _, test := range []struct {
+		name       string
+		attempts   int
+		deliverErr error
+		expected   bson.D
+	}{
+		{
+			name:     "delivered",
+			attempts: 1,
+			expected: bson.D{
+				{"attempts", 1},
+				{"status", models.OutboxStatusDelivered},
+				{"delivered_at", now},
+				{"last_error", ""},
+			},
+		},
+		{
+			name:       "retried",
+			attempts:   1,
+			deliverErr: deliverErr,
+			expected: bson.D{
+				{"attempts", 1},
+				{"next_attempt_at", now.Add(10 * time.Second)},
+				{"last_error", deliverErr.Error()},
+			},
+		},
+		{
+			name:       "retried with backoff",
+			attempts:   2,
+			deliverErr: deliverErr,
+			expected: bson.D{
+				{"attempts", 2},
+				{"next_attempt_at", now.Add(20 * time.Second)},
+				{"last_error", deliverErr.Error()},
+			},
+		},
+		{
+			name:       "failed after max attempts",
+			attempts:   3,
+			deliverErr: deliverErr,
+			expected: bson.D{
+				{"attempts", 3},
+				{"status", models.OutboxStatusFailed},
+				{"last_error", deliverErr.Error()},
+			},
+		},
+		{
+			name:     "delivered on last attempt",
+			attempts: 3,
+			expected: bson.D{
+				{"attempts", 3},
+				{"status", models.OutboxStatusDelivered},
+				{"delivered_at", now},
+				{"last_error", ""},
+			},
+		},
+	} {
+		msg := NewMessage(DestinationBotAPI, "http://bot", nil, []byte(`{}`))
+		msg.Attempts = test.attempts
+
+		assert.Equal(t, test.expected, o.attemptUpdate(msg, test.deliverErr, now),
+			test.name)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	o := newTestOutbox()
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "bot-secret", r.Header.Get("X-Bot-API-Secret"))
+
+		w.WriteHeader(status)
+		w.Write([]byte("response"))
+	}))
+	defer server.Close()
+
+	msg := NewMessage(DestinationBotAPI, server.URL, map[string]string{
+		"Content-Type": "application/json",
+	}, []byte(`{}`))
+
+	assert.NoError(t, o.deliver(msg))
+
+	status = http.StatusInternalServerError
+	err := o.deliver(msg)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "response")
+}
+
+func TestCanReplay(t *testing.T) {
+	for _, status := range []string{models.OutboxStatusFailed,
+		models.OutboxStatusDiscarded} {
+		assert.True(t, canReplay(status), status)
+	}
+
+	// Delivered messages would be sent twice, held messages before their change
+	// is committed, and pending messages are already being delivered
+	for _, status := range []string{models.OutboxStatusDelivered,
+		models.OutboxStatusHeld, models.OutboxStatusPending} {
+		assert.False(t, canReplay(status), status)
+	}
+}
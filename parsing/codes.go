@@ -0,0 +1,71 @@
+package parsing
+
+// Error codes identify types of ParseErrors caused by user input. Users can ask the
+// pull request bot to explain a code.
+const (
+	// ErrCodeInternal is the code of ParseErrors caused by the server
+	ErrCodeInternal = "KS000"
+
+	// ErrCodeNoFiles is the code of ParseErrors caused by an empty app directory
+	ErrCodeNoFiles = "KS001"
+
+	// ErrCodeContentNotAllowed is the code of ParseErrors caused by a file or
+	// directory which is not allowed in an app directory
+	ErrCodeContentNotAllowed = "KS002"
+
+	// ErrCodeManifestYAML is the code of ParseErrors caused by a manifest.yaml file
+	// which is not valid YAML
+	ErrCodeManifestYAML = "KS003"
+
+	// ErrCodeNamespaceResource is the code of ParseErrors caused by a Namespace
+	// deployment resource
+	ErrCodeNamespaceResource = "KS004"
+
+	// ErrCodeResourceNamespace is the code of ParseErrors caused by a deployment
+	// resource with a metadata.namespace field
+	ErrCodeResourceNamespace = "KS005"
+
+	// ErrCodeFieldRequired is the code of ParseErrors caused by a missing value
+	ErrCodeFieldRequired = "KS006"
+
+	// ErrCodeCategoryNotAllowed is the code of ParseErrors caused by a category
+	// which is not allowed
+	ErrCodeCategoryNotAllowed = "KS007"
+)
+
+// errCodeExplanations holds detailed markdown explanations of error codes. Keys are
+// error codes.
+var errCodeExplanations = map[string]string{
+	ErrCodeInternal: "Something went wrong on the KScout servers while " +
+		"parsing the app. This is not caused by your changes. The development " +
+		"team is notified of these errors and will fix them for you.",
+	ErrCodeNoFiles: "The app directory is empty. Each app directory must " +
+		"contain at least a `manifest.yaml` file, a `README.md` file, a " +
+		"`logo.png` file, and a `deployment` directory.",
+	ErrCodeContentNotAllowed: "Only the following files and directories are " +
+		"allowed in an app directory: `manifest.yaml`, `README.md`, " +
+		"`logo.png`, `deployment`, and `screenshots`. Remove anything else.",
+	ErrCodeManifestYAML: "The `manifest.yaml` file could not be parsed as " +
+		"YAML. Check the file for indentation mistakes, unclosed quotes, " +
+		"and tabs, which are not allowed in YAML.",
+	ErrCodeNamespaceResource: "Apps are deployed into a namespace chosen by " +
+		"the user, so the `deployment` directory may not contain resources " +
+		"of kind `Namespace`.",
+	ErrCodeResourceNamespace: "Apps are deployed into a namespace chosen by " +
+		"the user, so resources in the `deployment` directory may not set " +
+		"the `metadata.namespace` field.",
+	ErrCodeFieldRequired: "A required value was not provided. The `name`, " +
+		"`homepage_url`, `tagline`, `tags`, `categories`, and `author` " +
+		"fields must be set in `manifest.yaml`, and the `README.md` file, " +
+		"`logo.png` file, and `deployment` directory must exist.",
+	ErrCodeCategoryNotAllowed: "Apps may only use categories from a fixed " +
+		"list. See the [contributing documentation](https://github.com/" +
+		"kscout/serverless-apps#contributing) for allowed categories.",
+}
+
+// ExplainErrorCode returns a detailed markdown explanation of an error code. Returns
+// false if the code is not known.
+func ExplainErrorCode(code string) (string, bool) {
+	explanation, ok := errCodeExplanations[code]
+	return explanation, ok
+}
@@ -8,6 +8,10 @@ import (
 // be presented to users.
 // All string fields will be interpreted with Markdown formatting.
 type ParseError struct {
+	// Code identifies the type of error, see the ErrCode* constants. Should be set
+	// if the error is caused by user input.
+	Code string
+
 	// What indicates the object that failed to be parsed.
 	// This field does not have to provide context about what is being parsed. Just
 	// what part of the parsing process failed.
@@ -28,6 +32,16 @@ type ParseError struct {
 	InternalError error
 }
 
+// ErrorCode returns the error's code. Errors caused by the server always have the
+// ErrCodeInternal code.
+func (e ParseError) ErrorCode() string {
+	if e.InternalError != nil || len(e.Code) == 0 {
+		return ErrCodeInternal
+	}
+
+	return e.Code
+}
+
 // Error returns an internal error string which should not be shown to the user
 func (e ParseError) Error() string {
 	if e.InternalError != nil {
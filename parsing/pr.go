@@ -6,7 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 	
-	"github.com/google/go-github/v26/github"
+	"github.com/kscout/serverless-registry-api/scm"
 )
 
 // PRParser parses a pull request
@@ -14,14 +14,8 @@ type PRParser struct {
 	// Ctx is the server context
 	Ctx context.Context
 
-	// Gh is a GitHub API client
-	GH *github.Client
-
-	// RepoOwner is the owner of the PR's GitHub repository
-	RepoOwner string
-
-	// RepoName is the name of the PR's GitHub repository
-	RepoName string
+	// SCM accesses the registry repository
+	SCM scm.Provider
 
 	// RepoRef is the Git reference to parse data at
 	RepoRef string
@@ -34,44 +28,14 @@ type PRParser struct {
 // deleted in pull request.
 func (p PRParser) GetModifiedAppIDs() ([]string, []string, error) {
 	// {{{1 Get files in PR
-	prFiles, _, err := p.GH.PullRequests.ListFiles(p.Ctx, p.RepoOwner, p.RepoName, 
-		p.PRNumber, &github.ListOptions{
-			Page: 1,
-			PerPage: 300, // 300 is the max number ever returned by this endpoint
-		})
+	prFiles, err := p.SCM.ListMergeRequestFiles(p.Ctx, p.PRNumber)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error listing PR files: %s", err.Error())
 	}
 	
 	// {{{1 Parse file paths
 	// modifiedApps is a map set which holds the names of modified apps as keys
-	modifiedApps := map[string]interface{}{}
-	
-	for _, prFile := range prFiles {
-		// {{{3 Get old and new filepath of commit file
-		// This accounts for a file being moved from one app directory to another
-		dirs := []string{}
-		
-		curDir, _ := filepath.Split(*prFile.Filename)
-		dirs = append(dirs, curDir)
-
-		if prFile.PreviousFilename != nil {
-			oldDir, _ := filepath.Split(*prFile.PreviousFilename)
-			dirs = append(dirs, oldDir)
-		}
-
-		// {{{3 Parse for app directories
-		for _, dir := range dirs {
-			// If file in base dir
-			if len(dir) == 0 {
-				continue
-			}
-
-			parts := strings.Split(dir, "/")
-			
-			modifiedApps[parts[0]] = true
-		}
-	}
+	modifiedApps := commitFilesAppIDs(prFiles)
 
 	// {{{1 Determine if any modified apps in PR are those apps being deleted
 	// At this point modifiedApps would have a deleted app's ID in it b/c the
@@ -82,9 +46,7 @@ func (p PRParser) GetModifiedAppIDs() ([]string, []string, error) {
 	// were deleted.
 	repoParser := RepoParser{
 		Ctx: p.Ctx,
-		GH: p.GH,
-		RepoOwner: p.RepoOwner,
-		RepoName: p.RepoName,
+		SCM: p.SCM,
 		RepoRef: p.RepoRef,
 	}
 	
@@ -117,3 +79,39 @@ func (p PRParser) GetModifiedAppIDs() ([]string, []string, error) {
 
 	return appIDs, deletedAppIDs, nil
 }
+
+// commitFilesAppIDs returns a map set of the IDs of apps whose directories contain
+// the files. A file's previous location is included, this accounts for a file being
+// moved from one app directory to another.
+func commitFilesAppIDs(files []scm.ChangedFile) map[string]bool {
+	paths := []string{}
+
+	for _, file := range files {
+		paths = append(paths, file.Filename)
+
+		if len(file.PreviousFilename) > 0 {
+			paths = append(paths, file.PreviousFilename)
+		}
+	}
+
+	return pathsAppIDs(paths)
+}
+
+// pathsAppIDs returns a map set of the IDs of apps whose directories contain the
+// file paths
+func pathsAppIDs(paths []string) map[string]bool {
+	appIDs := map[string]bool{}
+
+	for _, path := range paths {
+		dir, _ := filepath.Split(path)
+
+		// If file in base dir
+		if len(dir) == 0 {
+			continue
+		}
+
+		appIDs[strings.Split(dir, "/")[0]] = true
+	}
+
+	return appIDs
+}
@@ -0,0 +1,28 @@
+package parsing
+
+import (
+	"sort"
+
+	"github.com/google/go-github/v26/github"
+)
+
+// PushAppIDs returns the IDs of apps whose directories were touched by the commits
+// in a push event. GitHub only includes some commits in push events, so returns
+// false if the event does not include every commit.
+func PushAppIDs(event github.PushEvent) ([]string, bool) {
+	paths := []string{}
+
+	for _, commit := range event.Commits {
+		paths = append(paths, commit.Added...)
+		paths = append(paths, commit.Removed...)
+		paths = append(paths, commit.Modified...)
+	}
+
+	ids := []string{}
+	for id := range pathsAppIDs(paths) {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids, event.GetSize() <= len(event.Commits)
+}
@@ -0,0 +1,43 @@
+package parsing
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v26/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushAppIDs(t *testing.T) {
+	size := 2
+	ids, complete := PushAppIDs(github.PushEvent{
+		Size: &size,
+		Commits: []github.PushEventCommit{
+			github.PushEventCommit{
+				Added:    []string{"hello-world/manifest.yaml"},
+				Modified: []string{"README.md"},
+			},
+			github.PushEventCommit{
+				Removed:  []string{"old-app/deployment/svc.yaml"},
+				Modified: []string{"hello-world/README.md"},
+			},
+		},
+	})
+
+	assert.Equal(t, []string{"hello-world", "old-app"}, ids)
+	assert.True(t, complete)
+}
+
+func TestPushAppIDsIncomplete(t *testing.T) {
+	size := 25
+	ids, complete := PushAppIDs(github.PushEvent{
+		Size: &size,
+		Commits: []github.PushEventCommit{
+			github.PushEventCommit{
+				Modified: []string{"README.md"},
+			},
+		},
+	})
+
+	assert.Empty(t, ids)
+	assert.False(t, complete)
+}
@@ -12,23 +12,23 @@ import (
 	"strings"
 
 	"github.com/kscout/serverless-registry-api/models"
+	"github.com/kscout/serverless-registry-api/scm"
 	"github.com/kscout/serverless-registry-api/validation"
 
 	"github.com/ghodss/yaml"
-	"github.com/google/go-github/v26/github"
 	"github.com/google/uuid"
 	"gopkg.in/go-playground/validator.v9"
 	v1Core "k8s.io/api/core/v1"
 	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// RepoParser reads GitHub repositories for serverless application information
+// RepoParser reads the registry repository for serverless application information
 type RepoParser struct {
 	// Ctx is the server's context
 	Ctx context.Context
 
-	// GH is a GitHub API client
-	GH *github.Client
+	// SCM accesses the registry repository
+	SCM scm.Provider
 
 	// GHDevTeamName is the name of the GitHub team to ping when an internal error occurs
 	GHDevTeamName string
@@ -36,61 +36,87 @@ type RepoParser struct {
 	// SiteURL is the URL at which the website can be accessed
 	SiteURL url.URL
 
-	// RepoOwner is the owner of the repository
-	RepoOwner string
-
-	// RepoName is the name of the repository
-	RepoName string
-
 	// RepoRef is the Git reference to parse data at
 	RepoRef string
+
+	// GitHubURLRef is the Git reference used in the App.GitHubURL field. Defaults
+	// to RepoRef. Set this when RepoRef is a commit SHA so links point to a branch.
+	GitHubURLRef string
 }
 
 // GetAppIDs returns the IDs of all the serverless applications in a repository
 func (p RepoParser) GetAppIDs() ([]string, error) {
-	_, contents, _, err := p.GH.Repositories.GetContents(p.Ctx, p.RepoOwner, p.RepoName,
-		"", &github.RepositoryContentGetOptions{
-			Ref: p.RepoRef,
-		})
+	contents, err := p.SCM.ListDir(p.Ctx, p.RepoRef, "")
 	if err != nil {
-		return nil, fmt.Errorf("error listing top level repository contents via "+
-			"GitHub API: %s", err.Error())
+		return nil, fmt.Errorf("error listing top level repository contents: %s",
+			err.Error())
 	}
 
 	ids := []string{}
 
 	for _, content := range contents {
-		if *content.Type == "file" {
+		if content.Type != scm.EntryTypeDir {
 			continue
 		}
 
-		ids = append(ids, *content.Name)
+		ids = append(ids, content.Name)
 	}
 
 	return ids, nil
 }
 
+// GetRefSHA returns the SHA of the commit RepoRef points to
+func (p RepoParser) GetRefSHA() (string, error) {
+	sha, err := p.SCM.GetRefSHA(p.Ctx, p.RepoRef)
+	if err != nil {
+		return "", fmt.Errorf("error getting commit SHA: %s", err.Error())
+	}
+
+	return sha, nil
+}
+
+// GetChangedAppIDs returns the IDs of apps whose directories were modified between
+// the baseSHA commit and RepoRef. This includes apps which were deleted.
+//
+// The second return value is false if the changes could not be determined by
+// comparing the commits. This happens if baseSHA is not an ancestor of RepoRef,
+// ex., after a force push, or if too many files were changed. In this case all
+// apps should be treated as changed.
+func (p RepoParser) GetChangedAppIDs(baseSHA string) ([]string, bool, error) {
+	files, ok, err := p.SCM.CompareCommits(p.Ctx, baseSHA, p.RepoRef)
+	if err != nil {
+		return nil, false, fmt.Errorf("error comparing commits: %s", err.Error())
+	}
+
+	if !ok {
+		return nil, false, nil
+	}
+
+	ids := []string{}
+	for id, _ := range commitFilesAppIDs(files) {
+		ids = append(ids, id)
+	}
+
+	return ids, true, nil
+}
+
 // GetDownloadURLs returns the download URLs for files in a directory
 func (p RepoParser) GetDownloadURLs(path string) ([]string, error) {
 	// {{{1 Make API call
-	_, contents, _, err := p.GH.Repositories.GetContents(p.Ctx, p.RepoOwner, p.RepoName,
-		path, &github.RepositoryContentGetOptions{
-			Ref: p.RepoRef,
-		})
+	contents, err := p.SCM.ListDir(p.Ctx, p.RepoRef, path)
 	if err != nil {
-		return nil, fmt.Errorf("error listing directory contents with GitHub API: %s",
-			err.Error())
+		return nil, fmt.Errorf("error listing directory contents: %s", err.Error())
 	}
 
 	// {{{1 Accumulate list of files
 	urls := []string{}
 
 	for _, content := range contents {
-		if *content.Type == "dir" {
+		if content.Type != scm.EntryTypeFile {
 			continue
 		}
 
-		urls = append(urls, *content.DownloadURL)
+		urls = append(urls, content.DownloadURL)
 	}
 
 	return urls, nil
@@ -98,17 +124,9 @@ func (p RepoParser) GetDownloadURLs(path string) ([]string, error) {
 
 // GetFileContent retrieves the contents of a file
 func (p RepoParser) GetFileContent(f string) (string, error) {
-	content, _, _, err := p.GH.Repositories.GetContents(p.Ctx, p.RepoOwner,
-		p.RepoName, f, &github.RepositoryContentGetOptions{
-			Ref: p.RepoRef,
-		})
+	txt, err := p.SCM.GetFile(p.Ctx, p.RepoRef, f)
 	if err != nil {
-		return "", fmt.Errorf("failed to get content from GitHub API: %s", err.Error())
-	}
-
-	txt, err := content.GetContent()
-	if err != nil {
-		return "", fmt.Errorf("failed to decode content: %s", err.Error())
+		return "", fmt.Errorf("failed to get content: %s", err.Error())
 	}
 
 	return txt, nil
@@ -117,20 +135,18 @@ func (p RepoParser) GetFileContent(f string) (string, error) {
 // GetApp marshals an app from the repository
 func (p RepoParser) GetApp(id string) (*models.App, []ParseError) {
 	// {{{1 Get contents of app directory
-	_, dirContents, _, err := p.GH.Repositories.GetContents(p.Ctx, p.RepoOwner,
-		p.RepoName, id, &github.RepositoryContentGetOptions{
-			Ref: p.RepoRef,
-		})
+	dirContents, err := p.SCM.ListDir(p.Ctx, p.RepoRef, id)
 	if err != nil {
 		return nil, []ParseError{ParseError{
 			What:          "all files in the app directory",
-			Why:           "the GitHub API returned an error response",
+			Why:           "the repository API returned an error response",
 			InternalError: err,
 		}}
 	}
 
 	if len(dirContents) == 0 {
 		return nil, []ParseError{ParseError{
+			Code:            ErrCodeNoFiles,
 			What:            "all files in the app directory",
 			Why:             "no files were found",
 			FixInstructions: "add required files",
@@ -142,18 +158,19 @@ func (p RepoParser) GetApp(id string) (*models.App, []ParseError) {
 	app := models.App{}
 
 	app.AppID = id
-	app.VerificationStatus = "pending"
+	app.VerificationStatus = models.VerificationStatusPending
 
 	siteURL := p.SiteURL
 	siteURL.Path = fmt.Sprintf("/apps/%s", id)
 	app.SiteURL = siteURL.String()
 
 	ghURLRef := "master"
-	if len(p.RepoRef) > 0 {
+	if len(p.GitHubURLRef) > 0 {
+		ghURLRef = p.GitHubURLRef
+	} else if len(p.RepoRef) > 0 {
 		ghURLRef = p.RepoRef
 	}
-	app.GitHubURL = fmt.Sprintf("https://github.com/%s/%s/tree/%s/%s",
-		p.RepoOwner, p.RepoName, ghURLRef, id)
+	app.GitHubURL = p.SCM.TreeURL(ghURLRef, id)
 
 	// allowedContent is a map set of the allowed names of content in an app directory
 	allowedContent := map[string]bool{
@@ -169,16 +186,17 @@ func (p RepoParser) GetApp(id string) (*models.App, []ParseError) {
 		// Needed because when content is a directory content.Type = "dir" which is not
 		// a full word. Looks bad when presented to users.
 		fullType := "file"
-		if *content.Type == "dir" {
+		if content.Type == scm.EntryTypeDir {
 			fullType = "directory"
 		}
 
 		// what will be used as the ParseError.What field value if necessary
-		what := fmt.Sprintf("`%s` %s", *content.Name, fullType)
+		what := fmt.Sprintf("`%s` %s", content.Name, fullType)
 
 		// {{{2 Check if file / directory is supposed to be there
-		if _, ok := allowedContent[*content.Name]; !ok {
+		if _, ok := allowedContent[content.Name]; !ok {
 			errs = append(errs, ParseError{
+				Code:            ErrCodeContentNotAllowed,
 				What:            what,
 				Why:             fmt.Sprintf("not allowed in an app directory"),
 				FixInstructions: fmt.Sprintf("delete this %s", fullType),
@@ -187,17 +205,17 @@ func (p RepoParser) GetApp(id string) (*models.App, []ParseError) {
 		}
 
 		// {{{2 Parse file / directory for app info
-		switch *content.Type {
-		case "file":
-			switch *content.Name {
+		switch content.Type {
+		case scm.EntryTypeFile:
+			switch content.Name {
 			case "manifest.yaml":
 				// {{{2 Get manifest.yaml file content
 				txt, err := p.GetFileContent(fmt.Sprintf("%s/%s", id,
-					*content.Name))
+					content.Name))
 				if err != nil {
 					errs = append(errs, ParseError{
 						What:          what,
-						Why:           "failed to get contents from the GitHub API",
+						Why:           "failed to get contents from the repository API",
 						InternalError: err,
 					})
 					continue
@@ -208,6 +226,7 @@ func (p RepoParser) GetApp(id string) (*models.App, []ParseError) {
 				err = yaml.Unmarshal([]byte(txt), &manifest)
 				if err != nil {
 					errs = append(errs, ParseError{
+						Code: ErrCodeManifestYAML,
 						What: what,
 						Why: fmt.Sprintf("failed to parse file as "+
 							"YAML: %s", err.Error()),
@@ -234,11 +253,11 @@ func (p RepoParser) GetApp(id string) (*models.App, []ParseError) {
 			case "README.md":
 				// {{{2 Get content
 				txt, err := p.GetFileContent(fmt.Sprintf("%s/%s", id,
-					*content.Name))
+					content.Name))
 				if err != nil {
 					errs = append(errs, ParseError{
 						What: what,
-						Why: "failed to get file content, the GitHub " +
+						Why: "failed to get file content, the repository " +
 							"API returned any error response",
 						InternalError: err,
 					})
@@ -247,10 +266,10 @@ func (p RepoParser) GetApp(id string) (*models.App, []ParseError) {
 
 				app.Description = txt
 			case "logo.png":
-				app.LogoURL = *content.DownloadURL
+				app.LogoURL = content.DownloadURL
 			}
-		case "dir":
-			switch *content.Name {
+		case scm.EntryTypeDir:
+			switch content.Name {
 			case "screenshots":
 				// {{{2 Get files in screenshots directory
 				urls, err := p.GetDownloadURLs(fmt.Sprintf("%s/screenshots", id))
@@ -258,7 +277,7 @@ func (p RepoParser) GetApp(id string) (*models.App, []ParseError) {
 					errs = append(errs, ParseError{
 						What: what,
 						Why: "failed to list files in the directory " +
-							"using the GitHub API, an error " +
+							"using the repository API, an error " +
 							"response was returned",
 						InternalError: err,
 					})
@@ -270,16 +289,13 @@ func (p RepoParser) GetApp(id string) (*models.App, []ParseError) {
 			case "deployment":
 				// {{{2 Get YAML for each resource
 				// {{{3 Get files in directory
-				_, dirContents, _, err := p.GH.Repositories.GetContents(p.Ctx, p.RepoOwner,
-					p.RepoName, fmt.Sprintf("%s/deployment", id),
-					&github.RepositoryContentGetOptions{
-						Ref: p.RepoRef,
-					})
+				dirContents, err := p.SCM.ListDir(p.Ctx, p.RepoRef,
+					fmt.Sprintf("%s/deployment", id))
 				if err != nil {
 					errs = append(errs, ParseError{
 						What: what,
 						Why: "failed to list files in the directory " +
-							"using the GitHub API, an error " +
+							"using the repository API, an error " +
 							"response was returned",
 						InternalError: err,
 					})
@@ -289,19 +305,19 @@ func (p RepoParser) GetApp(id string) (*models.App, []ParseError) {
 				// {{{3 Get content of each file
 				filesTxt := []string{}
 				for _, deployContent := range dirContents {
-					if *deployContent.Type == "dir" {
+					if deployContent.Type != scm.EntryTypeFile {
 						continue
 					}
 
 					txt, err := p.GetFileContent(
 						fmt.Sprintf("%s/deployment/%s",
-							id, *deployContent.Name))
+							id, deployContent.Name))
 					if err != nil {
 						errs = append(errs, ParseError{
 							What: fmt.Sprintf("`%s/deployment/%s`"+
-								"file", id, *deployContent.Name),
+								"file", id, deployContent.Name),
 							Why: "failed to get content of file " +
-								"using the GitHub API, an error " +
+								"using the repository API, an error " +
 								"response was returned",
 							InternalError: err,
 						})
@@ -368,6 +384,7 @@ func (p RepoParser) GetApp(id string) (*models.App, []ParseError) {
 					// {{{3 Do not allow namespace resources in the deployment
 					if resourceType.Kind == "Namespace" {
 						errs = append(errs, ParseError{
+							Code:            ErrCodeNamespaceResource,
 							What:            what,
 							Why:             "resources of type Namespace are not allowed",
 							FixInstructions: "remove all Namespace resources",
@@ -391,6 +408,7 @@ func (p RepoParser) GetApp(id string) (*models.App, []ParseError) {
 					// {{{3 Do not allow resources with a namespace field
 					if len(resourceMeta.Namespace) > 0 {
 						errs = append(errs, ParseError{
+							Code:            ErrCodeResourceNamespace,
 							What:            what,
 							Why:             "resources may not have a metadata.namespace field",
 							FixInstructions: "ensure resources do not have a metadata.namespace field",
@@ -564,9 +582,9 @@ func (p RepoParser) GetApp(id string) (*models.App, []ParseError) {
 			}
 
 			// whyMap maps validation tags to user readable reasons for the validation
-			// failing. Keys are tag names, values are arrays which always have 2
+			// failing. Keys are tag names, values are arrays which always have 3
 			// items. The first item will be the reason why, the second item will
-			// be the fix instructions.
+			// be the fix instructions, the third item is the error code.
 			// If a tag isn't in the map it means the validation should never fail
 			// in this method. It failing means an internal error occured, unrelated
 			// to the user's input.
@@ -574,10 +592,12 @@ func (p RepoParser) GetApp(id string) (*models.App, []ParseError) {
 				"required": []string{
 					"a value must be provided",
 					"set a value",
+					ErrCodeFieldRequired,
 				},
 				"categories": []string{
 					"only certain categories are allowed",
 					"see [contributing documentation](https://github.com/kscout/serverless-apps#contributing) for a list of allowed category values",
+					ErrCodeCategoryNotAllowed,
 				},
 			}
 
@@ -587,6 +607,7 @@ func (p RepoParser) GetApp(id string) (*models.App, []ParseError) {
 					// If validation error is caused by user's input
 					if why, ok := whyMap[fieldErr.Tag()]; ok {
 						errs = append(errs, ParseError{
+							Code:            why[2],
 							What:            what,
 							Why:             why[0],
 							FixInstructions: why[1],
@@ -0,0 +1,12 @@
+/*
+Access the registry repository on any supported source code hosting provider.
+
+A Provider reads repository contents, merge requests and the files they change,
+reports commit checks, comments on merge requests, and verifies and parses
+webhook requests. GitHub, GitLab and Gitea are supported. The provider is
+selected by the RegistryProvider configuration field.
+
+GitHub pull requests and GitLab merge requests are both called merge requests.
+GitHub check runs are reported as commit statuses on GitLab and Gitea.
+*/
+package scm
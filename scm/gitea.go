@@ -0,0 +1,416 @@
+package scm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kscout/serverless-registry-api/config"
+)
+
+// giteaPageSize is the number of items requested per page from the Gitea API
+const giteaPageSize = 50
+
+// Gitea is a Provider for a registry repository hosted by a Gitea server.
+// Create with NewGitea.
+type Gitea struct {
+	// Cfg is the server configuration
+	Cfg *config.Config
+
+	// rest makes Gitea API requests
+	rest restClient
+
+	// webURL is the URL of the Gitea server
+	webURL string
+}
+
+// giteaChangedFile is a changed file returned by the Gitea API
+type giteaChangedFile struct {
+	// Filename is the path of the file
+	Filename string `json:"filename"`
+
+	// PreviousFilename is the path of the file before it was moved
+	PreviousFilename string `json:"previous_filename"`
+}
+
+// NewGitea creates a Gitea provider which authenticates with RegistryProviderToken
+func NewGitea(cfg *config.Config) Gitea {
+	webURL := strings.TrimSuffix(cfg.RegistryProviderURL.String(), "/")
+
+	return Gitea{
+		Cfg: cfg,
+		rest: restClient{
+			baseURL: webURL + "/api/v1",
+			header: http.Header{
+				"Authorization": {"token " + cfg.RegistryProviderToken},
+			},
+			client: http.DefaultClient,
+		},
+		webURL: webURL,
+	}
+}
+
+// repoPath returns an API path within the registry repository
+func (p Gitea) repoPath(format string, args ...interface{}) string {
+	return fmt.Sprintf("/repos/%s/%s", url.PathEscape(p.Cfg.GhRegistryRepoOwner),
+		url.PathEscape(p.Cfg.GhRegistryRepoName)) + fmt.Sprintf(format, args...)
+}
+
+// Name implements Provider
+func (p Gitea) Name() string {
+	return ProviderGitea
+}
+
+// GetRefSHA implements Provider. The ref must be a branch.
+func (p Gitea) GetRefSHA(ctx context.Context, ref string) (string, error) {
+	var branch struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+
+	_, err := p.rest.requestJSON(ctx, http.MethodGet,
+		p.repoPath("/branches/%s", url.PathEscape(ref)), nil, nil, &branch)
+	if err != nil {
+		return "", fmt.Errorf("failed to get branch via Gitea API: %s", err.Error())
+	}
+
+	return branch.Commit.ID, nil
+}
+
+// ListDir implements Provider
+func (p Gitea) ListDir(ctx context.Context, ref, path string) ([]Entry, error) {
+	contentsPath := p.repoPath("/contents")
+	if len(path) > 0 {
+		contentsPath += "/" + escapePath(path)
+	}
+
+	var contents []struct {
+		Name        string `json:"name"`
+		Path        string `json:"path"`
+		Type        string `json:"type"`
+		DownloadURL string `json:"download_url"`
+	}
+
+	_, err := p.rest.requestJSON(ctx, http.MethodGet, contentsPath,
+		url.Values{"ref": {ref}}, nil, &contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directory contents via Gitea API: %s",
+			err.Error())
+	}
+
+	entries := []Entry{}
+	for _, content := range contents {
+		entries = append(entries, Entry{
+			Name:        content.Name,
+			Path:        content.Path,
+			Type:        content.Type,
+			DownloadURL: content.DownloadURL,
+		})
+	}
+
+	return entries, nil
+}
+
+// GetFile implements Provider
+func (p Gitea) GetFile(ctx context.Context, ref, path string) (string, error) {
+	_, body, err := p.rest.request(ctx, http.MethodGet,
+		p.repoPath("/raw/%s", escapePath(path)), url.Values{"ref": {ref}}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get file via Gitea API: %s", err.Error())
+	}
+
+	return string(body), nil
+}
+
+// CompareCommits implements Provider. The Gitea API can not list the files changed
+// between commits, so the changes are never determined.
+func (p Gitea) CompareCommits(ctx context.Context, base,
+	head string) ([]ChangedFile, bool, error) {
+
+	return nil, false, nil
+}
+
+// GetMergeRequest implements Provider
+func (p Gitea) GetMergeRequest(ctx context.Context, number int) (*MergeRequest, error) {
+	// Gitea pull requests have the same shape as GitHub pull requests
+	var mr MergeRequest
+
+	_, err := p.rest.requestJSON(ctx, http.MethodGet, p.repoPath("/pulls/%d", number),
+		nil, nil, &mr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pull request via Gitea API: %s",
+			err.Error())
+	}
+
+	return &mr, nil
+}
+
+// ListMergeRequestFiles implements Provider
+func (p Gitea) ListMergeRequestFiles(ctx context.Context,
+	number int) ([]ChangedFile, error) {
+
+	files := []ChangedFile{}
+
+	for page := 1; ; page++ {
+		var pageFiles []giteaChangedFile
+
+		_, err := p.rest.requestJSON(ctx, http.MethodGet,
+			p.repoPath("/pulls/%d/files", number), url.Values{
+				"page":  {strconv.Itoa(page)},
+				"limit": {strconv.Itoa(giteaPageSize)},
+			}, nil, &pageFiles)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pull request files via "+
+				"Gitea API: %s", err.Error())
+		}
+
+		for _, file := range pageFiles {
+			files = append(files, ChangedFile{
+				Filename:         file.Filename,
+				PreviousFilename: file.PreviousFilename,
+			})
+		}
+
+		if len(pageFiles) < giteaPageSize {
+			break
+		}
+	}
+
+	return files, nil
+}
+
+// setStatus creates a commit status which represents a check
+func (p Gitea) setStatus(ctx context.Context, check Check) (string, error) {
+	state := "pending"
+	if check.Status == CheckStatusCompleted {
+		switch check.Conclusion {
+		case CheckConclusionSuccess:
+			state = "success"
+		case CheckConclusionCancelled:
+			state = "error"
+		default:
+			state = "failure"
+		}
+	}
+
+	var status struct {
+		ID int64 `json:"id"`
+	}
+
+	_, err := p.rest.requestJSON(ctx, http.MethodPost,
+		p.repoPath("/statuses/%s", url.PathEscape(check.HeadSHA)), nil,
+		map[string]string{
+			"state":       state,
+			"context":     check.Name,
+			"description": check.Title,
+		}, &status)
+	if err != nil {
+		return "", fmt.Errorf("failed to create commit status via Gitea API: %s",
+			err.Error())
+	}
+
+	return strconv.FormatInt(status.ID, 10), nil
+}
+
+// CreateCheck implements Provider
+func (p Gitea) CreateCheck(ctx context.Context, check Check) (string, error) {
+	return p.setStatus(ctx, check)
+}
+
+// UpdateCheck implements Provider. The newest commit status with a context is
+// shown, so a new status is created.
+func (p Gitea) UpdateCheck(ctx context.Context, check Check) error {
+	_, err := p.setStatus(ctx, check)
+	return err
+}
+
+// ListComments implements Provider
+func (p Gitea) ListComments(ctx context.Context, number int) ([]Comment, error) {
+	// {{{1 Get user the provider authenticates as
+	var self struct {
+		Login string `json:"login"`
+	}
+
+	_, err := p.rest.requestJSON(ctx, http.MethodGet, "/user", nil, nil, &self)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get authenticated user via Gitea API: %s",
+			err.Error())
+	}
+
+	// {{{1 List comments
+	var issueComments []struct {
+		ID   int64  `json:"id"`
+		Body string `json:"body"`
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	}
+
+	_, err = p.rest.requestJSON(ctx, http.MethodGet,
+		p.repoPath("/issues/%d/comments", number), nil, nil, &issueComments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list comments via Gitea API: %s",
+			err.Error())
+	}
+
+	comments := []Comment{}
+	for _, comment := range issueComments {
+		comments = append(comments, Comment{
+			ID:    comment.ID,
+			Body:  comment.Body,
+			ByBot: comment.User.Login == self.Login,
+		})
+	}
+
+	return comments, nil
+}
+
+// CreateComment implements Provider
+func (p Gitea) CreateComment(ctx context.Context, number int, body string) error {
+	_, err := p.rest.requestJSON(ctx, http.MethodPost,
+		p.repoPath("/issues/%d/comments", number), nil,
+		map[string]string{"body": body}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create comment via Gitea API: %s", err.Error())
+	}
+
+	return nil
+}
+
+// EditComment implements Provider
+func (p Gitea) EditComment(ctx context.Context, number int, id int64,
+	body string) error {
+
+	_, err := p.rest.requestJSON(ctx, http.MethodPatch,
+		p.repoPath("/issues/comments/%d", id), nil,
+		map[string]string{"body": body}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to edit comment via Gitea API: %s", err.Error())
+	}
+
+	return nil
+}
+
+// TreeURL implements Provider. The ref must be a branch.
+func (p Gitea) TreeURL(ref, path string) string {
+	return fmt.Sprintf("%s/%s/%s/src/branch/%s/%s", p.webURL,
+		p.Cfg.GhRegistryRepoOwner, p.Cfg.GhRegistryRepoName, ref, path)
+}
+
+// VerifyWebhook implements Provider. Gitea signs the body with HMAC SHA-256 in the
+// X-Gitea-Signature header.
+func (p Gitea) VerifyWebhook(r *http.Request, body []byte) error {
+	sigHeader, ok := r.Header["X-Gitea-Signature"]
+	if !ok || len(sigHeader) != 1 {
+		return HeaderMissingError{"X-Gitea-Signature"}
+	}
+
+	verified := anySecretMatches([]string{p.Cfg.RegistryWebhookSecret}, sigHeader[0],
+		func(secret []byte) string {
+			return ComputeGiteaWebhookSignature(secret, body)
+		})
+	if !verified {
+		return ErrWebhookUnverified
+	}
+
+	return nil
+}
+
+// WebhookEventType implements Provider
+func (p Gitea) WebhookEventType(r *http.Request) (string, error) {
+	eventType := r.Header.Get("X-Gitea-Event")
+	if len(eventType) == 0 {
+		return "", HeaderMissingError{"X-Gitea-Event"}
+	}
+
+	return eventType, nil
+}
+
+// WebhookDeliveryID implements Provider
+func (p Gitea) WebhookDeliveryID(r *http.Request) string {
+	return r.Header.Get("X-Gitea-Delivery")
+}
+
+// ParseWebhook implements Provider
+func (p Gitea) ParseWebhook(eventType string, body []byte) (*WebhookEvent, error) {
+	var repository struct {
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	if err := decodeWebhook(body, &repository); err != nil {
+		return nil, err
+	}
+
+	switch eventType {
+	case "pull_request":
+		var event struct {
+			Action      string       `json:"action"`
+			PullRequest MergeRequest `json:"pull_request"`
+			Changes     struct {
+				Base *json.RawMessage `json:"base"`
+			} `json:"changes"`
+		}
+		if err := decodeWebhook(body, &event); err != nil {
+			return nil, err
+		}
+
+		action := ""
+		switch event.Action {
+		case "opened", "reopened":
+			action = MergeRequestActionOpened
+		case "synchronized":
+			action = MergeRequestActionUpdated
+		case "edited":
+			// Title and body changes do not affect validation
+			if event.Changes.Base != nil {
+				action = MergeRequestActionUpdated
+			}
+		case "closed":
+			action = MergeRequestActionClosed
+		}
+
+		return &WebhookEvent{
+			Kind:         WebhookEventMergeRequest,
+			Action:       action,
+			Repository:   repository.Repository.FullName,
+			MergeRequest: &event.PullRequest,
+		}, nil
+	case "push":
+		var event struct {
+			Ref   string `json:"ref"`
+			After string `json:"after"`
+		}
+		if err := decodeWebhook(body, &event); err != nil {
+			return nil, err
+		}
+
+		return &WebhookEvent{
+			Kind:       WebhookEventPush,
+			Repository: repository.Repository.FullName,
+			Ref:        event.Ref,
+			Deleted:    event.After == nullSHA,
+		}, nil
+	default:
+		return &WebhookEvent{
+			Kind:       WebhookEventOther,
+			Repository: repository.Repository.FullName,
+		}, nil
+	}
+}
+
+// WebhookHeaders implements Provider
+func (p Gitea) WebhookHeaders(eventType, deliveryID string, body []byte) http.Header {
+	return http.Header{
+		"X-Gitea-Signature": {ComputeGiteaWebhookSignature(
+			[]byte(p.Cfg.RegistryWebhookSecret), body)},
+		"X-Gitea-Event":    {eventType},
+		"X-Gitea-Delivery": {deliveryID},
+		"Content-Type":     {"application/json"},
+	}
+}
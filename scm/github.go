@@ -0,0 +1,432 @@
+package scm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kscout/serverless-registry-api/config"
+
+	"github.com/google/go-github/v26/github"
+)
+
+// githubCompareMaxFiles is the maximum number of files the GitHub compare API lists
+const githubCompareMaxFiles = 300
+
+// GitHub is a Provider for a GitHub registry repository
+type GitHub struct {
+	// Cfg is the server configuration
+	Cfg *config.Config
+
+	// GH is a GitHub API client which can access the registry repository
+	GH *github.Client
+
+	// Owner of the registry repository. If empty config.Config.GhRegistryRepoOwner
+	// is used.
+	Owner string
+
+	// Repo is the name of the registry repository. If empty
+	// config.Config.GhRegistryRepoName is used.
+	Repo string
+}
+
+// owner returns the owner of the registry repository
+func (p GitHub) owner() string {
+	if len(p.Owner) > 0 {
+		return p.Owner
+	}
+
+	return p.Cfg.GhRegistryRepoOwner
+}
+
+// name returns the name of the registry repository
+func (p GitHub) name() string {
+	if len(p.Repo) > 0 {
+		return p.Repo
+	}
+
+	return p.Cfg.GhRegistryRepoName
+}
+
+// Name implements Provider
+func (p GitHub) Name() string {
+	return ProviderGitHub
+}
+
+// GetRefSHA implements Provider
+func (p GitHub) GetRefSHA(ctx context.Context, ref string) (string, error) {
+	sha, _, err := p.GH.Repositories.GetCommitSHA1(ctx, p.owner(),
+		p.name(), ref, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to get commit SHA via GitHub API: %s",
+			err.Error())
+	}
+
+	return sha, nil
+}
+
+// ListDir implements Provider
+func (p GitHub) ListDir(ctx context.Context, ref, path string) ([]Entry, error) {
+	_, contents, _, err := p.GH.Repositories.GetContents(ctx, p.owner(),
+		p.name(), path, &github.RepositoryContentGetOptions{
+			Ref: ref,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directory contents via GitHub API: %s",
+			err.Error())
+	}
+
+	entries := []Entry{}
+	for _, content := range contents {
+		entries = append(entries, Entry{
+			Name:        content.GetName(),
+			Path:        content.GetPath(),
+			Type:        content.GetType(),
+			DownloadURL: content.GetDownloadURL(),
+		})
+	}
+
+	return entries, nil
+}
+
+// GetFile implements Provider
+func (p GitHub) GetFile(ctx context.Context, ref, path string) (string, error) {
+	content, _, _, err := p.GH.Repositories.GetContents(ctx, p.owner(),
+		p.name(), path, &github.RepositoryContentGetOptions{
+			Ref: ref,
+		})
+	if err != nil {
+		return "", fmt.Errorf("failed to get content via GitHub API: %s", err.Error())
+	}
+
+	if content == nil {
+		return "", fmt.Errorf("%s is not a file", path)
+	}
+
+	txt, err := content.GetContent()
+	if err != nil {
+		return "", fmt.Errorf("failed to decode content: %s", err.Error())
+	}
+
+	return txt, nil
+}
+
+// CompareCommits implements Provider
+func (p GitHub) CompareCommits(ctx context.Context, base,
+	head string) ([]ChangedFile, bool, error) {
+
+	comparison, _, err := p.GH.Repositories.CompareCommits(ctx,
+		p.owner(), p.name(), base, head)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to compare commits via GitHub API: %s",
+			err.Error())
+	}
+
+	status := comparison.GetStatus()
+	if (status != "ahead" && status != "identical") ||
+		len(comparison.Files) >= githubCompareMaxFiles {
+		return nil, false, nil
+	}
+
+	files := []ChangedFile{}
+	for _, file := range comparison.Files {
+		files = append(files, ChangedFile{
+			Filename:         file.GetFilename(),
+			PreviousFilename: file.GetPreviousFilename(),
+		})
+	}
+
+	return files, true, nil
+}
+
+// GetMergeRequest implements Provider
+func (p GitHub) GetMergeRequest(ctx context.Context, number int) (*MergeRequest, error) {
+	pr, _, err := p.GH.PullRequests.Get(ctx, p.owner(),
+		p.name(), number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pull request via GitHub API: %s",
+			err.Error())
+	}
+
+	return &MergeRequest{
+		Number: pr.GetNumber(),
+		State:  pr.GetState(),
+		Merged: pr.GetMerged(),
+		Head: MergeRequestHead{
+			Ref: pr.GetHead().GetRef(),
+			SHA: pr.GetHead().GetSHA(),
+		},
+		Base: MergeRequestBase{
+			Repo: MergeRequestRepo{
+				FullName: pr.GetBase().GetRepo().GetFullName(),
+			},
+		},
+		User: MergeRequestUser{
+			Login: pr.GetUser().GetLogin(),
+		},
+	}, nil
+}
+
+// ListMergeRequestFiles implements Provider
+func (p GitHub) ListMergeRequestFiles(ctx context.Context,
+	number int) ([]ChangedFile, error) {
+
+	files := []ChangedFile{}
+	listOpts := &github.ListOptions{
+		PerPage: 100,
+	}
+
+	for {
+		page, resp, err := p.GH.PullRequests.ListFiles(ctx, p.owner(),
+			p.name(), number, listOpts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pull request files via "+
+				"GitHub API: %s", err.Error())
+		}
+
+		for _, file := range page {
+			files = append(files, ChangedFile{
+				Filename:         file.GetFilename(),
+				PreviousFilename: file.GetPreviousFilename(),
+			})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		listOpts.Page = resp.NextPage
+	}
+
+	return files, nil
+}
+
+// CreateCheck implements Provider
+func (p GitHub) CreateCheck(ctx context.Context, check Check) (string, error) {
+	checkRun, _, err := p.GH.Checks.CreateCheckRun(ctx, p.owner(),
+		p.name(), github.CreateCheckRunOptions{
+			Name:       check.Name,
+			HeadBranch: check.HeadRef,
+			HeadSHA:    check.HeadSHA,
+			StartedAt:  &github.Timestamp{time.Now()},
+			Status:     &check.Status,
+		})
+	if err != nil {
+		return "", fmt.Errorf("failed to create check run via GitHub API: %s",
+			err.Error())
+	}
+
+	return strconv.FormatInt(checkRun.GetID(), 10), nil
+}
+
+// UpdateCheck implements Provider
+func (p GitHub) UpdateCheck(ctx context.Context, check Check) error {
+	id, err := strconv.ParseInt(check.ID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse check run ID: %s", err.Error())
+	}
+
+	opts := github.UpdateCheckRunOptions{
+		Name:   check.Name,
+		Status: &check.Status,
+		Output: &github.CheckRunOutput{
+			Title:   &check.Title,
+			Summary: &check.Summary,
+			Text:    &check.Text,
+		},
+	}
+
+	if check.Status == CheckStatusCompleted {
+		opts.CompletedAt = &github.Timestamp{time.Now()}
+		opts.Conclusion = &check.Conclusion
+	}
+
+	_, _, err = p.GH.Checks.UpdateCheckRun(ctx, p.owner(),
+		p.name(), id, opts)
+	if err != nil {
+		return fmt.Errorf("failed to update check run via GitHub API: %s",
+			err.Error())
+	}
+
+	return nil
+}
+
+// ListComments implements Provider
+func (p GitHub) ListComments(ctx context.Context, number int) ([]Comment, error) {
+	comments := []Comment{}
+	listOpts := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{
+			PerPage: 100,
+		},
+	}
+
+	for {
+		page, resp, err := p.GH.Issues.ListComments(ctx, p.owner(),
+			p.name(), number, listOpts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list comments via GitHub API: %s",
+				err.Error())
+		}
+
+		for _, comment := range page {
+			comments = append(comments, Comment{
+				ID:    comment.GetID(),
+				Body:  comment.GetBody(),
+				ByBot: comment.GetUser().GetType() == "Bot",
+			})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		listOpts.Page = resp.NextPage
+	}
+
+	return comments, nil
+}
+
+// CreateComment implements Provider
+func (p GitHub) CreateComment(ctx context.Context, number int, body string) error {
+	_, _, err := p.GH.Issues.CreateComment(ctx, p.owner(),
+		p.name(), number, &github.IssueComment{
+			Body: &body,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to create comment via GitHub API: %s", err.Error())
+	}
+
+	return nil
+}
+
+// EditComment implements Provider
+func (p GitHub) EditComment(ctx context.Context, number int, id int64,
+	body string) error {
+
+	_, _, err := p.GH.Issues.EditComment(ctx, p.owner(),
+		p.name(), id, &github.IssueComment{
+			Body: &body,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to edit comment via GitHub API: %s", err.Error())
+	}
+
+	return nil
+}
+
+// TreeURL implements Provider
+func (p GitHub) TreeURL(ref, path string) string {
+	return fmt.Sprintf("https://github.com/%s/%s/tree/%s/%s", p.owner(),
+		p.name(), ref, path)
+}
+
+// VerifyWebhook implements Provider. The X-Hub-Signature-256 header is preferred,
+// the legacy X-Hub-Signature header is only used if allowed by GhWebhookAllowSHA1.
+func (p GitHub) VerifyWebhook(r *http.Request, body []byte) error {
+	sigHeaderName := "X-Hub-Signature-256"
+	computeSig := ComputeGHWebhookSignature256
+
+	if len(r.Header.Get(sigHeaderName)) == 0 && p.Cfg.GhWebhookAllowSHA1 {
+		sigHeaderName = "X-Hub-Signature"
+		computeSig = ComputeGHWebhookSignature
+	}
+
+	sigHeader, ok := r.Header[sigHeaderName]
+	if !ok || len(sigHeader) != 1 {
+		return HeaderMissingError{sigHeaderName}
+	}
+
+	verified := anySecretMatches(p.Cfg.GhWebhookSecrets(), sigHeader[0],
+		func(secret []byte) string {
+			return computeSig(secret, body)
+		})
+	if !verified {
+		return ErrWebhookUnverified
+	}
+
+	return nil
+}
+
+// WebhookEventType implements Provider
+func (p GitHub) WebhookEventType(r *http.Request) (string, error) {
+	eventTypeHeader, ok := r.Header["X-Github-Event"]
+	if !ok || len(eventTypeHeader) != 1 {
+		return "", HeaderMissingError{"X-Github-Event"}
+	}
+
+	return eventTypeHeader[0], nil
+}
+
+// WebhookDeliveryID implements Provider
+func (p GitHub) WebhookDeliveryID(r *http.Request) string {
+	return r.Header.Get("X-Github-Delivery")
+}
+
+// ParseWebhook implements Provider
+func (p GitHub) ParseWebhook(eventType string, body []byte) (*WebhookEvent, error) {
+	switch eventType {
+	case "ping":
+		return &WebhookEvent{Kind: WebhookEventPing}, nil
+	case "pull_request":
+		var event struct {
+			Action      string       `json:"action"`
+			PullRequest MergeRequest `json:"pull_request"`
+			Repository  struct {
+				FullName string `json:"full_name"`
+			} `json:"repository"`
+		}
+		if err := decodeWebhook(body, &event); err != nil {
+			return nil, err
+		}
+
+		action := ""
+		switch event.Action {
+		case "opened", "reopened":
+			action = MergeRequestActionOpened
+		case "synchronize":
+			action = MergeRequestActionUpdated
+		case "closed":
+			action = MergeRequestActionClosed
+		}
+
+		return &WebhookEvent{
+			Kind:         WebhookEventMergeRequest,
+			Action:       action,
+			Repository:   event.Repository.FullName,
+			MergeRequest: &event.PullRequest,
+		}, nil
+	case "push":
+		var event struct {
+			Ref        string `json:"ref"`
+			Deleted    bool   `json:"deleted"`
+			Repository struct {
+				FullName string `json:"full_name"`
+			} `json:"repository"`
+		}
+		if err := decodeWebhook(body, &event); err != nil {
+			return nil, err
+		}
+
+		return &WebhookEvent{
+			Kind:       WebhookEventPush,
+			Repository: event.Repository.FullName,
+			Ref:        event.Ref,
+			Deleted:    event.Deleted,
+		}, nil
+	default:
+		return &WebhookEvent{Kind: WebhookEventOther}, nil
+	}
+}
+
+// WebhookHeaders implements Provider
+func (p GitHub) WebhookHeaders(eventType, deliveryID string, body []byte) http.Header {
+	return http.Header{
+		"X-Hub-Signature": {ComputeGHWebhookSignature(
+			[]byte(p.Cfg.GhWebhookSecret), body)},
+		"X-Hub-Signature-256": {ComputeGHWebhookSignature256(
+			[]byte(p.Cfg.GhWebhookSecret), body)},
+		"X-Github-Event":    {eventType},
+		"X-Github-Delivery": {deliveryID},
+		"Content-Type":      {"application/json"},
+	}
+}
@@ -0,0 +1,557 @@
+package scm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kscout/serverless-registry-api/config"
+)
+
+// GitLab is a Provider for a registry repository hosted by a GitLab server.
+// Create with NewGitLab.
+type GitLab struct {
+	// Cfg is the server configuration
+	Cfg *config.Config
+
+	// rest makes GitLab API requests
+	rest restClient
+
+	// webURL is the URL of the GitLab server
+	webURL string
+
+	// project is the URL escaped full name of the registry repository, which
+	// GitLab accepts as a project ID
+	project string
+}
+
+// gitlabMergeRequest is a merge request returned by the GitLab API
+type gitlabMergeRequest struct {
+	// IID is the merge request's user facing number
+	IID int `json:"iid"`
+
+	// State is opened, closed, locked, or merged
+	State string `json:"state"`
+
+	// SourceBranch is the branch being merged
+	SourceBranch string `json:"source_branch"`
+
+	// SHA is the commit SourceBranch points to
+	SHA string `json:"sha"`
+
+	// Author created the merge request
+	Author struct {
+		Username string `json:"username"`
+	} `json:"author"`
+}
+
+// toMergeRequest converts a GitLab merge request into a MergeRequest
+func (mr gitlabMergeRequest) toMergeRequest() *MergeRequest {
+	state := MergeRequestStateClosed
+	if mr.State == "opened" {
+		state = MergeRequestStateOpen
+	}
+
+	return &MergeRequest{
+		Number: mr.IID,
+		State:  state,
+		Merged: mr.State == "merged",
+		Head: MergeRequestHead{
+			Ref: mr.SourceBranch,
+			SHA: mr.SHA,
+		},
+		User: MergeRequestUser{
+			Login: mr.Author.Username,
+		},
+	}
+}
+
+// gitlabDiff is a changed file returned by the GitLab API
+type gitlabDiff struct {
+	// OldPath is the path of the file before the change
+	OldPath string `json:"old_path"`
+
+	// NewPath is the path of the file after the change
+	NewPath string `json:"new_path"`
+}
+
+// gitlabChangedFiles converts GitLab diffs into ChangedFiles
+func gitlabChangedFiles(diffs []gitlabDiff) []ChangedFile {
+	files := []ChangedFile{}
+
+	for _, diff := range diffs {
+		file := ChangedFile{
+			Filename: diff.NewPath,
+		}
+
+		if diff.OldPath != diff.NewPath {
+			file.PreviousFilename = diff.OldPath
+		}
+
+		files = append(files, file)
+	}
+
+	return files
+}
+
+// NewGitLab creates a GitLab provider which authenticates with
+// RegistryProviderToken
+func NewGitLab(cfg *config.Config) GitLab {
+	webURL := strings.TrimSuffix(cfg.RegistryProviderURL.String(), "/")
+
+	return GitLab{
+		Cfg: cfg,
+		rest: restClient{
+			baseURL: webURL + "/api/v4",
+			header: http.Header{
+				"Private-Token": {cfg.RegistryProviderToken},
+			},
+			client: http.DefaultClient,
+		},
+		webURL: webURL,
+		project: url.PathEscape(fmt.Sprintf("%s/%s", cfg.GhRegistryRepoOwner,
+			cfg.GhRegistryRepoName)),
+	}
+}
+
+// projectPath returns an API path within the registry repository project
+func (p GitLab) projectPath(format string, args ...interface{}) string {
+	return fmt.Sprintf("/projects/%s", p.project) + fmt.Sprintf(format, args...)
+}
+
+// Name implements Provider
+func (p GitLab) Name() string {
+	return ProviderGitLab
+}
+
+// GetRefSHA implements Provider
+func (p GitLab) GetRefSHA(ctx context.Context, ref string) (string, error) {
+	var commit struct {
+		ID string `json:"id"`
+	}
+
+	_, err := p.rest.requestJSON(ctx, http.MethodGet,
+		p.projectPath("/repository/commits/%s", url.PathEscape(ref)), nil, nil,
+		&commit)
+	if err != nil {
+		return "", fmt.Errorf("failed to get commit via GitLab API: %s", err.Error())
+	}
+
+	return commit.ID, nil
+}
+
+// ListDir implements Provider
+func (p GitLab) ListDir(ctx context.Context, ref, path string) ([]Entry, error) {
+	entries := []Entry{}
+
+	query := url.Values{
+		"ref":      {ref},
+		"per_page": {"100"},
+	}
+	if len(path) > 0 {
+		query.Set("path", path)
+	}
+
+	for page := "1"; len(page) > 0; {
+		query.Set("page", page)
+
+		var items []struct {
+			Name string `json:"name"`
+			Path string `json:"path"`
+			Type string `json:"type"`
+		}
+
+		resp, err := p.rest.requestJSON(ctx, http.MethodGet,
+			p.projectPath("/repository/tree"), query, nil, &items)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list directory contents via "+
+				"GitLab API: %s", err.Error())
+		}
+
+		for _, item := range items {
+			entry := Entry{
+				Name: item.Name,
+				Path: item.Path,
+				Type: item.Type,
+			}
+
+			switch item.Type {
+			case "tree":
+				entry.Type = EntryTypeDir
+			case "blob":
+				entry.Type = EntryTypeFile
+				entry.DownloadURL = fmt.Sprintf("%s/%s/%s/-/raw/%s/%s", p.webURL,
+					p.Cfg.GhRegistryRepoOwner, p.Cfg.GhRegistryRepoName, ref,
+					escapePath(item.Path))
+			}
+
+			entries = append(entries, entry)
+		}
+
+		page = resp.Header.Get("X-Next-Page")
+	}
+
+	return entries, nil
+}
+
+// GetFile implements Provider
+func (p GitLab) GetFile(ctx context.Context, ref, path string) (string, error) {
+	_, body, err := p.rest.request(ctx, http.MethodGet,
+		p.projectPath("/repository/files/%s/raw", url.PathEscape(path)),
+		url.Values{"ref": {ref}}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get file via GitLab API: %s", err.Error())
+	}
+
+	return string(body), nil
+}
+
+// CompareCommits implements Provider
+func (p GitLab) CompareCommits(ctx context.Context, base,
+	head string) ([]ChangedFile, bool, error) {
+
+	// {{{1 Check base is an ancestor of head
+	// The compare API diffs from the merge base, which misses changes if
+	// history was rewritten
+	var mergeBase struct {
+		ID string `json:"id"`
+	}
+
+	_, err := p.rest.requestJSON(ctx, http.MethodGet,
+		p.projectPath("/repository/merge_base"), url.Values{
+			"refs[]": {base, head},
+		}, nil, &mergeBase)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get merge base via GitLab API: %s",
+			err.Error())
+	}
+
+	if mergeBase.ID != base {
+		return nil, false, nil
+	}
+
+	// {{{1 Compare
+	var comparison struct {
+		CompareTimeout bool         `json:"compare_timeout"`
+		Diffs          []gitlabDiff `json:"diffs"`
+	}
+
+	_, err = p.rest.requestJSON(ctx, http.MethodGet,
+		p.projectPath("/repository/compare"), url.Values{
+			"from": {base},
+			"to":   {head},
+		}, nil, &comparison)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to compare commits via GitLab API: %s",
+			err.Error())
+	}
+
+	if comparison.CompareTimeout {
+		return nil, false, nil
+	}
+
+	return gitlabChangedFiles(comparison.Diffs), true, nil
+}
+
+// GetMergeRequest implements Provider
+func (p GitLab) GetMergeRequest(ctx context.Context, number int) (*MergeRequest, error) {
+	var mr gitlabMergeRequest
+
+	_, err := p.rest.requestJSON(ctx, http.MethodGet,
+		p.projectPath("/merge_requests/%d", number), nil, nil, &mr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get merge request via GitLab API: %s",
+			err.Error())
+	}
+
+	return mr.toMergeRequest(), nil
+}
+
+// ListMergeRequestFiles implements Provider
+func (p GitLab) ListMergeRequestFiles(ctx context.Context,
+	number int) ([]ChangedFile, error) {
+
+	var changes struct {
+		Changes []gitlabDiff `json:"changes"`
+	}
+
+	_, err := p.rest.requestJSON(ctx, http.MethodGet,
+		p.projectPath("/merge_requests/%d/changes", number), nil, nil, &changes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list merge request changes via "+
+			"GitLab API: %s", err.Error())
+	}
+
+	return gitlabChangedFiles(changes.Changes), nil
+}
+
+// setStatus creates or updates the commit status which represents a check
+func (p GitLab) setStatus(ctx context.Context, check Check) (string, error) {
+	state := "running"
+	if check.Status == CheckStatusCompleted {
+		switch check.Conclusion {
+		case CheckConclusionSuccess:
+			state = "success"
+		case CheckConclusionCancelled:
+			state = "canceled"
+		default:
+			state = "failed"
+		}
+	}
+
+	var status struct {
+		ID int64 `json:"id"`
+	}
+
+	_, err := p.rest.requestJSON(ctx, http.MethodPost,
+		p.projectPath("/statuses/%s", url.PathEscape(check.HeadSHA)), nil,
+		map[string]string{
+			"state":       state,
+			"ref":         check.HeadRef,
+			"name":        check.Name,
+			"description": check.Title,
+		}, &status)
+	if err != nil {
+		return "", fmt.Errorf("failed to set commit status via GitLab API: %s",
+			err.Error())
+	}
+
+	return strconv.FormatInt(status.ID, 10), nil
+}
+
+// CreateCheck implements Provider
+func (p GitLab) CreateCheck(ctx context.Context, check Check) (string, error) {
+	return p.setStatus(ctx, check)
+}
+
+// UpdateCheck implements Provider. Commit statuses are identified by their name,
+// ref and commit, so the ID is not used.
+func (p GitLab) UpdateCheck(ctx context.Context, check Check) error {
+	_, err := p.setStatus(ctx, check)
+	return err
+}
+
+// ListComments implements Provider. System notes are not included.
+func (p GitLab) ListComments(ctx context.Context, number int) ([]Comment, error) {
+	// {{{1 Get user the provider authenticates as
+	var self struct {
+		Username string `json:"username"`
+	}
+
+	_, err := p.rest.requestJSON(ctx, http.MethodGet, "/user", nil, nil, &self)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get authenticated user via GitLab API: %s",
+			err.Error())
+	}
+
+	// {{{1 List notes
+	comments := []Comment{}
+
+	query := url.Values{
+		"sort":     {"asc"},
+		"order_by": {"created_at"},
+		"per_page": {"100"},
+	}
+
+	for page := "1"; len(page) > 0; {
+		query.Set("page", page)
+
+		var notes []struct {
+			ID     int64  `json:"id"`
+			Body   string `json:"body"`
+			System bool   `json:"system"`
+			Author struct {
+				Username string `json:"username"`
+			} `json:"author"`
+		}
+
+		resp, err := p.rest.requestJSON(ctx, http.MethodGet,
+			p.projectPath("/merge_requests/%d/notes", number), query, nil, &notes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list merge request notes via "+
+				"GitLab API: %s", err.Error())
+		}
+
+		for _, note := range notes {
+			if note.System {
+				continue
+			}
+
+			comments = append(comments, Comment{
+				ID:    note.ID,
+				Body:  note.Body,
+				ByBot: note.Author.Username == self.Username,
+			})
+		}
+
+		page = resp.Header.Get("X-Next-Page")
+	}
+
+	return comments, nil
+}
+
+// CreateComment implements Provider
+func (p GitLab) CreateComment(ctx context.Context, number int, body string) error {
+	_, err := p.rest.requestJSON(ctx, http.MethodPost,
+		p.projectPath("/merge_requests/%d/notes", number), nil,
+		map[string]string{"body": body}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create merge request note via GitLab API: %s",
+			err.Error())
+	}
+
+	return nil
+}
+
+// EditComment implements Provider
+func (p GitLab) EditComment(ctx context.Context, number int, id int64,
+	body string) error {
+
+	_, err := p.rest.requestJSON(ctx, http.MethodPut,
+		p.projectPath("/merge_requests/%d/notes/%d", number, id), nil,
+		map[string]string{"body": body}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to edit merge request note via GitLab API: %s",
+			err.Error())
+	}
+
+	return nil
+}
+
+// TreeURL implements Provider
+func (p GitLab) TreeURL(ref, path string) string {
+	return fmt.Sprintf("%s/%s/%s/-/tree/%s/%s", p.webURL, p.Cfg.GhRegistryRepoOwner,
+		p.Cfg.GhRegistryRepoName, ref, path)
+}
+
+// VerifyWebhook implements Provider. GitLab sends the secret in the X-Gitlab-Token
+// header.
+func (p GitLab) VerifyWebhook(r *http.Request, body []byte) error {
+	token, ok := r.Header["X-Gitlab-Token"]
+	if !ok || len(token) != 1 {
+		return HeaderMissingError{"X-Gitlab-Token"}
+	}
+
+	verified := anySecretMatches([]string{p.Cfg.RegistryWebhookSecret}, token[0],
+		func(secret []byte) string {
+			return string(secret)
+		})
+	if !verified {
+		return ErrWebhookUnverified
+	}
+
+	return nil
+}
+
+// WebhookEventType implements Provider
+func (p GitLab) WebhookEventType(r *http.Request) (string, error) {
+	eventType := r.Header.Get("X-Gitlab-Event")
+	if len(eventType) == 0 {
+		return "", HeaderMissingError{"X-Gitlab-Event"}
+	}
+
+	return eventType, nil
+}
+
+// WebhookDeliveryID implements Provider
+func (p GitLab) WebhookDeliveryID(r *http.Request) string {
+	return r.Header.Get("X-Gitlab-Event-UUID")
+}
+
+// ParseWebhook implements Provider
+func (p GitLab) ParseWebhook(eventType string, body []byte) (*WebhookEvent, error) {
+	var project struct {
+		Project struct {
+			PathWithNamespace string `json:"path_with_namespace"`
+		} `json:"project"`
+	}
+	if err := decodeWebhook(body, &project); err != nil {
+		return nil, err
+	}
+
+	switch eventType {
+	case "Merge Request Hook":
+		var event struct {
+			ObjectAttributes struct {
+				IID          int    `json:"iid"`
+				State        string `json:"state"`
+				Action       string `json:"action"`
+				SourceBranch string `json:"source_branch"`
+				OldRev       string `json:"oldrev"`
+				LastCommit   struct {
+					ID string `json:"id"`
+				} `json:"last_commit"`
+			} `json:"object_attributes"`
+			Changes struct {
+				TargetBranch *json.RawMessage `json:"target_branch"`
+			} `json:"changes"`
+		}
+		if err := decodeWebhook(body, &event); err != nil {
+			return nil, err
+		}
+
+		attrs := event.ObjectAttributes
+
+		// Updates which do not push commits or change the target branch do not
+		// affect validation
+		action := ""
+		switch attrs.Action {
+		case "open", "reopen":
+			action = MergeRequestActionOpened
+		case "update":
+			if len(attrs.OldRev) > 0 || event.Changes.TargetBranch != nil {
+				action = MergeRequestActionUpdated
+			}
+		case "close", "merge":
+			action = MergeRequestActionClosed
+		}
+
+		mr := gitlabMergeRequest{
+			IID:          attrs.IID,
+			State:        attrs.State,
+			SourceBranch: attrs.SourceBranch,
+			SHA:          attrs.LastCommit.ID,
+		}
+
+		return &WebhookEvent{
+			Kind:         WebhookEventMergeRequest,
+			Action:       action,
+			Repository:   project.Project.PathWithNamespace,
+			MergeRequest: mr.toMergeRequest(),
+		}, nil
+	case "Push Hook":
+		var event struct {
+			Ref   string `json:"ref"`
+			After string `json:"after"`
+		}
+		if err := decodeWebhook(body, &event); err != nil {
+			return nil, err
+		}
+
+		return &WebhookEvent{
+			Kind:       WebhookEventPush,
+			Repository: project.Project.PathWithNamespace,
+			Ref:        event.Ref,
+			Deleted:    event.After == nullSHA,
+		}, nil
+	default:
+		return &WebhookEvent{
+			Kind:       WebhookEventOther,
+			Repository: project.Project.PathWithNamespace,
+		}, nil
+	}
+}
+
+// WebhookHeaders implements Provider
+func (p GitLab) WebhookHeaders(eventType, deliveryID string, body []byte) http.Header {
+	return http.Header{
+		"X-Gitlab-Token":      {p.Cfg.RegistryWebhookSecret},
+		"X-Gitlab-Event":      {eventType},
+		"X-Gitlab-Event-Uuid": {deliveryID},
+		"Content-Type":        {"application/json"},
+	}
+}
@@ -0,0 +1,117 @@
+package scm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// restErrorBodyLength is the maximum number of bytes of an error response body
+// included in errors
+const restErrorBodyLength = 512
+
+// restClient makes requests to a JSON REST API
+type restClient struct {
+	// baseURL is the URL of the API, requests paths are appended
+	baseURL string
+
+	// header is added to every request, used to authenticate
+	header http.Header
+
+	// client makes requests
+	client *http.Client
+}
+
+// request makes an API request. The path must already be escaped. If reqBody is not
+// nil it is sent as JSON. Returns an error if the response status is not 2xx.
+func (c restClient) request(ctx context.Context, method, path string, query url.Values,
+	reqBody interface{}) (*http.Response, []byte, error) {
+
+	// {{{1 Build request
+	u, err := url.Parse(c.baseURL + path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse request URL: %s", err.Error())
+	}
+	u.RawQuery = query.Encode()
+
+	var bodyReader io.Reader
+	if reqBody != nil {
+		bodyBytes, err := json.Marshal(reqBody)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal request body into "+
+				"JSON: %s", err.Error())
+		}
+		bodyReader = bytes.NewReader(bodyBytes)
+	}
+
+	req, err := http.NewRequest(method, u.String(), bodyReader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %s", err.Error())
+	}
+	req = req.WithContext(ctx)
+
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	// {{{1 Make request
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to make %s %s request: %s", method,
+			path, err.Error())
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s %s response body: %s",
+			method, path, err.Error())
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if len(respBytes) > restErrorBodyLength {
+			respBytes = respBytes[:restErrorBodyLength]
+		}
+
+		return nil, nil, fmt.Errorf("%s %s returned %s: %s", method, path,
+			resp.Status, string(respBytes))
+	}
+
+	return resp, respBytes, nil
+}
+
+// requestJSON makes an API request and decodes the response body as JSON into
+// respBody, unless respBody is nil
+func (c restClient) requestJSON(ctx context.Context, method, path string,
+	query url.Values, reqBody, respBody interface{}) (*http.Response, error) {
+
+	resp, respBytes, err := c.request(ctx, method, path, query, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if respBody == nil {
+		return resp, nil
+	}
+
+	if err := json.Unmarshal(respBytes, respBody); err != nil {
+		return nil, fmt.Errorf("failed to decode %s %s response body as JSON: %s",
+			method, path, err.Error())
+	}
+
+	return resp, nil
+}
+
+// escapePath escapes each segment of a slash separated path
+func escapePath(path string) string {
+	u := url.URL{Path: path}
+	return u.EscapedPath()
+}
@@ -0,0 +1,367 @@
+package scm
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+
+	"github.com/kscout/serverless-registry-api/config"
+
+	"github.com/google/go-github/v26/github"
+)
+
+// Names of providers, used as values of the RegistryProvider configuration field
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+	ProviderGitea  = "gitea"
+)
+
+// nullSHA is the commit SHA GitLab and Gitea use in push events when a ref is deleted
+const nullSHA = "0000000000000000000000000000000000000000"
+
+// Types of repository directory entries
+const (
+	EntryTypeFile = "file"
+	EntryTypeDir  = "dir"
+)
+
+// Statuses of checks
+const (
+	CheckStatusInProgress = "in_progress"
+	CheckStatusCompleted  = "completed"
+)
+
+// Conclusions of completed checks
+const (
+	CheckConclusionSuccess   = "success"
+	CheckConclusionFailure   = "failure"
+	CheckConclusionCancelled = "cancelled"
+)
+
+// States of merge requests
+const (
+	MergeRequestStateOpen   = "open"
+	MergeRequestStateClosed = "closed"
+)
+
+// Kinds of webhook events
+const (
+	WebhookEventPing         = "ping"
+	WebhookEventMergeRequest = "merge_request"
+	WebhookEventPush         = "push"
+	WebhookEventOther        = "other"
+)
+
+// Actions of merge request webhook events. Merged merge requests are closed.
+const (
+	MergeRequestActionOpened  = "opened"
+	MergeRequestActionUpdated = "updated"
+	MergeRequestActionClosed  = "closed"
+)
+
+// Entry is a file or directory in a repository
+type Entry struct {
+	// Name of file or directory
+	Name string
+
+	// Path from the root of the repository
+	Path string
+
+	// Type is EntryTypeFile or EntryTypeDir. Other types of entries, like
+	// submodules, have other values.
+	Type string
+
+	// DownloadURL is a URL at which the raw file can be downloaded, empty for
+	// directories
+	DownloadURL string
+}
+
+// ChangedFile is a file modified by a commit or merge request
+type ChangedFile struct {
+	// Filename is the path of the file
+	Filename string
+
+	// PreviousFilename is the path of the file before it was moved, empty if
+	// the file was not moved
+	PreviousFilename string
+}
+
+// MergeRequest is a GitHub pull request, GitLab merge request, or Gitea pull request.
+// The JSON form is a subset of a GitHub pull request.
+type MergeRequest struct {
+	// Number is the merge request's unique user facing number
+	Number int `json:"number"`
+
+	// State is MergeRequestStateOpen or MergeRequestStateClosed
+	State string `json:"state"`
+
+	// Merged indicates the merge request was merged
+	Merged bool `json:"merged"`
+
+	// Head is the branch which is being merged
+	Head MergeRequestHead `json:"head"`
+
+	// Base is the branch which is being merged into
+	Base MergeRequestBase `json:"base"`
+
+	// User who created the merge request
+	User MergeRequestUser `json:"user"`
+}
+
+// MergeRequestHead is the branch a merge request is merging
+type MergeRequestHead struct {
+	// Ref is the name of the branch
+	Ref string `json:"ref"`
+
+	// SHA is the commit the branch points to
+	SHA string `json:"sha"`
+}
+
+// MergeRequestBase is the branch a merge request is merging into
+type MergeRequestBase struct {
+	// Repo is the repository of the branch
+	Repo MergeRequestRepo `json:"repo"`
+}
+
+// MergeRequestRepo is a repository a merge request is made in
+type MergeRequestRepo struct {
+	// FullName is the repository's name, in the format owner/name. Only set by
+	// GitHub, other providers have a single registry repository.
+	FullName string `json:"full_name"`
+}
+
+// MergeRequestUser is the user who created a merge request
+type MergeRequestUser struct {
+	// Login is the user's name
+	Login string `json:"login"`
+}
+
+// Check reports the result of validating a commit
+type Check struct {
+	// ID identifies the check, set by Provider.CreateCheck
+	ID string
+
+	// Name of the check
+	Name string
+
+	// HeadRef is the branch being checked
+	HeadRef string
+
+	// HeadSHA is the commit being checked
+	HeadSHA string
+
+	// Status is CheckStatusInProgress or CheckStatusCompleted
+	Status string
+
+	// Conclusion is one of the CheckConclusion* constants, only set if Status
+	// is CheckStatusCompleted
+	Conclusion string
+
+	// Title summarizes the result in a few words
+	Title string
+
+	// Summary of the result in markdown
+	Summary string
+
+	// Text details the result in markdown
+	Text string
+}
+
+// Comment is a comment on a merge request
+type Comment struct {
+	// ID identifies the comment
+	ID int64
+
+	// Body of the comment in markdown
+	Body string
+
+	// ByBot indicates the comment was made by the user the provider
+	// authenticates as
+	ByBot bool
+}
+
+// WebhookEvent is a webhook request which was parsed by Provider.ParseWebhook
+type WebhookEvent struct {
+	// Kind is one of the WebhookEvent* constants
+	Kind string
+
+	// Action is one of the MergeRequestAction* constants if Kind is
+	// WebhookEventMergeRequest. Empty if the action does not need handling.
+	Action string
+
+	// Repository is the full name, in the format OWNER/NAME, of the repository
+	// which sent the event
+	Repository string
+
+	// MergeRequest is set if Kind is WebhookEventMergeRequest
+	MergeRequest *MergeRequest
+
+	// Ref is the full Git reference pushed if Kind is WebhookEventPush
+	Ref string
+
+	// Deleted indicates Ref was deleted if Kind is WebhookEventPush
+	Deleted bool
+}
+
+// ErrWebhookUnverified indicates a webhook request was not signed by the provider
+var ErrWebhookUnverified = errors.New("could not verify request")
+
+// HeaderMissingError indicates a webhook request did not have a required header
+type HeaderMissingError struct {
+	// Header is the name of the missing header
+	Header string
+}
+
+// Error implements error
+func (e HeaderMissingError) Error() string {
+	return fmt.Sprintf("%s header must have a value", e.Header)
+}
+
+// Provider accesses the registry repository on a source code hosting provider
+type Provider interface {
+	// Name returns one of the Provider* constants
+	Name() string
+
+	// GetRefSHA returns the SHA of the commit a branch points to
+	GetRefSHA(ctx context.Context, ref string) (string, error)
+
+	// ListDir returns the entries of a directory at a Git reference. An empty
+	// path lists the root of the repository.
+	ListDir(ctx context.Context, ref, path string) ([]Entry, error)
+
+	// GetFile returns the contents of a file at a Git reference
+	GetFile(ctx context.Context, ref, path string) (string, error)
+
+	// CompareCommits returns the files changed between the base and head
+	// commits. The second return value is false if the changes could not be
+	// determined, ex., if base is not an ancestor of head or if too many files
+	// were changed.
+	CompareCommits(ctx context.Context, base, head string) ([]ChangedFile, bool, error)
+
+	// GetMergeRequest returns a merge request
+	GetMergeRequest(ctx context.Context, number int) (*MergeRequest, error)
+
+	// ListMergeRequestFiles returns the files changed by a merge request
+	ListMergeRequestFiles(ctx context.Context, number int) ([]ChangedFile, error)
+
+	// CreateCheck reports a check on a commit and returns its ID
+	CreateCheck(ctx context.Context, check Check) (string, error)
+
+	// UpdateCheck changes a check created by CreateCheck
+	UpdateCheck(ctx context.Context, check Check) error
+
+	// ListComments returns the comments on a merge request, oldest first
+	ListComments(ctx context.Context, number int) ([]Comment, error)
+
+	// CreateComment comments on a merge request
+	CreateComment(ctx context.Context, number int, body string) error
+
+	// EditComment changes the body of a comment on a merge request
+	EditComment(ctx context.Context, number int, id int64, body string) error
+
+	// TreeURL returns the URL of the web page which shows a path at a Git
+	// reference
+	TreeURL(ref, path string) string
+
+	// VerifyWebhook checks a webhook request was sent by the provider.
+	// Returns a HeaderMissingError if the request was not signed, or
+	// ErrWebhookUnverified if the signature is wrong.
+	VerifyWebhook(r *http.Request, body []byte) error
+
+	// WebhookEventType returns the provider specific type of a webhook request.
+	// Returns a HeaderMissingError if the request does not have a type.
+	WebhookEventType(r *http.Request) (string, error)
+
+	// WebhookDeliveryID returns the ID of a webhook request, empty if the
+	// provider did not send one
+	WebhookDeliveryID(r *http.Request) string
+
+	// ParseWebhook parses a webhook request body of a provider specific type
+	ParseWebhook(eventType string, body []byte) (*WebhookEvent, error)
+
+	// WebhookHeaders returns the headers the provider would send with a webhook
+	// request, including a signature. Used to make mock webhook requests.
+	WebhookHeaders(eventType, deliveryID string, body []byte) http.Header
+}
+
+// NewProvider creates the Provider selected by the RegistryProvider configuration
+// field. The gh client is only used by the GitHub provider and may be nil otherwise.
+func NewProvider(cfg *config.Config, gh *github.Client) (Provider, error) {
+	switch cfg.RegistryProvider {
+	case ProviderGitHub:
+		return GitHub{
+			Cfg: cfg,
+			GH:  gh,
+		}, nil
+	case ProviderGitLab:
+		return NewGitLab(cfg), nil
+	case ProviderGitea:
+		return NewGitea(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown registry provider: %s", cfg.RegistryProvider)
+	}
+}
+
+// computeHMAC returns the hex encoded HMAC of a body
+func computeHMAC(hashFn func() hash.Hash, secret, body []byte) string {
+	bodyHMAC := hmac.New(hashFn, secret)
+	bodyHMAC.Write(body)
+
+	return hex.EncodeToString(bodyHMAC.Sum(nil))
+}
+
+// ComputeGHWebhookSignature creates the expected legacy X-Hub-Signature header value
+// for a body, which uses SHA-1.
+// WARNING: Compare the resulting signature with crypto/hmax.Equal for security purposes.
+func ComputeGHWebhookSignature(secret, body []byte) string {
+	return "sha1=" + computeHMAC(sha1.New, secret, body)
+}
+
+// ComputeGHWebhookSignature256 creates the expected X-Hub-Signature-256 header value
+// for a body, which uses SHA-256.
+// WARNING: Compare the resulting signature with crypto/hmax.Equal for security purposes.
+func ComputeGHWebhookSignature256(secret, body []byte) string {
+	return "sha256=" + computeHMAC(sha256.New, secret, body)
+}
+
+// ComputeGiteaWebhookSignature creates the expected X-Gitea-Signature header value
+// for a body.
+// WARNING: Compare the resulting signature with crypto/hmax.Equal for security purposes.
+func ComputeGiteaWebhookSignature(secret, body []byte) string {
+	return computeHMAC(sha256.New, secret, body)
+}
+
+// anySecretMatches returns true if the signature computed for any secret equals
+// the expected signature
+func anySecretMatches(secrets []string, expected string,
+	computeSig func(secret []byte) string) bool {
+
+	for _, secret := range secrets {
+		if len(secret) == 0 {
+			continue
+		}
+
+		if hmac.Equal([]byte(expected), []byte(computeSig([]byte(secret)))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decodeWebhook parses a webhook request body as JSON
+func decodeWebhook(body []byte, v interface{}) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse webhook body as JSON: %s", err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package scm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/kscout/serverless-registry-api/config"
+
+	"github.com/google/go-github/v26/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestGitLab creates a GitLab provider for a test server
+func newTestGitLab(t *testing.T, handler http.HandlerFunc) (GitLab, func()) {
+	server := httptest.NewServer(handler)
+
+	serverURL, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+
+	return NewGitLab(&config.Config{
+		RegistryProviderURL:   *serverURL,
+		RegistryProviderToken: "token",
+		GhRegistryRepoOwner:   "kscout",
+		GhRegistryRepoName:    "serverless-apps",
+	}), server.Close
+}
+
+func TestGitLabListDir(t *testing.T) {
+	p, closeServer := newTestGitLab(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token", r.Header.Get("Private-Token"))
+		assert.Equal(t, "/api/v4/projects/kscout%2Fserverless-apps/repository/tree",
+			r.URL.EscapedPath())
+
+		if r.URL.Query().Get("page") == "1" {
+			w.Header().Set("X-Next-Page", "2")
+			w.Write([]byte(`[{"name": "hello-world", "path": "hello-world", "type": "tree"}]`))
+			return
+		}
+
+		w.Write([]byte(`[{"name": "README.md", "path": "README.md", "type": "blob"}]`))
+	})
+	defer closeServer()
+
+	entries, err := p.ListDir(context.Background(), "master", "")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Entry{
+		Entry{
+			Name: "hello-world",
+			Path: "hello-world",
+			Type: EntryTypeDir,
+		},
+		Entry{
+			Name:        "README.md",
+			Path:        "README.md",
+			Type:        EntryTypeFile,
+			DownloadURL: p.webURL + "/kscout/serverless-apps/-/raw/master/README.md",
+		},
+	}, entries)
+}
+
+func TestGitLabCompareCommitsRewritten(t *testing.T) {
+	p, closeServer := newTestGitLab(t, func(w http.ResponseWriter, r *http.Request) {
+		// Base is not an ancestor of head
+		assert.Equal(t, "/api/v4/projects/kscout%2Fserverless-apps/repository/merge_base",
+			r.URL.EscapedPath())
+		w.Write([]byte(`{"id": "other"}`))
+	})
+	defer closeServer()
+
+	files, ok, err := p.CompareCommits(context.Background(), "base", "head")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, files)
+}
+
+func TestGitLabParseMergeRequestWebhook(t *testing.T) {
+	p := NewGitLab(&config.Config{})
+
+	// Update which pushed commits
+	event, err := p.ParseWebhook("Merge Request Hook", []byte(`{"project": {"path_with_namespace": "kscout/serverless-apps"}, "object_attributes": {"iid": 3, "state": "opened", "action": "update", "source_branch": "new-app", "oldrev": "abc", "last_commit": {"id": "def"}}}`))
+	assert.NoError(t, err)
+
+	assert.Equal(t, &WebhookEvent{
+		Kind:       WebhookEventMergeRequest,
+		Action:     MergeRequestActionUpdated,
+		Repository: "kscout/serverless-apps",
+		MergeRequest: &MergeRequest{
+			Number: 3,
+			State:  MergeRequestStateOpen,
+			Head: MergeRequestHead{
+				Ref: "new-app",
+				SHA: "def",
+			},
+		},
+	}, event)
+
+	// Update which only changed the title
+	event, err = p.ParseWebhook("Merge Request Hook", []byte(`{"object_attributes": {"iid": 3, "state": "opened", "action": "update"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "", event.Action)
+
+	// Merged
+	event, err = p.ParseWebhook("Merge Request Hook", []byte(`{"object_attributes": {"iid": 3, "state": "merged", "action": "merge"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, MergeRequestActionClosed, event.Action)
+	assert.True(t, event.MergeRequest.Merged)
+	assert.Equal(t, MergeRequestStateClosed, event.MergeRequest.State)
+}
+
+func TestGiteaParsePullRequestWebhook(t *testing.T) {
+	p := NewGitea(&config.Config{})
+
+	event, err := p.ParseWebhook("pull_request", []byte(`{"action": "synchronized", "number": 4, "pull_request": {"number": 4, "state": "open", "merged": false, "head": {"ref": "new-app", "sha": "abc"}, "user": {"login": "alice"}}, "repository": {"full_name": "kscout/serverless-apps"}}`))
+	assert.NoError(t, err)
+
+	assert.Equal(t, &WebhookEvent{
+		Kind:       WebhookEventMergeRequest,
+		Action:     MergeRequestActionUpdated,
+		Repository: "kscout/serverless-apps",
+		MergeRequest: &MergeRequest{
+			Number: 4,
+			State:  MergeRequestStateOpen,
+			Head: MergeRequestHead{
+				Ref: "new-app",
+				SHA: "abc",
+			},
+			User: MergeRequestUser{
+				Login: "alice",
+			},
+		},
+	}, event)
+
+	// Deleted branch
+	event, err = p.ParseWebhook("push", []byte(`{"ref": "refs/heads/master", "after": "0000000000000000000000000000000000000000"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, WebhookEventPush, event.Kind)
+	assert.True(t, event.Deleted)
+}
+
+func TestWebhookVerification(t *testing.T) {
+	cfg := &config.Config{
+		GhWebhookSecret:       "github",
+		RegistryWebhookSecret: "secret",
+	}
+	body := []byte(`{}`)
+
+	for _, provider := range []Provider{GitHub{Cfg: cfg}, NewGitLab(cfg), NewGitea(cfg)} {
+		// Signed by provider
+		req := httptest.NewRequest("POST", "/apps/webhook", nil)
+		req.Header = provider.WebhookHeaders("push", "1", body)
+
+		assert.NoError(t, provider.VerifyWebhook(req, body), provider.Name())
+
+		// Not signed
+		req = httptest.NewRequest("POST", "/apps/webhook", nil)
+
+		_, ok := provider.VerifyWebhook(req, body).(HeaderMissingError)
+		assert.True(t, ok, provider.Name())
+	}
+}
+
+func TestGitHubRepository(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+
+		assert.Equal(t, "/repos/other-org/apps/pulls/3", r.URL.Path)
+		w.Write([]byte(`{"number": 3, "head": {"ref": "add-app", "sha": "abc"}, "base": {"repo": {"full_name": "other-org/apps"}}}`))
+	}))
+	defer server.Close()
+
+	gh := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	gh.BaseURL = baseURL
+
+	cfg := &config.Config{
+		GhRegistryRepoOwner: "kscout",
+		GhRegistryRepoName:  "serverless-apps",
+	}
+
+	// The configured registry repository is used if none is set
+	assert.Equal(t, "https://github.com/kscout/serverless-apps/tree/master/hello",
+		GitHub{Cfg: cfg, GH: gh}.TreeURL("master", "hello"))
+
+	p := GitHub{
+		Cfg:   cfg,
+		GH:    gh,
+		Owner: "other-org",
+		Repo:  "apps",
+	}
+	assert.Equal(t, "https://github.com/other-org/apps/tree/master/hello",
+		p.TreeURL("master", "hello"))
+
+	mr, err := p.GetMergeRequest(context.Background(), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "other-org/apps", mr.Base.Repo.FullName)
+}
@@ -0,0 +1,10 @@
+/*
+Track the verification status of apps.
+
+Reviewers move apps between verification statuses. Each transition is checked
+against the allowed transitions, and recorded with a reason in the
+verification_audit collection. The current status of each app is stored in the
+app_verifications collection along with the app version it applies to. When an
+app's version changes its status is reset to pending.
+*/
+package verification
@@ -0,0 +1,341 @@
+package verification
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kscout/serverless-registry-api/models"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// transitions are the verification status transitions reviewers can make. Keys
+// are the current status, values are the statuses which can be transitioned to.
+var transitions = map[string][]string{
+	models.VerificationStatusPending: []string{
+		models.VerificationStatusVerifying,
+	},
+	models.VerificationStatusVerifying: []string{
+		models.VerificationStatusGood,
+		models.VerificationStatusBad,
+		models.VerificationStatusPending,
+	},
+	models.VerificationStatusGood: []string{
+		models.VerificationStatusVerifying,
+		models.VerificationStatusBad,
+	},
+	models.VerificationStatusBad: []string{
+		models.VerificationStatusVerifying,
+	},
+}
+
+// CanTransition returns true if a reviewer can change an app's verification status
+// from one status to another
+func CanTransition(from, to string) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ErrAppNotFound is returned when an app does not exist in the catalog
+var ErrAppNotFound = fmt.Errorf("app not found")
+
+// InvalidTransitionError is returned when a reviewer tries to make a transition
+// which is not allowed
+type InvalidTransitionError struct {
+	// From is the current status
+	From string
+
+	// To is the requested status
+	To string
+}
+
+// Error implements error
+func (e InvalidTransitionError) Error() string {
+	return fmt.Sprintf("cannot transition from %s to %s", e.From, e.To)
+}
+
+// Verifier manages the verification statuses of apps
+type Verifier struct {
+	// MDbApps is used to access the apps collection
+	MDbApps *mongo.Collection
+
+	// MDbVerifications is used to access the app_verifications collection
+	MDbVerifications *mongo.Collection
+
+	// MDbVerificationAudit is used to access the verification_audit collection
+	MDbVerificationAudit *mongo.Collection
+}
+
+// getApp returns an app from the catalog. Returns ErrAppNotFound if the app does
+// not exist.
+func (v Verifier) getApp(ctx context.Context, appID string) (models.App, error) {
+	var app models.App
+
+	err := v.MDbApps.FindOne(ctx, bson.D{{"app_id", appID}}).Decode(&app)
+	if err == mongo.ErrNoDocuments {
+		return app, ErrAppNotFound
+	} else if err != nil {
+		return app, fmt.Errorf("failed to get app %s: %s", appID, err.Error())
+	}
+
+	return app, nil
+}
+
+// current returns the verification status of the app's current version
+func (v Verifier) current(ctx context.Context, app models.App) (models.AppVerification, error) {
+	var verif models.AppVerification
+
+	err := v.MDbVerifications.FindOne(ctx, bson.D{{"_id", app.AppID}}).Decode(&verif)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return verif, fmt.Errorf("failed to get verification of app %s: %s",
+			app.AppID, err.Error())
+	}
+
+	if err == mongo.ErrNoDocuments || verif.Version != app.Version {
+		return models.AppVerification{
+			AppID:   app.AppID,
+			Status:  models.VerificationStatusPending,
+			Version: app.Version,
+		}, nil
+	}
+
+	return verif, nil
+}
+
+// Get returns the verification status of an app in the catalog. Returns
+// ErrAppNotFound if the app does not exist.
+func (v Verifier) Get(ctx context.Context, appID string) (models.AppVerification, error) {
+	app, err := v.getApp(ctx, appID)
+	if err != nil {
+		return models.AppVerification{}, err
+	}
+
+	return v.current(ctx, app)
+}
+
+// History returns the verification transitions of an app, newest first
+func (v Verifier) History(ctx context.Context, appID string) ([]models.VerificationTransition, error) {
+	cursor, err := v.MDbVerificationAudit.Find(ctx, bson.D{{"app_id", appID}},
+		options.Find().SetSort(bson.D{{"created_at", -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query verification audit: %s",
+			err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	history := []models.VerificationTransition{}
+
+	for cursor.Next(ctx) {
+		var transition models.VerificationTransition
+		if err := cursor.Decode(&transition); err != nil {
+			return nil, fmt.Errorf("failed to decode verification transition: %s",
+				err.Error())
+		}
+
+		history = append(history, transition)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over verification audit: %s",
+			err.Error())
+	}
+
+	return history, nil
+}
+
+// Transition changes the verification status of an app in the catalog on behalf of
+// a reviewer. Returns ErrAppNotFound if the app does not exist, and an
+// InvalidTransitionError if the transition is not allowed.
+func (v Verifier) Transition(ctx context.Context, appID, to, reason,
+	reviewer string) (models.AppVerification, error) {
+
+	// {{{1 Check transition
+	app, err := v.getApp(ctx, appID)
+	if err != nil {
+		return models.AppVerification{}, err
+	}
+
+	verif, err := v.current(ctx, app)
+	if err != nil {
+		return verif, err
+	}
+
+	if !CanTransition(verif.Status, to) {
+		return verif, InvalidTransitionError{
+			From: verif.Status,
+			To:   to,
+		}
+	}
+
+	// {{{1 Record
+	transition := newTransition(app.AppID, app.Version, verif.Status, to,
+		reason, reviewer)
+
+	verif, err = v.record(ctx, transition)
+	if err != nil {
+		return verif, err
+	}
+
+	// {{{1 Update catalog
+	// Only if the app has not been updated in the meantime
+	_, err = v.MDbApps.UpdateOne(ctx, bson.D{
+		{"app_id", app.AppID},
+		{"version", app.Version},
+	}, bson.D{{"$set", bson.D{{"verification_status", to}}}})
+	if err != nil {
+		return verif, fmt.Errorf("failed to set verification status of app %s "+
+			"in catalog: %s", app.AppID, err.Error())
+	}
+
+	return verif, nil
+}
+
+// Apply sets the verification status of every app in an apps collection, used
+// before a new generation of apps is swapped in. Apps keep their status as long as
+// their version is unchanged, otherwise their status becomes pending. The
+// transitions to pending caused by version changes are returned, and should be
+// saved with Record once the apps collection is in use.
+func (v Verifier) Apply(ctx context.Context, appsColl *mongo.Collection) ([]models.VerificationTransition, error) {
+	// {{{1 Get all verifications
+	verifs := map[string]models.AppVerification{}
+
+	verifsCursor, err := v.MDbVerifications.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query verifications: %s", err.Error())
+	}
+	defer verifsCursor.Close(ctx)
+
+	for verifsCursor.Next(ctx) {
+		var verif models.AppVerification
+		if err := verifsCursor.Decode(&verif); err != nil {
+			return nil, fmt.Errorf("failed to decode verification: %s",
+				err.Error())
+		}
+
+		verifs[verif.AppID] = verif
+	}
+
+	if err := verifsCursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over verifications: %s",
+			err.Error())
+	}
+
+	// {{{1 Determine status of each app
+	// statuses are the verification statuses which must be set, keys are app IDs
+	statuses := map[string]string{}
+	resets := []models.VerificationTransition{}
+
+	appsCursor, err := appsColl.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s collection: %s",
+			appsColl.Name(), err.Error())
+	}
+	defer appsCursor.Close(ctx)
+
+	for appsCursor.Next(ctx) {
+		var app models.App
+		if err := appsCursor.Decode(&app); err != nil {
+			return nil, fmt.Errorf("failed to decode app: %s", err.Error())
+		}
+
+		status := models.VerificationStatusPending
+
+		if verif, ok := verifs[app.AppID]; ok {
+			if verif.Version == app.Version {
+				status = verif.Status
+			} else if verif.Status != models.VerificationStatusPending {
+				resets = append(resets, newTransition(app.AppID, app.Version,
+					verif.Status, models.VerificationStatusPending,
+					fmt.Sprintf("version changed from %s to %s",
+						verif.Version, app.Version), ""))
+			}
+		}
+
+		if app.VerificationStatus != status {
+			statuses[app.AppID] = status
+		}
+	}
+
+	if err := appsCursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over %s collection: %s",
+			appsColl.Name(), err.Error())
+	}
+
+	// {{{1 Set statuses
+	for appID, status := range statuses {
+		_, err := appsColl.UpdateOne(ctx, bson.D{{"app_id", appID}},
+			bson.D{{"$set", bson.D{{"verification_status", status}}}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to set verification status of app "+
+				"%s: %s", appID, err.Error())
+		}
+	}
+
+	return resets, nil
+}
+
+// Record saves transitions returned by Apply
+func (v Verifier) Record(ctx context.Context, transitions []models.VerificationTransition) error {
+	for _, transition := range transitions {
+		if _, err := v.record(ctx, transition); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// record saves an app's new verification status and adds the transition to the
+// audit trail
+func (v Verifier) record(ctx context.Context, transition models.VerificationTransition) (models.AppVerification, error) {
+	verif := models.AppVerification{
+		AppID:     transition.AppID,
+		Status:    transition.To,
+		Version:   transition.Version,
+		Reason:    transition.Reason,
+		Reviewer:  transition.Reviewer,
+		UpdatedAt: transition.CreatedAt,
+	}
+
+	upsertTrue := true
+	_, err := v.MDbVerifications.ReplaceOne(ctx, bson.D{{"_id", verif.AppID}}, verif,
+		&options.ReplaceOptions{
+			Upsert: &upsertTrue,
+		})
+	if err != nil {
+		return verif, fmt.Errorf("failed to save verification of app %s: %s",
+			verif.AppID, err.Error())
+	}
+
+	if _, err := v.MDbVerificationAudit.InsertOne(ctx, transition); err != nil {
+		return verif, fmt.Errorf("failed to add verification transition of app "+
+			"%s to audit: %s", verif.AppID, err.Error())
+	}
+
+	return verif, nil
+}
+
+// newTransition creates a verification transition made now
+func newTransition(appID, version, from, to, reason,
+	reviewer string) models.VerificationTransition {
+
+	return models.VerificationTransition{
+		ID:        uuid.New().String(),
+		AppID:     appID,
+		Version:   version,
+		From:      from,
+		To:        to,
+		Reason:    reason,
+		Reviewer:  reviewer,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,30 @@
+package verification
+
+import (
+	"testing"
+
+	"github.com/kscout/serverless-registry-api/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanTransition(t *testing.T) {
+	assert.True(t, CanTransition(models.VerificationStatusPending,
+		models.VerificationStatusVerifying))
+	assert.True(t, CanTransition(models.VerificationStatusVerifying,
+		models.VerificationStatusGood))
+	assert.True(t, CanTransition(models.VerificationStatusVerifying,
+		models.VerificationStatusBad))
+	assert.True(t, CanTransition(models.VerificationStatusGood,
+		models.VerificationStatusBad))
+	assert.True(t, CanTransition(models.VerificationStatusBad,
+		models.VerificationStatusVerifying))
+
+	assert.False(t, CanTransition(models.VerificationStatusPending,
+		models.VerificationStatusGood))
+	assert.False(t, CanTransition(models.VerificationStatusBad,
+		models.VerificationStatusGood))
+	assert.False(t, CanTransition(models.VerificationStatusGood,
+		models.VerificationStatusGood))
+	assert.False(t, CanTransition("unknown", models.VerificationStatusVerifying))
+}